@@ -0,0 +1,228 @@
+// Package asciicast records and plays back terminal output in the asciicast v2
+// format, see https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+package asciicast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Version = 2
+
+	// EventOutput is data written to the terminal
+	EventOutput = "o"
+
+	// maxLineLen bounds how much output without a newline is merged into an event
+	maxLineLen = 4096
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported asciicast version")
+
+// Header is the first line of a recording
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a line of a recording following the header, encoded as [time, type, data]
+type Event struct {
+	// Time since the start of the recording in seconds
+	Time float64
+	Type string
+	Data string
+}
+
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("expected an event of 3 fields, got %d", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+type Cast struct {
+	Header *Header
+	Events []*Event
+}
+
+// Encode writes the cast as asciicast v2
+func (c *Cast) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(c.Header); err != nil {
+		return err
+	}
+	for _, e := range c.Events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Decode reads an asciicast v2 recording
+func Decode(r io.Reader) (*Cast, error) {
+	dec := json.NewDecoder(r)
+	c := &Cast{Header: &Header{}}
+	if err := dec.Decode(c.Header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if c.Header.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, c.Header.Version)
+	}
+	for {
+		e := &Event{}
+		if err := dec.Decode(e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(c.Events)+1, err)
+		}
+		c.Events = append(c.Events, e)
+	}
+	return c, nil
+}
+
+// Duration of the recording
+func (c *Cast) Duration() time.Duration {
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return seconds(c.Events[len(c.Events)-1].Time)
+}
+
+// Play writes the output events to w with the recorded timing divided by speed,
+// pauses are capped at maxIdle if it is set. Play stops when ctx is done.
+func (c *Cast) Play(ctx context.Context, w io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	var last float64
+	for _, e := range c.Events {
+		wait := seconds(e.Time - last)
+		last = e.Time
+		if maxIdle > 0 && wait > maxIdle {
+			wait = maxIdle
+		}
+		wait = time.Duration(float64(wait) / speed)
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if e.Type != EventOutput {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Recorder is an io.Writer recording the output written to it along with its timing
+type Recorder struct {
+	header *Header
+	start  time.Time
+
+	lock   sync.Mutex
+	events []*Event
+}
+
+func NewRecorder(width, height int, title string, env map[string]string) *Recorder {
+	now := time.Now()
+	return &Recorder{
+		header: &Header{
+			Version:   Version,
+			Width:     width,
+			Height:    height,
+			Timestamp: now.Unix(),
+			Title:     title,
+			Env:       env,
+		},
+		start: now,
+	}
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, &Event{
+		Time: time.Since(r.start).Seconds(),
+		Type: EventOutput,
+		Data: string(p),
+	})
+	return len(p), nil
+}
+
+// Cast returns the recording. The output is merged into events of whole lines,
+// each event timed at the end of its line, and passed through filter if it is
+// set, e.g. to mask secrets that a write split in two would otherwise hide.
+func (r *Recorder) Cast(filter func(string) string) *Cast {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := &Cast{Header: r.header, Events: []*Event{}}
+	sb := &strings.Builder{}
+	flush := func(t float64) {
+		if sb.Len() == 0 {
+			return
+		}
+		data := sb.String()
+		if filter != nil {
+			data = filter(data)
+		}
+		c.Events = append(c.Events, &Event{Time: t, Type: EventOutput, Data: data})
+		sb.Reset()
+	}
+	for _, e := range r.events {
+		data := e.Data
+		for {
+			i := strings.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			sb.WriteString(data[:i+1])
+			data = data[i+1:]
+			flush(e.Time)
+		}
+		sb.WriteString(data)
+		if sb.Len() >= maxLineLen {
+			flush(e.Time)
+		}
+	}
+	if len(r.events) > 0 {
+		flush(r.events[len(r.events)-1].Time)
+	}
+	return c
+}
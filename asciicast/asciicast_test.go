@@ -0,0 +1,70 @@
+package asciicast
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder_Cast(t *testing.T) {
+	r := NewRecorder(80, 24, "test", nil)
+	for _, s := range []string{"hello ", "world\nthe pass", "word is hunter2\n", "no newline"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.FailNow()
+		}
+	}
+
+	c := r.Cast(func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") })
+	data := []string{}
+	for _, e := range c.Events {
+		assert.Equal(t, EventOutput, e.Type)
+		data = append(data, e.Data)
+	}
+	assert.Equal(t, []string{"hello world\n", "the password is [REDACTED]\n", "no newline"}, data)
+}
+
+func TestCast_EncodeDecode(t *testing.T) {
+	c := &Cast{
+		Header: &Header{Version: Version, Width: 80, Height: 24, Timestamp: 1600000000, Env: map[string]string{"TERM": "xterm"}},
+		Events: []*Event{
+			{Time: 0.5, Type: EventOutput, Data: "\x1b[32mok\x1b[0m\r\n"},
+			{Time: 1.25, Type: EventOutput, Data: "done\n"},
+		},
+	}
+	buf := &bytes.Buffer{}
+	assert.Nil(t, c.Encode(buf))
+	assert.True(t, strings.HasPrefix(buf.String(), `{"version":2,"width":80,"height":24,`))
+	assert.Contains(t, buf.String(), "[1.25,\"o\",\"done\\n\"]\n")
+
+	decoded, err := Decode(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, c, decoded)
+	assert.Equal(t, 1250*time.Millisecond, decoded.Duration())
+
+	_, err = Decode(strings.NewReader(`{"version":1}`))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestCast_Play(t *testing.T) {
+	c := &Cast{
+		Header: &Header{Version: Version},
+		Events: []*Event{
+			{Time: 0.01, Type: EventOutput, Data: "a"},
+			{Time: 60, Type: EventOutput, Data: "b"},
+		},
+	}
+	buf := &bytes.Buffer{}
+	start := time.Now()
+	// the minute pause is capped to the max idle
+	assert.Nil(t, c.Play(context.Background(), buf, 2, 20*time.Millisecond))
+	assert.Equal(t, "ab", buf.String())
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, c.Play(ctx, buf, 1, 0), context.Canceled)
+}
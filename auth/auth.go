@@ -0,0 +1,262 @@
+// Package auth logs configuration entries in to the service with the OAuth2 device
+// authorization grant (RFC 8628), and keeps their tokens fresh.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+)
+
+const (
+	defaultDeviceAuthPath = "/oauth/device/code"
+	defaultTokenPath      = "/oauth/token"
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// a token is refreshed this long before it expires
+	expiryDelta = 10 * time.Second
+)
+
+var (
+	// defaultInterval is how often the token is polled for if the server does not say
+	defaultInterval = 5 * time.Second
+
+	ErrAccessDenied = errors.New("the login was denied")
+	ErrExpiredCode  = errors.New("the login code expired before it was entered")
+	ErrNoRefresh    = errors.New("the login cannot be refreshed")
+)
+
+// DeviceCode is the response to a device authorization request
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauthError is an error response of the authorization server
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+// transientError is a failure to get an answer from the authorization server,
+// e.g. a dropped connection, that may not happen again
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Client requests tokens of a configuration entry from its authorization server. The
+// endpoints default to /oauth/device/code and /oauth/token of the service.
+type Client struct {
+	clientID      string
+	deviceAuthURL string
+	tokenURL      string
+	http          *http.Client
+}
+
+func NewClient(entry *config.Entry, httpClient *http.Client) (*Client, error) {
+	deviceAuthURL, tokenURL := entry.DeviceAuthURL, entry.TokenURL
+	if deviceAuthURL == "" || tokenURL == "" {
+		if entry.ServiceUrl == "" {
+			return nil, fmt.Errorf("%s has no service_url to log in to", entry.Name)
+		}
+		base := strings.TrimSuffix(entry.ServiceUrl, "/")
+		if deviceAuthURL == "" {
+			deviceAuthURL = base + defaultDeviceAuthPath
+		}
+		if tokenURL == "" {
+			tokenURL = base + defaultTokenPath
+		}
+	}
+	clientID := entry.ClientID
+	if clientID == "" {
+		clientID = app.Name
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		clientID:      clientID,
+		deviceAuthURL: deviceAuthURL,
+		tokenURL:      tokenURL,
+		http:          httpClient,
+	}, nil
+}
+
+// RequestDeviceCode starts a login, the user has to enter the returned user code at
+// the verification URI
+func (c *Client) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	resp, err := c.post(ctx, c.deviceAuthURL, url.Values{"client_id": {c.clientID}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device authorization %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	dc := &DeviceCode{}
+	if err := json.Unmarshal(body, dc); err != nil {
+		return nil, fmt.Errorf("device authorization: %w", err)
+	}
+	if dc.DeviceCode == "" || dc.UserCode == "" || dc.VerificationURI == "" {
+		return nil, fmt.Errorf("device authorization: incomplete response %s", body)
+	}
+	return dc, nil
+}
+
+// PollToken waits for the user to enter the code and returns the token. Failures
+// to reach the server are retried until the code expires.
+func (c *Client) PollToken(ctx context.Context, dc *DeviceCode) (*Token, error) {
+	interval := time.Duration(dc.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if dc.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(dc.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrExpiredCode
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		t, err := c.requestToken(ctx, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {dc.DeviceCode},
+			"client_id":   {c.clientID},
+		})
+		var te *transientError
+		if errors.As(err, &te) {
+			tools.Log.Warn().Err(err).Msgf("PollToken: retrying in %v", interval)
+			continue
+		}
+		var oe *oauthError
+		if !errors.As(err, &oe) {
+			return t, err
+		}
+		switch oe.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpiredCode
+		default:
+			return nil, err
+		}
+	}
+}
+
+// Refresh returns a new token for the refresh token of t
+func (c *Client) Refresh(ctx context.Context, t *Token) (*Token, error) {
+	if t.RefreshToken == "" {
+		return nil, ErrNoRefresh
+	}
+	result, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+		"client_id":     {c.clientID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.RefreshToken == "" {
+		// the server may keep the refresh token
+		result.RefreshToken = t.RefreshToken
+	}
+	return result, nil
+}
+
+func (c *Client) requestToken(ctx context.Context, form url.Values) (*Token, error) {
+	resp, err := c.post(ctx, c.tokenURL, form)
+	if err != nil {
+		return nil, &transientError{err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transientError{err}
+	}
+
+	tr := &tokenResponse{}
+	if err := json.Unmarshal(body, tr); err != nil {
+		err = fmt.Errorf("token %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			// e.g. a proxy in front of the server that is restarting
+			return nil, &transientError{err}
+		}
+		return nil, err
+	}
+	if tr.Error != "" {
+		return nil, &oauthError{Code: tr.Error, Description: tr.ErrorDescription}
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return nil, fmt.Errorf("token %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	t := &Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if tr.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second).UTC()
+	}
+	return t, nil
+}
+
+func (c *Client) post(ctx context.Context, u string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s (%s)", app.Name, app.Version, app.CommitHash))
+	return c.http.Do(req)
+}
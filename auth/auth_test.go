@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStubServer is an authorization server, the device code is confirmed after
+// the first poll for the token
+func newStubServer(t *testing.T) *httptest.Server {
+	polls := 0
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		assert.Nil(t, json.NewEncoder(w).Encode(v))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device/code", func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "test-client", r.PostForm.Get("client_id"))
+		writeJSON(w, http.StatusOK, &DeviceCode{
+			DeviceCode:      "device-code",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: "https://example.com/device",
+			ExpiresIn:       60,
+		})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		switch r.PostForm.Get("grant_type") {
+		case deviceCodeGrantType:
+			if r.PostForm.Get("device_code") != "device-code" {
+				writeJSON(w, http.StatusBadRequest, &tokenResponse{Error: "access_denied"})
+				return
+			}
+			polls++
+			if polls == 1 {
+				writeJSON(w, http.StatusBadRequest, &tokenResponse{Error: "authorization_pending"})
+				return
+			}
+			writeJSON(w, http.StatusOK, &tokenResponse{
+				AccessToken: "access-1", TokenType: "Bearer", RefreshToken: "refresh-1", ExpiresIn: 3600})
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh-1" {
+				writeJSON(w, http.StatusBadRequest, &tokenResponse{Error: "invalid_grant"})
+				return
+			}
+			writeJSON(w, http.StatusOK, &tokenResponse{AccessToken: "access-2", TokenType: "Bearer", ExpiresIn: 3600})
+		default:
+			writeJSON(w, http.StatusBadRequest, &tokenResponse{Error: "unsupported_grant_type"})
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestCredentials(t *testing.T) (*Credentials, string) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.FailNow()
+	}
+	return NewCredentials(filepath.Join(dir, "credentials.json")), dir
+}
+
+func TestClient_DeviceLogin(t *testing.T) {
+	defaultInterval = 10 * time.Millisecond
+	srv := newStubServer(t)
+	defer srv.Close()
+	client, err := NewClient(&config.Entry{Name: "test", ServiceUrl: srv.URL, ClientID: "test-client"}, srv.Client())
+	if err != nil {
+		t.FailNow()
+	}
+
+	dc, err := client.RequestDeviceCode(context.Background())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "ABCD-EFGH", dc.UserCode)
+	token, err := client.PollToken(context.Background(), dc)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "access-1", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+	assert.False(t, token.Expired())
+
+	refreshed, err := client.Refresh(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, &Token{AccessToken: "access-2", TokenType: "Bearer", RefreshToken: "refresh-1",
+		Expiry: refreshed.Expiry}, refreshed)
+
+	_, err = client.PollToken(context.Background(), &DeviceCode{DeviceCode: "unknown"})
+	assert.Equal(t, ErrAccessDenied, err)
+	_, err = client.Refresh(context.Background(), &Token{AccessToken: "static"})
+	assert.Equal(t, ErrNoRefresh, err)
+}
+
+func TestClient_PollToken_Retry(t *testing.T) {
+	defaultInterval = 10 * time.Millisecond
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		switch polls {
+		case 1:
+			// the connection is dropped
+			conn, _, err := w.(http.Hijacker).Hijack()
+			assert.Nil(t, err)
+			conn.Close()
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			assert.Nil(t, json.NewEncoder(w).Encode(&tokenResponse{AccessToken: "access-1", TokenType: "Bearer"}))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewClient(&config.Entry{Name: "test", ServiceUrl: srv.URL}, srv.Client())
+	if err != nil {
+		t.FailNow()
+	}
+
+	token, err := client.PollToken(context.Background(), &DeviceCode{DeviceCode: "device-code", ExpiresIn: 5})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "access-1", token.AccessToken)
+	}
+	assert.Equal(t, 3, polls)
+
+	// the server stays unreachable until the code expires
+	srv.Close()
+	_, err = client.PollToken(context.Background(), &DeviceCode{DeviceCode: "device-code", ExpiresIn: 1})
+	assert.Equal(t, ErrExpiredCode, err)
+}
+
+func TestCredentials(t *testing.T) {
+	creds, dir := newTestCredentials(t)
+	defer os.RemoveAll(dir)
+
+	token, err := creds.Get("test")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	assert.Nil(t, creds.Put("test", &Token{AccessToken: "a"}))
+	assert.Nil(t, creds.Put("other", &Token{AccessToken: "b"}))
+	fi, err := os.Stat(filepath.Join(dir, "credentials.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	token, err = creds.Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, &Token{AccessToken: "a"}, token)
+
+	found, err := creds.Delete("test")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	found, err = creds.Delete("test")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	token, err = creds.Get("other")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+}
+
+func TestSession_Refresh(t *testing.T) {
+	srv := newStubServer(t)
+	defer srv.Close()
+	creds, dir := newTestCredentials(t)
+	defer os.RemoveAll(dir)
+	entry := &config.Entry{Name: "test", ServiceUrl: srv.URL}
+	assert.Nil(t, creds.Put("test", &Token{AccessToken: "access-1", RefreshToken: "refresh-1",
+		Expiry: time.Now().Add(-time.Minute)}))
+
+	// the expired token is refreshed and stored
+	s := NewSession(entry, creds, srv.Client())
+	assert.Equal(t, "access-2", s.Token().AccessToken)
+	stored, err := creds.Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "access-2", stored.AccessToken)
+
+	// a token replaced by another session is taken rather than refreshed
+	assert.Nil(t, creds.Put("test", &Token{AccessToken: "access-3"}))
+	assert.Nil(t, s.Refresh("access-2"))
+	assert.Equal(t, "access-3", s.Token().AccessToken)
+	assert.Equal(t, ErrNoRefresh, s.Refresh("access-3"))
+
+	assert.Nil(t, NewSession(&config.Entry{Name: "other"}, creds, nil).Token())
+}
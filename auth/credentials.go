@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/1xyz/pryrite/tools"
+)
+
+// DefaultCredentialsFile returns the path to the file the tokens are kept in
+func DefaultCredentialsFile() string {
+	return tools.ConfigPath("credentials.json")
+}
+
+// Token is an OAuth2 token of a configuration entry
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Expired reports whether the access token has expired, a token without an expiry does not
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(expiryDelta).After(t.Expiry)
+}
+
+// Credentials is a file holding the token of each configuration entry that has logged
+// in, by the name of the entry. The file is only readable by its owner.
+type Credentials struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewCredentials(path string) *Credentials {
+	return &Credentials{path: path}
+}
+
+// Get returns the token of the entry, nil if the entry has not logged in
+func (c *Credentials) Get(name string) (*Token, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tokens, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	return tokens[name], nil
+}
+
+// Put stores the token of the entry, replacing its previous login
+func (c *Credentials) Put(name string, t *Token) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tokens, err := c.read()
+	if err != nil {
+		return err
+	}
+	tokens[name] = t
+	return c.write(tokens)
+}
+
+// Delete removes the token of the entry, it reports false if the entry had not logged in
+func (c *Credentials) Delete(name string) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tokens, err := c.read()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := tokens[name]; !ok {
+		return false, nil
+	}
+	delete(tokens, name)
+	return true, c.write(tokens)
+}
+
+func (c *Credentials) read() (map[string]*Token, error) {
+	tokens := map[string]*Token{}
+	b, err := ioutil.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.path, err)
+	}
+	return tokens, nil
+}
+
+func (c *Credentials) write(tokens map[string]*Token) error {
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tools.EnsureDir(filepath.Dir(c.path)); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
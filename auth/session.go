@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+)
+
+// Session provides the token of a configuration entry to requests to the service,
+// and refreshes it when it expires or is rejected
+type Session struct {
+	name   string
+	creds  *Credentials
+	client *Client
+
+	lock  sync.Mutex
+	token *Token
+}
+
+// NewSession returns the session of the entry's login, if the entry has not logged
+// in its requests are sent without a token
+func NewSession(entry *config.Entry, creds *Credentials, httpClient *http.Client) *Session {
+	s := &Session{name: entry.Name, creds: creds}
+	client, err := NewClient(entry, httpClient)
+	if err != nil {
+		tools.Log.Warn().Err(err).Msgf("NewSession: %s tokens cannot be refreshed", entry.Name)
+	} else {
+		s.client = client
+	}
+	if s.token, err = creds.Get(entry.Name); err != nil {
+		tools.Log.Err(err).Msgf("NewSession: %s reading credentials", entry.Name)
+	}
+	return s
+}
+
+// Token returns the current token, refreshing it first if it has expired. It
+// returns nil if the entry has not logged in.
+func (s *Session) Token() *Token {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token != nil && s.token.Expired() {
+		if err := s.refresh(s.token.AccessToken); err != nil {
+			tools.Log.Warn().Err(err).Msgf("Session: %s refreshing the expired token", s.name)
+		}
+	}
+	return s.token
+}
+
+// Refresh replaces the rejected access token. If another request, or process, has
+// replaced it already that token is used.
+func (s *Session) Refresh(rejected string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.refresh(rejected)
+}
+
+func (s *Session) refresh(rejected string) error {
+	stored, err := s.creds.Get(s.name)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		s.token = nil
+		return ErrNoRefresh
+	}
+	if stored.AccessToken != rejected {
+		s.token = stored
+		return nil
+	}
+	if s.client == nil {
+		return ErrNoRefresh
+	}
+
+	t, err := s.client.Refresh(context.Background(), stored)
+	if err != nil {
+		return err
+	}
+	if err := s.creds.Put(s.name, t); err != nil {
+		return err
+	}
+	tools.Log.Info().Msgf("Session: %s token refreshed, expires at %v", s.name, t.Expiry)
+	s.token = t
+	return nil
+}
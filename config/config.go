@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/1xyz/pryrite/tools"
@@ -11,13 +13,29 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-var (
-	DefaultConfigFile = tools.MyPathTo("pryrite.yaml")
-)
+// DefaultConfigFile returns the path to the configuration file
+func DefaultConfigFile() string {
+	return tools.ConfigPath("pryrite.yaml")
+}
+
+// DefaultLocalStoreFile returns the path to the database of the local store
+func DefaultLocalStoreFile() string {
+	return tools.StatePath("store.db")
+}
+
+// DefaultOutboxFile returns the path to the queue of the updates of the remote store that failed
+func DefaultOutboxFile() string {
+	return tools.StatePath("outbox.db")
+}
 
 const (
 	DefaultDashboardURL = "https://foo/bar"
 	DefaultServiceURL   = "https://foo/bar"
+
+	// ModeRemote (the default) keeps snippets in the service at ServiceUrl
+	ModeRemote = "remote"
+	// ModeLocal keeps snippets in a database on this machine
+	ModeLocal = "local"
 )
 
 type Entry struct {
@@ -27,17 +45,93 @@ type Entry struct {
 	ServiceUrl       string                   `yaml:"service_url"`
 	LastUpdateCheck  time.Time                `yaml:"last_update_check"`
 	AuthScheme       string                   `yaml:"auth_scheme"`
+	DeviceAuthURL    string                   `yaml:"device_auth_url,omitempty"`
+	TokenURL         string                   `yaml:"token_url,omitempty"`
 	Email            string                   `yaml:"email"`
 	ClientID         string                   `yaml:"client_id"`
 	SkipSSLCheck     bool                     `yaml:"skip_ssl_check"`
 	Style            string                   `yaml:"style"`
 	ExecutionTimeout tools.MarshalledDuration `yaml:"execution_timeout"`
 	HideInspectIntro bool                     `yaml:"hide_inspect_intro"`
+	Policy           PolicyConfig             `yaml:"policy,omitempty"`
+	TrustedKeys      []string                 `yaml:"trusted_keys,omitempty"`
+	Redact           RedactConfig             `yaml:"redact,omitempty"`
+	Secrets          SecretsConfig            `yaml:"secrets,omitempty"`
+	ResultLog        ResultLogConfig          `yaml:"result_log,omitempty"`
+}
+
+// ResultLogConfig configures how the results of executions are stored and how long they are retained,
+// zero values are unlimited
+type ResultLogConfig struct {
+	// MaxAge is the age after which entries are removed
+	MaxAge tools.MarshalledDuration `yaml:"max_age,omitempty"`
+	// MaxEntriesPerNode is the number of entries kept for each markdown file
+	MaxEntriesPerNode int `yaml:"max_entries_per_node,omitempty"`
+	// MaxTotalBytes is the size of all result logs after which the oldest entries are removed
+	MaxTotalBytes int64 `yaml:"max_total_bytes,omitempty"`
+	// Format of new result logs, files (the default) keeps a file per entry, journal appends to a single file
+	Format string `yaml:"format,omitempty"`
+	// Record the terminal output of each executed block as an asciicast
+	Record bool `yaml:"record,omitempty"`
+	// GCOnOpen applies the retention policy when a markdown file is opened, rather than only with logs gc
+	GCOnOpen bool `yaml:"gc_on_open,omitempty"`
+}
+
+// SecretsConfig configures the providers used to resolve ${secret:name} references in blocks
+type SecretsConfig struct {
+	// Providers lists the providers (env, file, command) in the order they are consulted
+	Providers []string `yaml:"providers,omitempty"`
+	// EnvPrefix is prepended to the upper-cased name when looking up an environment variable
+	EnvPrefix string `yaml:"env_prefix,omitempty"`
+	// File is the path to the encrypted secrets file
+	File string `yaml:"file,omitempty"`
+	// Command is run to retrieve a secret, {name} is replaced with the secret's name
+	Command string `yaml:"command,omitempty"`
+	// NotFoundExitCode is the exit status of the command when the secret does not exist
+	NotFoundExitCode int `yaml:"not_found_exit_code,omitempty"`
+	// NotFoundPattern is a regular expression matching the stderr of the command when
+	// the secret does not exist
+	NotFoundPattern string `yaml:"not_found_pattern,omitempty"`
+}
+
+// RedactConfig configures how secrets are masked in captured output before it is persisted
+type RedactConfig struct {
+	DisableBuiltinDetectors bool `yaml:"disable_builtin_detectors,omitempty"`
+	DisableEntropyDetector  bool `yaml:"disable_entropy_detector,omitempty"`
+	// Patterns are regular expressions, the first capture group (or the whole match) is masked
+	Patterns []string `yaml:"patterns,omitempty"`
+	// SecretEnv are names of environment variables whose values are masked
+	SecretEnv []string `yaml:"secret_env,omitempty"`
+}
+
+// PolicyRule flags a code block whose content matches the Pattern (a regular expression)
+type PolicyRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Reason  string `yaml:"reason,omitempty"`
+}
+
+// PolicyConfig configures the rules used to detect dangerous code blocks before execution
+type PolicyConfig struct {
+	DisableBuiltinRules bool         `yaml:"disable_builtin_rules,omitempty"`
+	Rules               []PolicyRule `yaml:"rules,omitempty"`
+}
+
+// profile is the name of the entry used rather than the default entry, see SetProfile
+var profile string
+
+// SetProfile makes the entry with the name the one in use rather than the default entry
+func SetProfile(name string) {
+	profile = name
 }
 
 type Config struct {
 	Entries      []Entry `yaml:"entries"`
 	DefaultEntry string  `yaml:"default"`
+
+	// overrides of the values of the entry overridden, the one in use, by field name
+	overrides  map[string]*override
+	overridden string
 }
 
 func (c *Config) Get(name string) (*Entry, bool) {
@@ -49,8 +143,21 @@ func (c *Config) Get(name string) (*Entry, bool) {
 	return &c.Entries[index], found
 }
 
+// GetDefaultEntry returns the entry in use, see ActiveEntry
 func (c *Config) GetDefaultEntry() (*Entry, bool) {
-	return c.Get(c.DefaultEntry)
+	return c.Get(c.ActiveEntry())
+}
+
+// ActiveEntry returns the name of the entry in use: the profile if one is set,
+// else the one named by PRYRITE_PROFILE, else the default entry
+func (c *Config) ActiveEntry() string {
+	if profile != "" {
+		return profile
+	}
+	if name := os.Getenv(ProfileEnv); name != "" {
+		return name
+	}
+	return c.DefaultEntry
 }
 
 func (c *Config) Set(e *Entry) error {
@@ -63,6 +170,14 @@ func (c *Config) Set(e *Entry) error {
 }
 
 func (c *Config) Add(name, serviceUrl string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("an entry has no name")
+	}
+	if serviceUrl != "" {
+		if err := setURL(new(string), serviceUrl); err != nil {
+			return err
+		}
+	}
 	_, found := c.getIndex(name)
 	if found {
 		return fmt.Errorf("entry with name = %s exists", name)
@@ -100,14 +215,28 @@ func (c *Config) SetDefault(name string) error {
 	return nil
 }
 
+// SaveFile writes the configuration to the file. The values overridden by
+// environment variables or flags are not saved. The values are validated when
+// they are set, so that an invalid value of an entry that is not changed, e.g.
+// one edited by hand, does not keep the others from being saved.
 func (c *Config) SaveFile(filename string) error {
+	if IsReadOnly() {
+		return fmt.Errorf("save %s: %w", filename, ErrReadOnly)
+	}
+	if _, found := c.Get(c.DefaultEntry); c.DefaultEntry != "" && !found {
+		return fmt.Errorf("the default entry %s does not exist", c.DefaultEntry)
+	}
+	out, err := c.withoutOverrides()
+	if err != nil {
+		return err
+	}
 	fp, err := tools.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
 	if err != nil {
 		return fmt.Errorf("OpenFile %s err = %v", filename, err)
 	}
 	defer tools.CloseFile(fp)
 	enc := yaml.NewEncoder(fp)
-	return enc.Encode(&c)
+	return enc.Encode(out)
 }
 
 func (c *Config) getIndex(name string) (int, bool) {
@@ -119,9 +248,13 @@ func (c *Config) getIndex(name string) (int, bool) {
 	return -1, false
 }
 
+// New reads the configuration file, a missing or empty file is a configuration with
+// a Default entry. The file is only created when the configuration is saved.
 func New(filename string) (*Config, error) {
-	fp, err := tools.OpenFile(filename, os.O_RDONLY|os.O_CREATE)
-	if err != nil {
+	fp, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return newDefaultConfig()
+	} else if err != nil {
 		return nil, err
 	}
 	defer tools.CloseFile(fp)
@@ -132,21 +265,7 @@ func New(filename string) (*Config, error) {
 	}
 
 	if size == 0 {
-		e := Entry{
-			Name:             "Default",
-			LastUpdateCheck:  time.Now(),
-			Email:            "unknown@bar.com",
-			ExecutionTimeout: tools.MarshalledDuration{Duration: 0 * time.Second},
-			HideInspectIntro: false,
-		}
-		c := &Config{
-			Entries:      []Entry{e},
-			DefaultEntry: e.Name,
-		}
-		if err := c.Set(&e); err != nil {
-			return nil, err
-		}
-		return c, nil
+		return newDefaultConfig()
 	}
 
 	dec := yaml.NewDecoder(fp)
@@ -157,6 +276,24 @@ func New(filename string) (*Config, error) {
 	return &c, nil
 }
 
+func newDefaultConfig() (*Config, error) {
+	e := Entry{
+		Name:             "Default",
+		LastUpdateCheck:  time.Now(),
+		Email:            "unknown@bar.com",
+		ExecutionTimeout: tools.MarshalledDuration{Duration: 0 * time.Second},
+		HideInspectIntro: false,
+	}
+	c := &Config{
+		Entries:      []Entry{e},
+		DefaultEntry: e.Name,
+	}
+	if err := c.Set(&e); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 func fileSize(fp *os.File) (int64, error) {
 	fi, err := fp.Stat()
 	if err != nil {
@@ -165,8 +302,17 @@ func fileSize(fp *os.File) (int64, error) {
 	return fi.Size(), nil
 }
 
+// Default reads the configuration file and applies the environment variables and
+// flags overriding the values of the entry in use
 func Default() (*Config, error) {
-	return New(DefaultConfigFile)
+	c, err := New(DefaultConfigFile())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.applyOverrides(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func GetEntry(name string) (*Entry, error) {
@@ -176,9 +322,9 @@ func GetEntry(name string) (*Entry, error) {
 	}
 
 	if name == "" {
-		name = cfg.DefaultEntry
+		name = cfg.ActiveEntry()
 		if name == "" {
-			return nil, fmt.Errorf("there is no default configuration. See  Config --help to set a default configuration")
+			return nil, fmt.Errorf("there is no default configuration. See config use --help to set a default configuration")
 		}
 	}
 
@@ -197,7 +343,7 @@ func SetEntry(e *Entry) error {
 	if err := cfg.Set(e); err != nil {
 		return err
 	}
-	return cfg.SaveFile(DefaultConfigFile)
+	return cfg.SaveFile(DefaultConfigFile())
 }
 
 func CreateDefaultConfigIfEmpty() error {
@@ -211,5 +357,5 @@ func CreateDefaultConfigIfEmpty() error {
 	if err := cfg.Add("remote", DefaultServiceURL); err != nil {
 		return err
 	}
-	return cfg.SaveFile(DefaultConfigFile)
+	return cfg.SaveFile(DefaultConfigFile())
 }
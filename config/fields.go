@@ -0,0 +1,439 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1xyz/pryrite/tools"
+	"github.com/charmbracelet/glamour"
+	"gopkg.in/yaml.v2"
+)
+
+// Field is a setting of an entry that can be read and changed by its YAML key
+type Field struct {
+	Name  string
+	Usage string
+
+	get func(e *Entry) string
+	// set validates the value before it changes the entry
+	set func(e *Entry, v string) error
+	// fileOnly fields guard what is run, they are not overridden by an
+	// environment variable that may be inherited, or a flag
+	fileOnly bool
+}
+
+// Overridable reports whether the field can be overridden by an environment variable or --set
+func (f *Field) Overridable() bool {
+	return !f.fileOnly
+}
+
+// Fields are the settings of an entry that can be changed with config set, all but
+// its name and when updates were last checked. Lists are written as YAML flow
+// sequences, e.g. [a, b].
+var Fields = []*Field{
+	{
+		Name:  "mode",
+		Usage: "where snippets are kept: remote (the service at service_url) or local",
+		get:   func(e *Entry) string { return e.Mode },
+		set: func(e *Entry, v string) error {
+			return setOneOf(&e.Mode, v, ModeRemote, ModeLocal)
+		},
+	},
+	{
+		Name:  "service_url",
+		Usage: "http(s) URL of the service",
+		get:   func(e *Entry) string { return e.ServiceUrl },
+		set:   func(e *Entry, v string) error { return setURL(&e.ServiceUrl, v) },
+	},
+	{
+		Name:  "dashboard_url",
+		Usage: "http(s) URL of the dashboard that links to nodes point at",
+		get:   func(e *Entry) string { return e.DashboardUrl },
+		set:   func(e *Entry, v string) error { return setURL(&e.DashboardUrl, v) },
+	},
+	{
+		Name:  "auth_scheme",
+		Usage: "scheme of the Authorization header, the type of the token if not set",
+		get:   func(e *Entry) string { return e.AuthScheme },
+		set:   func(e *Entry, v string) error { e.AuthScheme = v; return nil },
+	},
+	{
+		Name:  "device_auth_url",
+		Usage: "http(s) URL to start a login at, service_url/oauth/device/code if not set",
+		get:   func(e *Entry) string { return e.DeviceAuthURL },
+		set:   func(e *Entry, v string) error { return setURL(&e.DeviceAuthURL, v) },
+	},
+	{
+		Name:  "token_url",
+		Usage: "http(s) URL to request tokens from, service_url/oauth/token if not set",
+		get:   func(e *Entry) string { return e.TokenURL },
+		set:   func(e *Entry, v string) error { return setURL(&e.TokenURL, v) },
+	},
+	{
+		Name:  "email",
+		Usage: "recorded as who executed a block",
+		get:   func(e *Entry) string { return e.Email },
+		set:   func(e *Entry, v string) error { e.Email = v; return nil },
+	},
+	{
+		Name:  "client_id",
+		Usage: "OAuth2 client ID used to log in",
+		get:   func(e *Entry) string { return e.ClientID },
+		set:   func(e *Entry, v string) error { e.ClientID = v; return nil },
+	},
+	{
+		Name:  "skip_ssl_check",
+		Usage: "true to skip verifying the certificate of the service",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.SkipSSLCheck) },
+		set:   func(e *Entry, v string) error { return setBool(&e.SkipSSLCheck, v) },
+	},
+	{
+		Name:  "style",
+		Usage: "style markdown is rendered in: " + strings.Join(styleNames(), ", "),
+		get:   func(e *Entry) string { return e.Style },
+		set: func(e *Entry, v string) error {
+			return setOneOf(&e.Style, v, styleNames()...)
+		},
+	},
+	{
+		Name:  "execution_timeout",
+		Usage: "how long a block may run, e.g. 10m, 0 for no limit",
+		get:   func(e *Entry) string { return e.ExecutionTimeout.String() },
+		set:   func(e *Entry, v string) error { return setDuration(&e.ExecutionTimeout, v) },
+	},
+	{
+		Name:  "hide_inspect_intro",
+		Usage: "true to skip the introduction when a file is opened",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.HideInspectIntro) },
+		set:   func(e *Entry, v string) error { return setBool(&e.HideInspectIntro, v) },
+	},
+	{
+		Name:     "policy.disable_builtin_rules",
+		Usage:    "true to only apply the configured policy rules",
+		fileOnly: true,
+		get:      func(e *Entry) string { return strconv.FormatBool(e.Policy.DisableBuiltinRules) },
+		set:      func(e *Entry, v string) error { return setBool(&e.Policy.DisableBuiltinRules, v) },
+	},
+	{
+		Name:     "policy.rules",
+		Usage:    "rules flagging dangerous blocks, e.g. [{name: n, pattern: re, reason: r}]",
+		fileOnly: true,
+		get: func(e *Entry) string {
+			if len(e.Policy.Rules) == 0 {
+				return ""
+			}
+			return flowYAML(e.Policy.Rules)
+		},
+		set: func(e *Entry, v string) error { return setRules(&e.Policy.Rules, v) },
+	},
+	{
+		Name:     "trusted_keys",
+		Usage:    "public keys that signatures of markdown files are verified with",
+		fileOnly: true,
+		get:      func(e *Entry) string { return getList(e.TrustedKeys) },
+		set:      func(e *Entry, v string) error { return setList(&e.TrustedKeys, v) },
+	},
+	{
+		Name:  "redact.disable_builtin_detectors",
+		Usage: "true to only mask the configured patterns and environment variables",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.Redact.DisableBuiltinDetectors) },
+		set:   func(e *Entry, v string) error { return setBool(&e.Redact.DisableBuiltinDetectors, v) },
+	},
+	{
+		Name:  "redact.disable_entropy_detector",
+		Usage: "true to not mask high-entropy tokens",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.Redact.DisableEntropyDetector) },
+		set:   func(e *Entry, v string) error { return setBool(&e.Redact.DisableEntropyDetector, v) },
+	},
+	{
+		Name:  "redact.patterns",
+		Usage: "regular expressions masked in the output, the first group or the whole match",
+		get:   func(e *Entry) string { return getList(e.Redact.Patterns) },
+		set:   func(e *Entry, v string) error { return setRegexps(&e.Redact.Patterns, v) },
+	},
+	{
+		Name:  "redact.secret_env",
+		Usage: "environment variables whose values are masked in the output",
+		get:   func(e *Entry) string { return getList(e.Redact.SecretEnv) },
+		set:   func(e *Entry, v string) error { return setList(&e.Redact.SecretEnv, v) },
+	},
+	{
+		Name:  "secrets.providers",
+		Usage: "providers secrets are looked up in, in order: env, file, command",
+		get:   func(e *Entry) string { return getList(e.Secrets.Providers) },
+		set: func(e *Entry, v string) error {
+			var providers []string
+			if err := setList(&providers, v); err != nil {
+				return err
+			}
+			for _, p := range providers {
+				if err := setOneOf(new(string), p, "env", "file", "command"); err != nil {
+					return err
+				}
+			}
+			e.Secrets.Providers = providers
+			return nil
+		},
+	},
+	{
+		Name:  "secrets.env_prefix",
+		Usage: "prefix of the environment variables of secrets, PRYRITE_SECRET_ if not set",
+		get:   func(e *Entry) string { return e.Secrets.EnvPrefix },
+		set:   func(e *Entry, v string) error { e.Secrets.EnvPrefix = v; return nil },
+	},
+	{
+		Name:  "secrets.file",
+		Usage: "path to the encrypted secrets file, secrets.enc in the configuration directory if not set",
+		get:   func(e *Entry) string { return e.Secrets.File },
+		set:   func(e *Entry, v string) error { e.Secrets.File = v; return nil },
+	},
+	{
+		Name:  "secrets.command",
+		Usage: "command printing a secret, {name} is replaced with its name",
+		get:   func(e *Entry) string { return e.Secrets.Command },
+		set:   func(e *Entry, v string) error { e.Secrets.Command = v; return nil },
+	},
+	{
+		Name:  "secrets.not_found_exit_code",
+		Usage: "exit status of the command when a secret does not exist, 0 if not set",
+		get:   func(e *Entry) string { return strconv.Itoa(e.Secrets.NotFoundExitCode) },
+		set: func(e *Entry, v string) error {
+			if v == "" {
+				e.Secrets.NotFoundExitCode = 0
+				return nil
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 255 {
+				return fmt.Errorf("%q is not an exit status", v)
+			}
+			e.Secrets.NotFoundExitCode = n
+			return nil
+		},
+	},
+	{
+		Name:  "secrets.not_found_pattern",
+		Usage: "regular expression matching the stderr of the command when a secret does not exist",
+		get:   func(e *Entry) string { return e.Secrets.NotFoundPattern },
+		set: func(e *Entry, v string) error {
+			if _, err := regexp.Compile(v); err != nil {
+				return fmt.Errorf("%q is not a regular expression: %v", v, err)
+			}
+			e.Secrets.NotFoundPattern = v
+			return nil
+		},
+	},
+	{
+		Name:  "result_log.max_age",
+		Usage: "age after which results are removed, e.g. 720h, 0 to keep them",
+		get:   func(e *Entry) string { return e.ResultLog.MaxAge.String() },
+		set:   func(e *Entry, v string) error { return setDuration(&e.ResultLog.MaxAge, v) },
+	},
+	{
+		Name:  "result_log.max_entries_per_node",
+		Usage: "number of results kept for each file, 0 for all",
+		get:   func(e *Entry) string { return strconv.Itoa(e.ResultLog.MaxEntriesPerNode) },
+		set: func(e *Entry, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%q is not a number of entries", v)
+			}
+			e.ResultLog.MaxEntriesPerNode = n
+			return nil
+		},
+	},
+	{
+		Name:  "result_log.max_total_bytes",
+		Usage: "size of all results after which the oldest are removed, 0 for no limit",
+		get:   func(e *Entry) string { return strconv.FormatInt(e.ResultLog.MaxTotalBytes, 10) },
+		set: func(e *Entry, v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%q is not a number of bytes", v)
+			}
+			e.ResultLog.MaxTotalBytes = n
+			return nil
+		},
+	},
+	{
+		Name:  "result_log.format",
+		Usage: "how new result logs are stored: files or journal",
+		get:   func(e *Entry) string { return e.ResultLog.Format },
+		set: func(e *Entry, v string) error {
+			return setOneOf(&e.ResultLog.Format, v, "files", "journal")
+		},
+	},
+	{
+		Name:  "result_log.record",
+		Usage: "true to record the terminal output of blocks as asciicasts",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.ResultLog.Record) },
+		set:   func(e *Entry, v string) error { return setBool(&e.ResultLog.Record, v) },
+	},
+	{
+		Name:  "result_log.gc_on_open",
+		Usage: "true to apply the retention policy when a markdown file is opened",
+		get:   func(e *Entry) string { return strconv.FormatBool(e.ResultLog.GCOnOpen) },
+		set:   func(e *Entry, v string) error { return setBool(&e.ResultLog.GCOnOpen, v) },
+	},
+}
+
+// GetField returns the field with the name
+func GetField(name string) (*Field, bool) {
+	for _, f := range Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the value of the field of the entry
+func (f *Field) Get(e *Entry) string {
+	return f.get(e)
+}
+
+// Set validates the value and sets the field of the entry to it, an empty value
+// unsets the field
+func (f *Field) Set(e *Entry, v string) error {
+	v = strings.TrimSpace(v)
+	if err := f.set(e, v); err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return nil
+}
+
+func setOneOf(field *string, v string, allowed ...string) error {
+	if v != "" {
+		found := false
+		for _, a := range allowed {
+			found = found || a == v
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", v, strings.Join(allowed, ", "))
+		}
+	}
+	*field = v
+	return nil
+}
+
+func setURL(field *string, v string) error {
+	if v != "" {
+		u, err := url.Parse(v)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q is not an http(s) URL", v)
+		}
+	}
+	*field = v
+	return nil
+}
+
+func setBool(field *bool, v string) error {
+	if v == "" {
+		*field = false
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", v)
+	}
+	*field = b
+	return nil
+}
+
+func setDuration(field *tools.MarshalledDuration, v string) error {
+	if v == "" {
+		field.Duration = 0
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration, e.g. 90s or 10m", v)
+	}
+	if d < 0 {
+		return fmt.Errorf("%q is negative", v)
+	}
+	field.Duration = d
+	return nil
+}
+
+// flowYAML returns the value as a single line of YAML, e.g. [a, b]
+func flowYAML(v interface{}) string {
+	b, err := yaml.Marshal(struct {
+		V interface{} `yaml:"v,flow"`
+	}{v})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), "v: "), "\n")
+}
+
+func getList(l []string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	return flowYAML(l)
+}
+
+func setList(field *[]string, v string) error {
+	if v == "" {
+		*field = nil
+		return nil
+	}
+	var l []string
+	if err := yaml.Unmarshal([]byte(v), &l); err != nil {
+		return fmt.Errorf("%q is not a list, e.g. [a, b]", v)
+	}
+	*field = l
+	return nil
+}
+
+func setRegexps(field *[]string, v string) error {
+	var l []string
+	if err := setList(&l, v); err != nil {
+		return err
+	}
+	for _, p := range l {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("%q is not a regular expression: %v", p, err)
+		}
+	}
+	*field = l
+	return nil
+}
+
+func setRules(field *[]PolicyRule, v string) error {
+	if v == "" {
+		*field = nil
+		return nil
+	}
+	var rules []PolicyRule
+	if err := yaml.Unmarshal([]byte(v), &rules); err != nil {
+		return fmt.Errorf("%q is not a list of rules, e.g. [{name: n, pattern: re}]", v)
+	}
+	for _, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("a rule has no name")
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("rule %s: %q is not a regular expression: %v", r.Name, r.Pattern, err)
+		}
+	}
+	*field = rules
+	return nil
+}
+
+func styleNames() []string {
+	names := make([]string, 0, len(glamour.DefaultStyles))
+	for name := range glamour.DefaultStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestField_Set(t *testing.T) {
+	e := &Entry{Name: "test"}
+	for _, tc := range []struct {
+		name, value string
+		valid       bool
+	}{
+		{"mode", "local", true},
+		{"mode", "cloud", false},
+		{"service_url", "https://pryrite.example.com", true},
+		{"service_url", "pryrite.example.com", false},
+		{"service_url", "ftp://pryrite.example.com", false},
+		{"style", "dark", true},
+		{"style", "neon", false},
+		{"execution_timeout", "10m", true},
+		{"execution_timeout", "ten minutes", false},
+		{"execution_timeout", "-1s", false},
+		{"skip_ssl_check", "yes", false},
+		{"result_log.max_entries_per_node", "-1", false},
+		{"result_log.format", "journal", true},
+	} {
+		f, ok := GetField(tc.name)
+		if !assert.True(t, ok, tc.name) {
+			continue
+		}
+		assert.Equal(t, tc.valid, f.Set(e, tc.value) == nil, "%s %s", tc.name, tc.value)
+	}
+	assert.Equal(t, ModeLocal, e.Mode)
+	assert.Equal(t, "https://pryrite.example.com", e.ServiceUrl)
+	assert.Equal(t, 10*time.Minute, e.ExecutionTimeout.Duration)
+
+	f, _ := GetField("mode")
+	assert.Nil(t, f.Set(e, ""))
+	assert.Equal(t, "", e.Mode)
+	_, ok := GetField("name")
+	assert.False(t, ok)
+}
+
+func TestConfig_SaveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "pryrite.yaml")
+
+	c := &Config{}
+	assert.Nil(t, c.Add("staging", "https://staging.example.com"))
+	assert.Nil(t, c.Add("local", ""))
+	assert.Nil(t, c.SetDefault("staging"))
+	assert.Nil(t, c.SaveFile(filename))
+	assert.NotNil(t, c.Add("", ""))
+	assert.NotNil(t, c.Add("broken", "ftp://example.com"))
+
+	// a value edited by hand in another entry does not keep a change from being saved
+	c.Entries[1].Style = "neon"
+	f, _ := GetField("execution_timeout")
+	assert.Nil(t, c.SetField(&c.Entries[0], f, "5m"))
+	assert.NotNil(t, c.SetField(&c.Entries[0], f, "soon"))
+	assert.Nil(t, c.SaveFile(filename))
+	c.DefaultEntry = "missing"
+	assert.NotNil(t, c.SaveFile(filename))
+
+	saved, err := New(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "staging", saved.DefaultEntry)
+	assert.Len(t, saved.Entries, 2)
+	assert.Equal(t, 5*time.Minute, saved.Entries[0].ExecutionTimeout.Duration)
+	assert.Equal(t, "neon", saved.Entries[1].Style)
+
+	SetProfile("local")
+	defer SetProfile("")
+	e, ok := saved.GetDefaultEntry()
+	assert.True(t, ok)
+	assert.Equal(t, "local", e.Name)
+}
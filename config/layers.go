@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/1xyz/pryrite/tools"
+)
+
+// The values of the entry in use are layered: the configuration file, overridden
+// by the PRYRITE_<KEY> environment variables, overridden by --set key=value flags.
+// The fields that guard what is run are only read from the file.
+const (
+	envPrefix = "PRYRITE_"
+
+	// ProfileEnv names the environment variable choosing the entry in use
+	ProfileEnv = envPrefix + "PROFILE"
+	// ReadOnlyEnv names the environment variable that keeps the configuration file from being written
+	ReadOnlyEnv = envPrefix + "READ_ONLY"
+
+	OriginDefault = "default"
+	OriginFile    = "file"
+	OriginEnv     = "env"
+	OriginFlag    = "flag"
+)
+
+var (
+	ErrReadOnly = errors.New("the configuration is read-only")
+
+	readOnly      bool
+	flagOverrides []*flagOverride
+	// ignoredEnv are the environment variables of fields that are not overridable
+	ignoredEnv sync.Map
+)
+
+type flagOverride struct {
+	field *Field
+	value string
+}
+
+// override is a value of the entry in use that is not from the file
+type override struct {
+	origin string
+	// source is the environment variable or flag the value is from
+	source string
+	value  string
+	// fileValue is the value in the file, that is saved rather than the override
+	fileValue string
+}
+
+// EnvName returns the environment variable overriding the field, e.g. PRYRITE_RESULT_LOG_MAX_AGE
+func EnvName(field string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(field))
+}
+
+// SetOverrides sets the key=value pairs of the command line that override the
+// values of the entry in use
+func SetOverrides(pairs []string) error {
+	result := []*flagOverride{}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("--set %s: expected key=value", pair)
+		}
+		f, ok := GetField(strings.TrimSpace(kv[0]))
+		if !ok {
+			return fmt.Errorf("--set %s: unknown key %s", pair, kv[0])
+		}
+		if !f.Overridable() {
+			return fmt.Errorf("--set %s: %s can only be set in the configuration file", pair, f.Name)
+		}
+		result = append(result, &flagOverride{field: f, value: kv[1]})
+	}
+	flagOverrides = result
+	return nil
+}
+
+// SetReadOnly keeps the configuration file from being created or written
+func SetReadOnly(ro bool) {
+	readOnly = ro
+}
+
+// IsReadOnly reports whether the configuration file may not be written, with
+// SetReadOnly or PRYRITE_READ_ONLY
+func IsReadOnly() bool {
+	if readOnly {
+		return true
+	}
+	ro, _ := strconv.ParseBool(os.Getenv(ReadOnlyEnv))
+	return ro
+}
+
+// Origin returns where the effective value of the field of the entry in use is
+// from, and the environment variable or flag if it is overridden
+func (c *Config) Origin(name string) (string, string) {
+	if o, ok := c.overrides[name]; ok {
+		return o.origin, o.source
+	}
+	f, ok := GetField(name)
+	e, found := c.GetDefaultEntry()
+	if !ok || !found || f.Get(e) == f.Get(&Entry{}) {
+		return OriginDefault, ""
+	}
+	return OriginFile, ""
+}
+
+// applyOverrides sets the values of the environment variables and flags on the entry in use
+func (c *Config) applyOverrides() error {
+	c.overrides = map[string]*override{}
+	name := c.ActiveEntry()
+	e, ok := c.Get(name)
+	if !ok {
+		if name != c.DefaultEntry {
+			return fmt.Errorf("profile %s not found", name)
+		}
+		// nothing to override without a default entry
+		return nil
+	}
+
+	apply := func(f *Field, value, origin, source string) error {
+		fileValue := f.Get(e)
+		if o, ok := c.overrides[f.Name]; ok {
+			fileValue = o.fileValue
+		}
+		if err := f.Set(e, value); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		c.overrides[f.Name] = &override{origin: origin, source: source, value: f.Get(e), fileValue: fileValue}
+		return nil
+	}
+	for _, f := range Fields {
+		env := EnvName(f.Name)
+		if _, ok := os.LookupEnv(env); ok && !f.Overridable() {
+			// the configuration is read more than once by a command
+			if _, warned := ignoredEnv.LoadOrStore(env, true); !warned {
+				tools.LogStdError("%s is ignored, %s can only be set in the configuration file\n", env, f.Name)
+			}
+			continue
+		}
+		if value, ok := os.LookupEnv(env); ok {
+			if err := apply(f, value, OriginEnv, env); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fo := range flagOverrides {
+		if err := apply(fo.field, fo.value, OriginFlag, fmt.Sprintf("--set %s=%s", fo.field.Name, fo.value)); err != nil {
+			return err
+		}
+	}
+	c.overridden = name
+	return nil
+}
+
+// SetField sets the value of the field in the file layer of the entry, it stays
+// overridden by the environment variable or flag until they are unset. The value
+// is saved even if it is the same as the override.
+func (c *Config) SetField(e *Entry, f *Field, value string) error {
+	o, ok := c.overrides[f.Name]
+	if !ok || e.Name != c.overridden {
+		return f.Set(e, value)
+	}
+	file := *e
+	if err := f.Set(&file, value); err != nil {
+		return err
+	}
+	o.fileValue = f.Get(&file)
+	return nil
+}
+
+// withoutOverrides returns the configuration to save, the overridden values of the
+// entry in use are replaced by the values of the file layer unless they were
+// changed since without SetField
+func (c *Config) withoutOverrides() (*Config, error) {
+	if len(c.overrides) == 0 {
+		return c, nil
+	}
+	result := &Config{
+		Entries:      append([]Entry{}, c.Entries...),
+		DefaultEntry: c.DefaultEntry,
+	}
+	e, ok := result.Get(c.overridden)
+	if !ok {
+		return result, nil
+	}
+	for name, o := range c.overrides {
+		f, _ := GetField(name)
+		if f.Get(e) == o.value {
+			if err := f.Set(e, o.fileValue); err != nil {
+				return nil, fmt.Errorf("entry %s: %w", e.Name, err)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Overrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "pryrite.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(
+		"default: ci\nentries:\n- name: ci\n  style: dark\n  execution_timeout: 10m\n"), 0600))
+
+	os.Setenv(EnvName("execution_timeout"), "1m")
+	os.Setenv(EnvName("style"), "ascii")
+	defer os.Unsetenv(EnvName("execution_timeout"))
+	defer os.Unsetenv(EnvName("style"))
+	assert.Nil(t, SetOverrides([]string{"style=light"}))
+	defer SetOverrides(nil)
+
+	c, err := New(filename)
+	assert.Nil(t, err)
+	assert.Nil(t, c.applyOverrides())
+	e, ok := c.GetDefaultEntry()
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.Equal(t, time.Minute, e.ExecutionTimeout.Duration)
+	assert.Equal(t, "light", e.Style)
+	origin, source := c.Origin("execution_timeout")
+	assert.Equal(t, OriginEnv, origin)
+	assert.Equal(t, "PRYRITE_EXECUTION_TIMEOUT", source)
+	origin, _ = c.Origin("style")
+	assert.Equal(t, OriginFlag, origin)
+	origin, _ = c.Origin("mode")
+	assert.Equal(t, OriginDefault, origin)
+
+	// the overrides are not saved, a changed value is
+	e.HideInspectIntro = true
+	assert.Nil(t, c.SaveFile(filename))
+	saved, err := New(filename)
+	assert.Nil(t, err)
+	e, _ = saved.Get("ci")
+	assert.Equal(t, 10*time.Minute, e.ExecutionTimeout.Duration)
+	assert.Equal(t, "dark", e.Style)
+	assert.True(t, e.HideInspectIntro)
+
+	// a value set in the file layer is saved, even if it is the override
+	c, err = New(filename)
+	assert.Nil(t, err)
+	assert.Nil(t, c.applyOverrides())
+	e, _ = c.GetDefaultEntry()
+	f, _ := GetField("execution_timeout")
+	assert.Nil(t, c.SetField(e, f, "1m"))
+	assert.Equal(t, time.Minute, e.ExecutionTimeout.Duration)
+	assert.Nil(t, c.SaveFile(filename))
+	saved, err = New(filename)
+	assert.Nil(t, err)
+	e, _ = saved.Get("ci")
+	assert.Equal(t, time.Minute, e.ExecutionTimeout.Duration)
+
+	os.Setenv(EnvName("execution_timeout"), "soon")
+	c, err = New(filename)
+	assert.Nil(t, err)
+	assert.NotNil(t, c.applyOverrides())
+}
+
+func TestConfig_FileOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "pryrite.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(
+		"default: ci\nentries:\n- name: ci\n  trusted_keys: [key1]\n"), 0600))
+
+	assert.NotNil(t, SetOverrides([]string{"policy.disable_builtin_rules=true"}))
+	assert.NotNil(t, SetOverrides([]string{"trusted_keys=[key2]"}))
+	defer SetOverrides(nil)
+	for _, name := range []string{"policy.disable_builtin_rules", "policy.rules", "trusted_keys"} {
+		f, _ := GetField(name)
+		assert.False(t, f.Overridable(), name)
+	}
+
+	os.Setenv(EnvName("policy.disable_builtin_rules"), "true")
+	os.Setenv(EnvName("trusted_keys"), "[key2]")
+	defer os.Unsetenv(EnvName("policy.disable_builtin_rules"))
+	defer os.Unsetenv(EnvName("trusted_keys"))
+	c, err := New(filename)
+	assert.Nil(t, err)
+	assert.Nil(t, c.applyOverrides())
+	e, _ := c.GetDefaultEntry()
+	assert.False(t, e.Policy.DisableBuiltinRules)
+	assert.Equal(t, []string{"key1"}, e.TrustedKeys)
+	origin, _ := c.Origin("trusted_keys")
+	assert.Equal(t, OriginFile, origin)
+}
+
+func TestConfig_ReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "pryrite.yaml")
+
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+	c, err := New(filename)
+	assert.Nil(t, err)
+	_, ok := c.GetDefaultEntry()
+	assert.True(t, ok)
+	assert.True(t, errors.Is(c.SaveFile(filename), ErrReadOnly))
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
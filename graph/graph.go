@@ -1,17 +1,24 @@
 package graph
 
 import (
+	"crypto/md5"
 	"fmt"
 	"strings"
 	"time"
 
 	executor "github.com/1xyz/pryrite/executors"
+	md "github.com/1xyz/pryrite/internal/markdown"
+	"github.com/1xyz/pryrite/tools"
 )
 
 type Metadata struct {
 	SourceTitle string `json:"source_title"`
 	SourceURI   string `json:"source_uri"`
 	Agent       string `json:"Agent"`
+	// SHA256 is the hex encoded hash of the source document's content
+	SHA256 string `json:"sha256,omitempty"`
+	// Revision is the git commit the source document was read at, if it was read from a repository
+	Revision string `json:"revision,omitempty"`
 }
 
 func NewMetadata(agent, version string) *Metadata {
@@ -148,3 +155,36 @@ func NewNodeFromBlocks(kind Kind, blocks []*Block, metadata Metadata) (*Node, er
 		Blocks:     blocks,
 	}, nil
 }
+
+// SplitBlocks splits the markdown into consecutive blocks of code and text, the ID of
+// the nth block is <nodeID>/<n>. The title is the first heading of the markdown.
+func SplitBlocks(nodeID, markdown string) (string, []*Block, error) {
+	now := time.Now().UTC()
+	blocks := make([]*Block, 0)
+	title, err := md.Split(markdown, func(chunk string, chunkType md.ChunkType, language string) error {
+		contentType, err := executor.Parse(language)
+		if err != nil {
+			return fmt.Errorf("executor.Parse language = %v %w", language, err)
+		}
+		b := &Block{
+			ID:          fmt.Sprintf("%s/%d", nodeID, len(blocks)+1),
+			CreatedAt:   &now,
+			Content:     chunk,
+			ContentType: contentType,
+			MD5:         fmt.Sprintf("%x", md5.Sum([]byte(chunk))),
+		}
+		blocks = append(blocks, b)
+		tools.Log.Info().
+			Str("BlockID", b.ID).
+			Str("Lang", language).
+			Str("IsCode", fmt.Sprintf("%v", b.IsCode())).
+			Str("ContentType", contentType.String()).
+			Str("MD5", b.MD5).
+			Msg("block created")
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("markdown.split err = %w", err)
+	}
+	return title, blocks, nil
+}
@@ -0,0 +1,346 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1xyz/pryrite/tools"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// how long to wait for another process holding the store
+	localStoreTimeout = 2 * time.Second
+)
+
+var (
+	nodesBucketKey = []byte("nodes")
+
+	ErrNodeNotFound = errors.New("node not found")
+)
+
+// localStore implements the Store interface in an embedded bbolt database, so that
+// nodes and the execution info of their blocks persist without a service. Nodes are
+// stored as JSON keyed by their ID, and the IDs of a node's children are kept in
+// its Children field.
+//
+// The database is opened for each operation, so that it is not held locked while
+// an inspector session is running. Reads open it read-only and see a store that
+// was never written to as empty, the database is only created by a write.
+type localStore struct {
+	path string
+}
+
+func NewLocalStore(path string) Store {
+	return &localStore{path: path}
+}
+
+func (l *localStore) ExtractID(input string) (string, error) {
+	idOrURL := strings.TrimSpace(input)
+	u, err := url.Parse(idOrURL)
+	if err != nil {
+		return "", err
+	}
+	tokens := strings.Split(u.Path, "/")
+	if len(tokens) == 0 || len(idOrURL) == 0 {
+		return "", fmt.Errorf("empty id")
+	}
+	return tokens[len(tokens)-1], nil
+}
+
+// GetNodes returns the most recent nodes of the kind, or of all kinds if the kind is Unknown
+func (l *localStore) GetNodes(limit int, kind Kind) ([]Node, error) {
+	nodes := []Node{}
+	if err := l.each(func(n *Node) {
+		if kind == Unknown || n.Kind == kind {
+			nodes = append(nodes, *n)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	sortByOccurredAt(nodes)
+	if limit > 0 && len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return nodes, nil
+}
+
+func (l *localStore) GetNode(id string) (*Node, error) {
+	var n *Node
+	err := l.view(func(b *bbolt.Bucket) error {
+		var err error
+		n, err = getNode(b, id)
+		return err
+	})
+	return n, err
+}
+
+// AddNode stores a new node with a generated ID. The node's blocks are split from
+// its markdown if it has none.
+func (l *localStore) AddNode(n *Node) (*Node, error) {
+	result := *n
+	result.ID = uuid.New().String()
+	now := time.Now().UTC()
+	result.CreatedAt = &now
+	if result.OccurredAt == nil {
+		result.OccurredAt = &now
+	}
+	if err := setBlocks(&result); err != nil {
+		return nil, err
+	}
+	if err := l.update(func(b *bbolt.Bucket) error {
+		return putNode(b, &result)
+	}); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SearchNodes returns the nodes containing every word of the query in their title or
+// markdown, most recent first
+func (l *localStore) SearchNodes(query string, limit int, kind Kind) ([]Node, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	nodes := []Node{}
+	if err := l.each(func(n *Node) {
+		if kind != Unknown && n.Kind != kind {
+			return
+		}
+		text := strings.ToLower(n.Title + "\n" + n.Markdown)
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				return
+			}
+		}
+		nodes = append(nodes, *n)
+	}); err != nil {
+		return nil, err
+	}
+	sortByOccurredAt(nodes)
+	if limit > 0 && len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return nodes, nil
+}
+
+// GetChildren returns the nodes listed in the parent's Children, children that no
+// longer exist are skipped
+func (l *localStore) GetChildren(parentID string) ([]Node, error) {
+	children := []Node{}
+	err := l.view(func(b *bbolt.Bucket) error {
+		parent, err := getNode(b, parentID)
+		if err != nil {
+			return err
+		}
+		for _, id := range parent.GetChildIDs() {
+			child, err := getNode(b, id)
+			if errors.Is(err, ErrNodeNotFound) {
+				tools.Log.Warn().Msgf("GetChildren: %s skipping missing child %s", parentID, id)
+				continue
+			} else if err != nil {
+				return err
+			}
+			children = append(children, *child)
+		}
+		return nil
+	})
+	return children, err
+}
+
+// UpdateNode updates the fields of the node that are set, e.g. the run only sets
+// LastExecutedAt. If the markdown is set without blocks the blocks are split from it.
+func (l *localStore) UpdateNode(n *Node) error {
+	return l.update(func(b *bbolt.Bucket) error {
+		node, err := getNode(b, n.ID)
+		if err != nil {
+			return err
+		}
+		if n.Markdown != "" || len(n.Blocks) > 0 {
+			node.Markdown, node.Blocks = n.Markdown, n.Blocks
+			if err := setBlocks(node); err != nil {
+				return err
+			}
+		}
+		if n.Title != "" {
+			node.Title = n.Title
+		}
+		if n.Kind != "" {
+			node.Kind = n.Kind
+		}
+		if n.Children != "" {
+			node.Children = n.Children
+		}
+		if n.OccurredAt != nil {
+			node.OccurredAt = n.OccurredAt
+		}
+		if n.LastExecutedAt != nil {
+			node.LastExecutedAt = n.LastExecutedAt
+		}
+		if n.LastExecutedBy != "" {
+			node.LastExecutedBy = n.LastExecutedBy
+		}
+		return putNode(b, node)
+	})
+}
+
+// UpdateNodeBlock replaces the content of the block and the node's markdown with it
+func (l *localStore) UpdateNodeBlock(n *Node, block *Block) error {
+	return l.updateBlock(n.ID, block.ID, func(node *Node, stored *Block) {
+		stored.Content = block.Content
+		stored.MD5 = block.MD5
+		sb := strings.Builder{}
+		for _, b := range node.Blocks {
+			sb.WriteString(b.Content)
+		}
+		node.Markdown = sb.String()
+	})
+}
+
+// UpdateNodeBlockExecution records the block's last execution on the block and its node
+func (l *localStore) UpdateNodeBlockExecution(n *Node, block *Block) error {
+	return l.updateBlock(n.ID, block.ID, func(node *Node, stored *Block) {
+		stored.LastExecutedAt = block.LastExecutedAt
+		stored.LastExecutedBy = block.LastExecutedBy
+		stored.LastExitStatus = block.LastExitStatus
+		stored.LastExecutionInfo = block.LastExecutionInfo
+		node.LastExecutedAt = block.LastExecutedAt
+		node.LastExecutedBy = block.LastExecutedBy
+	})
+}
+
+func (l *localStore) updateBlock(nodeID, blockID string, fn func(*Node, *Block)) error {
+	return l.update(func(b *bbolt.Bucket) error {
+		node, err := getNode(b, nodeID)
+		if err != nil {
+			return err
+		}
+		stored, found := node.GetBlock(blockID)
+		if !found {
+			return fmt.Errorf("block %s of node %s: %w", blockID, nodeID, ErrNodeNotFound)
+		}
+		fn(node, stored)
+		return putNode(b, node)
+	})
+}
+
+func (l *localStore) each(fn func(*Node)) error {
+	return l.view(func(b *bbolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			n := &Node{}
+			if err := json.Unmarshal(v, n); err != nil {
+				return fmt.Errorf("node %s: %w", k, err)
+			}
+			fn(n)
+			return nil
+		})
+	})
+}
+
+// view calls fn with the nodes bucket, which is nil if nothing was stored yet
+func (l *localStore) view(fn func(b *bbolt.Bucket) error) error {
+	exists, err := tools.StatExists(l.path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fn(nil)
+	}
+	return l.open(true, func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			return fn(tx.Bucket(nodesBucketKey))
+		})
+	})
+}
+
+func (l *localStore) update(fn func(b *bbolt.Bucket) error) error {
+	if err := tools.EnsureDir(filepath.Dir(l.path)); err != nil {
+		return err
+	}
+	return l.open(false, func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(nodesBucketKey)
+			if err != nil {
+				return err
+			}
+			return fn(b)
+		})
+	})
+}
+
+func (l *localStore) open(readOnly bool, fn func(db *bbolt.DB) error) error {
+	db, err := bbolt.Open(l.path, 0600, &bbolt.Options{Timeout: localStoreTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return fmt.Errorf("open %s err = %w", l.path, err)
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+func getNode(b *bbolt.Bucket, id string) (*Node, error) {
+	var v []byte
+	if b != nil {
+		v = b.Get([]byte(id))
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%s: %w", id, ErrNodeNotFound)
+	}
+	n := &Node{}
+	if err := json.Unmarshal(v, n); err != nil {
+		return nil, fmt.Errorf("node %s: %w", id, err)
+	}
+	return n, nil
+}
+
+func putNode(b *bbolt.Bucket, n *Node) error {
+	v, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(n.ID), v)
+}
+
+// setBlocks splits the node's markdown into blocks if it has none, or builds its
+// markdown from the blocks if it has no markdown
+func setBlocks(n *Node) error {
+	if len(n.Blocks) > 0 {
+		if n.Markdown == "" {
+			sb := strings.Builder{}
+			for _, b := range n.Blocks {
+				sb.WriteString(b.Content)
+			}
+			n.Markdown = sb.String()
+		}
+		return nil
+	}
+	title, blocks, err := SplitBlocks(n.ID, n.Markdown)
+	if err != nil {
+		return err
+	}
+	n.Blocks = blocks
+	if n.Title == "" {
+		n.Title = title
+	}
+	return nil
+}
+
+func sortByOccurredAt(nodes []Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		ti, tj := nodes[i].OccurredAt, nodes[j].OccurredAt
+		if ti == nil || tj == nil {
+			return tj == nil && ti != nil
+		}
+		return ti.After(*tj)
+	})
+}
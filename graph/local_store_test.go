@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLocalStore(t *testing.T) (Store, func()) {
+	dir, err := ioutil.TempDir("", "local_store")
+	if err != nil {
+		t.FailNow()
+	}
+	return NewLocalStore(filepath.Join(dir, "store.db")), func() { os.RemoveAll(dir) }
+}
+
+func TestLocalStore_AddNode(t *testing.T) {
+	store, cleanup := newTestLocalStore(t)
+	defer cleanup()
+
+	n, err := NewNode(Command, "disk usage", "du -sh .", "text/shell", Metadata{Agent: "test"})
+	assert.Nil(t, err)
+	added, err := store.AddNode(n)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.NotEmpty(t, added.ID)
+	assert.NotNil(t, added.CreatedAt)
+
+	got, err := store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "disk usage", got.Title)
+	assert.Equal(t, Command, got.Kind)
+	assert.Equal(t, "test", got.Metadata.Agent)
+	if assert.Len(t, got.Blocks, 3) {
+		assert.Equal(t, added.ID+"/2", got.Blocks[1].ID)
+		assert.True(t, got.Blocks[1].IsCode())
+		assert.Equal(t, "du -sh .\n", got.Blocks[1].Content)
+	}
+
+	_, err = store.GetNode("unknown")
+	assert.True(t, errors.Is(err, ErrNodeNotFound))
+}
+
+func TestLocalStore_GetNodes_SearchNodes(t *testing.T) {
+	store, cleanup := newTestLocalStore(t)
+	defer cleanup()
+
+	ids := []string{}
+	for i, s := range []struct {
+		kind    Kind
+		title   string
+		content string
+	}{
+		{Command, "disk usage", "du -sh ."},
+		{Command, "free memory", "free -m"},
+		{Text, "notes", "check the disk before a deploy"},
+	} {
+		n, err := NewNode(s.kind, s.title, s.content, "text/shell", Metadata{})
+		assert.Nil(t, err)
+		occurredAt := time.Now().Add(time.Duration(i) * time.Minute)
+		n.OccurredAt = &occurredAt
+		added, err := store.AddNode(n)
+		assert.Nil(t, err)
+		ids = append(ids, added.ID)
+	}
+
+	nodes, err := store.GetNodes(0, Unknown)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ids[2], ids[1], ids[0]}, nodeIDs(nodes))
+	nodes, err = store.GetNodes(1, Command)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ids[1]}, nodeIDs(nodes))
+
+	nodes, err = store.SearchNodes("DISK", 0, Unknown)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ids[2], ids[0]}, nodeIDs(nodes))
+	nodes, err = store.SearchNodes("disk du", 0, Command)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ids[0]}, nodeIDs(nodes))
+}
+
+func TestLocalStore_Update(t *testing.T) {
+	store, cleanup := newTestLocalStore(t)
+	defer cleanup()
+
+	n, err := NewNode(Command, "greet", "echo hello", "text/shell", Metadata{})
+	assert.Nil(t, err)
+	added, err := store.AddNode(n)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	child, err := store.AddNode(n)
+	assert.Nil(t, err)
+
+	// only the fields that are set are updated
+	executedAt := time.Now().UTC()
+	assert.Nil(t, store.UpdateNode(&Node{ID: added.ID, LastExecutedAt: &executedAt, Children: child.ID + ",gone"}))
+	got, err := store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "greet", got.Title)
+	assert.Len(t, got.Blocks, 3)
+	assert.True(t, executedAt.Equal(*got.LastExecutedAt))
+
+	children, err := store.GetChildren(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{child.ID}, nodeIDs(children))
+
+	b := got.Blocks[1]
+	b.Content = "echo goodbye\n"
+	b.LastExitStatus = "1"
+	assert.Nil(t, store.UpdateNodeBlock(got, b))
+	assert.Nil(t, store.UpdateNodeBlockExecution(got, b))
+	got, err = store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "# greet\n```shell\necho goodbye\n```\n", got.Markdown)
+	assert.Equal(t, "1", got.Blocks[1].LastExitStatus)
+
+	err = store.UpdateNodeBlockExecution(got, &Block{ID: "unknown"})
+	assert.True(t, errors.Is(err, ErrNodeNotFound))
+}
+
+func nodeIDs(nodes []Node) []string {
+	ids := []string{}
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestLocalStore_ReadEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local_store")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "store.db")
+	store := NewLocalStore(path)
+
+	// reads do not create the store
+	nodes, err := store.GetNodes(10, Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 0)
+	nodes, err = store.SearchNodes("disk", 10, Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 0)
+	_, err = store.GetNode("unknown")
+	assert.True(t, errors.Is(err, ErrNodeNotFound))
+	_, err = os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+
+	n, err := NewNode(Command, "disk usage", "du -sh .", "text/shell", Metadata{})
+	assert.Nil(t, err)
+	added, err := store.AddNode(n)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	// a read-only store can be read
+	assert.Nil(t, os.Chmod(path, 0400))
+	got, err := store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "disk usage", got.Title)
+}
@@ -0,0 +1,250 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/muesli/termenv"
+)
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+// maxDiffCells bounds the memory used to compute a line diff, larger inputs
+// are shown as all the old lines deleted and all the new lines inserted
+const maxDiffCells = 4 * 1024 * 1024
+
+var (
+	ErrDiffDifferentBlocks = errors.New("the entries belong to different blocks")
+	ErrTooFewExecutions    = errors.New("fewer than two executions found")
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// DiffLines returns a line diff of a and b using the longest common subsequence
+func DiffLines(a, b string) []DiffLine {
+	as, bs := splitLines(a), splitLines(b)
+	n, m := len(as), len(bs)
+
+	if (n+1)*(m+1) > maxDiffCells {
+		lines := make([]DiffLine, 0, n+m)
+		for _, l := range as {
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: l})
+		}
+		for _, l := range bs {
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: l})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case as[i] == bs[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: as[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, DiffLine{Op: DiffDelete, Text: as[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, DiffLine{Op: DiffInsert, Text: bs[j]})
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func hasChanges(lines []DiffLine) bool {
+	for _, l := range lines {
+		if l.Op != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// EntryDiff compares two executions of the same block
+type EntryDiff struct {
+	Old *ResultLogEntry
+	New *ResultLogEntry
+
+	Content []DiffLine
+	Stdout  []DiffLine
+	Stderr  []DiffLine
+}
+
+func DiffEntries(old, new *ResultLogEntry) (*EntryDiff, error) {
+	if old.NodeID != new.NodeID || old.BlockID != new.BlockID {
+		return nil, fmt.Errorf("%s (%s) and %s (%s): %w", old.ID, old.BlockID, new.ID, new.BlockID, ErrDiffDifferentBlocks)
+	}
+	return &EntryDiff{
+		Old:     old,
+		New:     new,
+		Content: DiffLines(old.Content, new.Content),
+		Stdout:  DiffLines(old.Stdout, new.Stdout),
+		Stderr:  DiffLines(old.Stderr, new.Stderr),
+	}, nil
+}
+
+// HasChanges returns true if the executions differ in content, exit status, state, error or output
+func (d *EntryDiff) HasChanges() bool {
+	return d.Old.ExitStatus != d.New.ExitStatus || d.Old.State != d.New.State || d.Old.Err != d.New.Err ||
+		hasChanges(d.Content) || hasChanges(d.Stdout) || hasChanges(d.Stderr)
+}
+
+// Write renders the diff, if color is set deleted lines are red and inserted lines are green
+func (d *EntryDiff) Write(w io.Writer, color bool) {
+	cp := termenv.Ascii
+	if color {
+		cp = termenv.ColorProfile()
+	}
+
+	fmt.Fprintf(w, "block %s\n", d.New.BlockID)
+	fmt.Fprintln(w, termenv.String("--- "+entryHeader(d.Old)).Foreground(cp.Color("1")))
+	fmt.Fprintln(w, termenv.String("+++ "+entryHeader(d.New)).Foreground(cp.Color("2")))
+	if d.Old.ExitStatus != d.New.ExitStatus {
+		fmt.Fprintf(w, "exit status: %s -> %s\n", orNone(d.Old.ExitStatus), orNone(d.New.ExitStatus))
+	}
+	if d.Old.State != d.New.State {
+		fmt.Fprintf(w, "state: %s -> %s\n", d.Old.State, d.New.State)
+	}
+	if d.Old.Err != d.New.Err {
+		fmt.Fprintf(w, "error: %s -> %s\n", orNone(d.Old.Err), orNone(d.New.Err))
+	}
+
+	for _, section := range []struct {
+		name  string
+		lines []DiffLine
+	}{
+		{"content", d.Content},
+		{"stdout", d.Stdout},
+		{"stderr", d.Stderr},
+	} {
+		if !hasChanges(section.lines) {
+			continue
+		}
+		fmt.Fprintf(w, "@@ %s @@\n", section.name)
+		for _, l := range section.lines {
+			switch l.Op {
+			case DiffDelete:
+				fmt.Fprintln(w, termenv.String("-"+l.Text).Foreground(cp.Color("1")))
+			case DiffInsert:
+				fmt.Fprintln(w, termenv.String("+"+l.Text).Foreground(cp.Color("2")))
+			default:
+				fmt.Fprintln(w, " "+l.Text)
+			}
+		}
+	}
+
+	if !d.HasChanges() {
+		fmt.Fprintln(w, "no differences")
+	}
+}
+
+// DiffExecutions compares the two executions with the IDs, or the last two executions
+// of the block if no IDs are given
+func DiffExecutions(rl ResultLog, blockID string, ids ...string) (*EntryDiff, error) {
+	var old, new *ResultLogEntry
+	var err error
+	switch len(ids) {
+	case 0:
+		old, new, err = LastTwoExecutions(rl, blockID)
+	case 2:
+		if old, err = rl.Find(ids[0]); err != nil {
+			return nil, fmt.Errorf("%s: %w", ids[0], err)
+		}
+		if new, err = rl.Find(ids[1]); err != nil {
+			return nil, fmt.Errorf("%s: %w", ids[1], err)
+		}
+	default:
+		return nil, fmt.Errorf("expected none or two log IDs, got %d", len(ids))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DiffEntries(old, new)
+}
+
+// LastTwoExecutions returns the two most recent completed or failed executions of the block,
+// the older one first. If blockID is empty, the block of the most recent execution is used.
+func LastTwoExecutions(rl ResultLog, blockID string) (*ResultLogEntry, *ResultLogEntry, error) {
+	entries := []*ResultLogEntry{}
+	if err := rl.Each(func(_ int, entry *ResultLogEntry) bool {
+		if !entry.State.In(ExecStateCompleted, ExecStateFailed) {
+			return true
+		}
+		if blockID == "" {
+			blockID = entry.BlockID
+		}
+		if entry.BlockID == blockID {
+			entries = append(entries, entry)
+		}
+		return len(entries) < 2
+	}); err != nil {
+		return nil, nil, err
+	}
+	if len(entries) < 2 {
+		return nil, nil, ErrTooFewExecutions
+	}
+	return entries[1], entries[0], nil
+}
+
+func entryHeader(e *ResultLogEntry) string {
+	executedAt := "unknown"
+	if e.ExecutedAt != nil {
+		executedAt = e.ExecutedAt.Local().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s %s %s exit-status: %s", e.ID, executedAt, e.State, orNone(e.ExitStatus))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
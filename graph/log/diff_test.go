@@ -0,0 +1,104 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	lines := DiffLines("a\nb\nc\n", "a\nc\nd\n")
+	assert.Equal(t, []DiffLine{
+		{DiffEqual, "a"},
+		{DiffDelete, "b"},
+		{DiffEqual, "c"},
+		{DiffInsert, "d"},
+	}, lines)
+
+	assert.Empty(t, DiffLines("", ""))
+	assert.Equal(t, []DiffLine{{DiffEqual, "x"}}, DiffLines("x\r\n", "x\n"))
+	assert.Equal(t, []DiffLine{{DiffInsert, "x"}}, DiffLines("", "x"))
+}
+
+func TestDiffEntries(t *testing.T) {
+	old := newTestLogEntry()
+	old.Stdout = "hello\nworld\n"
+	old.ExitStatus = "0"
+	new := newTestLogEntry()
+	new.ID = "log2"
+	new.Stdout = "hello\nthere\n"
+	new.ExitStatus = "1"
+
+	d, err := DiffEntries(old, new)
+	assert.Nil(t, err)
+	assert.True(t, d.HasChanges())
+
+	b := &bytes.Buffer{}
+	d.Write(b, false)
+	assert.Contains(t, b.String(), "exit status: 0 -> 1\n")
+	assert.Contains(t, b.String(), "@@ stdout @@\n hello\n-world\n+there\n")
+	assert.NotContains(t, b.String(), "@@ content @@")
+
+	d, err = DiffEntries(old, old)
+	assert.Nil(t, err)
+	assert.False(t, d.HasChanges())
+
+	new.BlockID = "block2"
+	_, err = DiffEntries(old, new)
+	assert.ErrorIs(t, err, ErrDiffDifferentBlocks)
+}
+
+func TestDiffExecutions(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	entry := newTestLogEntry()
+	entry.ID = "a"
+	entry.State = ExecStateCompleted
+	if err := index.Append(entry); err != nil {
+		t.FailNow()
+	}
+	rl, err := index.Get(entry.NodeID)
+	if err != nil {
+		t.FailNow()
+	}
+	_, err = DiffExecutions(rl, "block1")
+	assert.ErrorIs(t, err, ErrTooFewExecutions)
+
+	for _, e := range []struct {
+		id      string
+		blockID string
+		state   ExecState
+	}{
+		{"b", "block1", ExecStateStarted},
+		{"c", "block1", ExecStateFailed},
+		{"d", "block2", ExecStateCompleted},
+	} {
+		entry := newTestLogEntry()
+		entry.ID, entry.BlockID, entry.State = e.id, e.blockID, e.state
+		if err := index.Append(entry); err != nil {
+			t.FailNow()
+		}
+	}
+
+	d, err := DiffExecutions(rl, "block1")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", d.Old.ID)
+	assert.Equal(t, "c", d.New.ID)
+
+	// the most recent execution is of block2
+	_, err = DiffExecutions(rl, "")
+	assert.ErrorIs(t, err, ErrTooFewExecutions)
+
+	d, err = DiffExecutions(rl, "", "c", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", d.Old.ID)
+
+	_, err = DiffExecutions(rl, "", "a", "d")
+	assert.ErrorIs(t, err, ErrDiffDifferentBlocks)
+	_, err = DiffExecutions(rl, "", "a", "missing")
+	assert.ErrorIs(t, err, ErrResultLogEntryNotFound)
+	_, err = DiffExecutions(rl, "", "a")
+	assert.NotNil(t, err)
+}
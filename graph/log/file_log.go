@@ -9,11 +9,40 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/1xyz/pryrite/tools"
 	"github.com/pkg/errors"
 )
 
+// nodeLog is the result log of a node stored on the file system
+type nodeLog interface {
+	ResultLog
+
+	// records returns the entries, newest first, with the bytes they use
+	records() ([]*logRecord, error)
+}
+
+// logRecord is an entry of a nodeLog
+type logRecord struct {
+	entry *ResultLogEntry
+	// size is the bytes used by the entry
+	size int64
+	// at is when the entry was written
+	at time.Time
+}
+
+// LogFormat is how the result log of a node is stored on the file system
+type LogFormat string
+
+const (
+	// LogFormatFiles stores each entry in a log_<id>.json file
+	LogFormatFiles LogFormat = "files"
+	// LogFormatJournal appends the entries to a checksummed log.jsonl file
+	LogFormatJournal LogFormat = "journal"
+)
+
 // log on the file system
 type fsLog struct {
 	dir string
@@ -88,6 +117,46 @@ func (l *fsLog) Find(id string) (*ResultLogEntry, error) {
 	return nil, ErrResultLogEntryNotFound
 }
 
+func (l *fsLog) Remove(ids ...string) error {
+	if err := l.removeEntryFiles(ids); err != nil {
+		return err
+	}
+	return removeCasts(l.dir, ids)
+}
+
+// removeEntryFiles removes the files of the entries and keeps their recordings,
+// e.g. once the entries are moved to the journal
+func (l *fsLog) removeEntryFiles(ids []string) error {
+	for _, id := range ids {
+		err := os.Remove(filepath.Join(l.dir, getfilename(id)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// records skips the entries that cannot be read
+func (l *fsLog) records() ([]*logRecord, error) {
+	files, err := l.getLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	records := make([]*logRecord, 0, len(files))
+	for _, f := range files {
+		entry, err := l.decode(f.Name())
+		if err != nil {
+			tools.Log.Warn().Err(err).Msgf("fsLog: skipping %s", f.Name())
+			continue
+		}
+		records = append(records, &logRecord{entry: entry, size: f.Size(), at: f.ModTime()})
+	}
+	return records, nil
+}
+
 func (l *fsLog) decode(filename string) (*ResultLogEntry, error) {
 	fileWithPath := filepath.Join(l.dir, filename)
 	fr, err := tools.OpenFile(fileWithPath, os.O_RDONLY)
@@ -118,48 +187,133 @@ func (l *fsLog) getLogFiles() ([]fs.FileInfo, error) {
 		logfiles = append(logfiles, files[i])
 	}
 
-	return files, nil
+	return logfiles, nil
+}
+
+// removeCasts removes the recordings of the entries with the IDs
+func removeCasts(dir string, ids []string) error {
+	for _, id := range ids {
+		err := os.Remove(filepath.Join(dir, CastFileName(id)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// castSize returns the size of the entry's recording
+func castSize(dir string, entry *ResultLogEntry) int64 {
+	if entry.CastFile == "" {
+		return 0
+	}
+	info, err := os.Stat(filepath.Join(dir, entry.CastFile))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
 }
 
 func getfilename(logID string) string {
 	return fmt.Sprintf("log_%s.json", logID)
 }
 
+// logIDOf returns the log ID of a log file name
+func logIDOf(filename string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filename, "log_"), ".json")
+}
+
+// fsLogIndex keeps the result log of each node in a directory. A node's result
+// log stays in the format it was created in, the format of the index applies to
+// the result logs of new nodes.
 type fsLogIndex struct {
-	dir string
+	dir    string
+	format LogFormat
+
+	lock     sync.Mutex
+	journals map[string]*journalLog
 }
 
-func newFSLogIndex(logDir string) (*fsLogIndex, error) {
+func newFSLogIndex(logDir string, format LogFormat) (*fsLogIndex, error) {
 	if err := tools.EnsureDir(logDir); err != nil {
 		return nil, err
 	}
 	return &fsLogIndex{
-		dir: logDir,
+		dir:      logDir,
+		format:   format,
+		journals: map[string]*journalLog{},
 	}, nil
 }
 
 func (i *fsLogIndex) Append(entry *ResultLogEntry) error {
-	fsLog, err := i.getOrCreateLog(entry.NodeID)
+	nodeLog, err := i.getOrCreateLog(entry.NodeID)
 	if err != nil {
 		return err
 	}
-	return fsLog.Append(entry)
+	return nodeLog.Append(entry)
 }
 
 func (i *fsLogIndex) Get(nodeID string) (ResultLog, error) {
-	dir := filepath.Join(i.dir, nodeID)
+	dir := i.dirOf(nodeID)
 	if exists, err := tools.StatExists(dir); err != nil {
 		return nil, err
 	} else if !exists {
 		return nil, ErrResultLogNotFound
 	}
-	return &fsLog{dir: dir}, nil
+	return i.logOf(nodeID)
 }
 
-func (i *fsLogIndex) getOrCreateLog(nodeID string) (*fsLog, error) {
-	dir := filepath.Join(i.dir, nodeID)
-	if err := tools.EnsureDir(dir); err != nil {
+// nodeIDs returns the IDs of the nodes that have a result log
+func (i *fsLogIndex) nodeIDs() ([]string, error) {
+	files, err := ioutil.ReadDir(i.dir)
+	if err != nil {
 		return nil, err
 	}
-	return &fsLog{dir: dir}, nil
+	ids := []string{}
+	for _, f := range files {
+		if f.IsDir() {
+			ids = append(ids, f.Name())
+		}
+	}
+	return ids, nil
+}
+
+func (i *fsLogIndex) dirOf(nodeID string) string {
+	return filepath.Join(i.dir, nodeID)
+}
+
+func (i *fsLogIndex) getOrCreateLog(nodeID string) (nodeLog, error) {
+	if err := tools.EnsureDir(i.dirOf(nodeID)); err != nil {
+		return nil, err
+	}
+	return i.logOf(nodeID)
+}
+
+// logOf returns the node's journal if it has one, or if it has no entries
+// yet and the index creates journals
+func (i *fsLogIndex) logOf(nodeID string) (nodeLog, error) {
+	dir := i.dirOf(nodeID)
+	isJournal, err := tools.StatExists(filepath.Join(dir, journalFile))
+	if err != nil {
+		return nil, err
+	}
+	if !isJournal && i.format == LogFormatJournal {
+		files, err := (&fsLog{dir: dir}).getLogFiles()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		isJournal = len(files) == 0
+	}
+	if !isJournal {
+		return &fsLog{dir: dir}, nil
+	}
+
+	// the journal is shared, it keeps track of the sequence number
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if j, ok := i.journals[nodeID]; ok {
+		return j, nil
+	}
+	j := newJournalLog(dir)
+	i.journals[nodeID] = j
+	return j, nil
 }
@@ -152,7 +152,7 @@ func newFsIndex(t *testing.T) *fsLogIndex {
 	}
 	t.Logf("newfsIndex: dir = %s", dir)
 
-	logIndex, err := newFSLogIndex(dir)
+	logIndex, err := newFSLogIndex(dir, LogFormatFiles)
 	if err != nil {
 		assert.Failf(t, "NewResultLogIndex", "unexpected err is not nil %v", err)
 	}
@@ -45,6 +45,23 @@ func (l *inMemLog) EachFromEnd(cb func(int, *ResultLogEntry) bool) {
 	}
 }
 
+func (l *inMemLog) Remove(ids ...string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	removed := map[string]bool{}
+	for _, id := range ids {
+		removed[id] = true
+	}
+	list := l.list[:0]
+	for _, entry := range l.list {
+		if !removed[entry.ID] {
+			list = append(list, entry)
+		}
+	}
+	l.list = list
+	return nil
+}
+
 // Find scans the slice of BlockExecutionResults by ID
 func (l *inMemLog) Find(id string) (*ResultLogEntry, error) {
 	var found *ResultLogEntry
@@ -0,0 +1,421 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/1xyz/pryrite/tools"
+)
+
+const (
+	journalFile = "log.jsonl"
+	// journalLockFile is locked while the journal is written, the journal
+	// itself cannot be locked as a rewrite replaces it
+	journalLockFile = journalFile + ".lock"
+)
+
+var errJournalChecksum = errors.New("checksum mismatch")
+
+// journalRecord is a line of the journal. The checksum is the CRC32 (IEEE) of the entry's JSON.
+type journalRecord struct {
+	Seq   uint64          `json:"seq"`
+	CRC   uint32          `json:"crc"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// journalLog is a result log stored as an append-only file of JSON lines. Each
+// record is checksummed and synced to disk before Append returns. A record that
+// was only partially written, e.g. on a crash, is skipped when the log is read.
+//
+// Entries are ordered by the sequence number of their record. If an entry with
+// the same ID is appended again, the newer record replaces the older one.
+//
+// Appends and rewrites hold an exclusive lock on a file next to the journal,
+// so that other processes, e.g. another run, serve or GC, do not lose records.
+type journalLog struct {
+	path string
+
+	lock sync.Mutex
+	// seq of the last record, valid while the file has the size
+	seq  uint64
+	size int64
+}
+
+func newJournalLog(dir string) *journalLog {
+	return &journalLog{path: filepath.Join(dir, journalFile), size: -1}
+}
+
+func (l *journalLog) Len() (int, error) {
+	records, err := l.records()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// acquire locks the journal within the process and across processes, the
+// returned func releases it
+func (l *journalLog) acquire() (func(), error) {
+	l.lock.Lock()
+	f, err := tools.OpenFile(filepath.Join(filepath.Dir(l.path), journalLockFile), os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		l.lock.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		tools.CloseFile(f)
+		l.lock.Unlock()
+		return nil, fmt.Errorf("lock %s err = %w", f.Name(), err)
+	}
+	return func() {
+		if err := unlockFile(f); err != nil {
+			tools.Log.Warn().Err(err).Msgf("journalLog: unlock %s", f.Name())
+		}
+		tools.CloseFile(f)
+		l.lock.Unlock()
+	}, nil
+}
+
+func (l *journalLog) Append(entry *ResultLogEntry) error {
+	release, err := l.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	f, err := tools.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer tools.CloseFile(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	// the file was changed by someone else, e.g. another session or GC
+	if size != l.size {
+		if _, l.seq, err = l.scan(); err != nil {
+			return err
+		}
+	}
+
+	line, err := encodeRecord(l.seq+1, entry)
+	if err != nil {
+		return err
+	}
+	// terminate a partially written record so that it does not swallow this one
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	// the journal was created, make its directory entry durable too
+	if size == 0 {
+		if err := syncDir(filepath.Dir(l.path)); err != nil {
+			return err
+		}
+	}
+	l.seq++
+	l.size = size + int64(len(line))
+	return nil
+}
+
+func (l *journalLog) Each(cb func(int, *ResultLogEntry) bool) error {
+	records, err := l.records()
+	if err != nil {
+		return err
+	}
+	for i, r := range records {
+		if !cb(i, r.entry) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *journalLog) Find(id string) (*ResultLogEntry, error) {
+	records, err := l.records()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.entry.ID == id {
+			return r.entry, nil
+		}
+	}
+	return nil, ErrResultLogEntryNotFound
+}
+
+// Remove rewrites the journal without the entries, the records that are
+// replaced or corrupted are dropped as well
+func (l *journalLog) Remove(ids ...string) error {
+	release, err := l.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	records, _, err := l.scan()
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, id := range ids {
+		removed[id] = true
+	}
+
+	// oldest first
+	entries := []*ResultLogEntry{}
+	for i := len(records) - 1; i >= 0; i-- {
+		if !removed[records[i].entry.ID] {
+			entries = append(entries, records[i].entry)
+		}
+	}
+	l.size = -1
+	if err := writeJournal(l.path, entries); err != nil {
+		return err
+	}
+	return removeCasts(filepath.Dir(l.path), ids)
+}
+
+// records returns the latest record of each entry, newest first
+func (l *journalLog) records() ([]*logRecord, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	records, _, err := l.scan()
+	return records, err
+}
+
+// scan reads the journal and returns the latest record of each entry newest
+// first along with the highest sequence number found
+func (l *journalLog) scan() ([]*logRecord, uint64, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		l.seq, l.size = 0, 0
+		return []*logRecord{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer tools.CloseFile(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type seqRecord struct {
+		seq uint64
+		*logRecord
+	}
+	latest := map[string]*seqRecord{}
+	var maxSeq uint64
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			rec, entry, derr := decodeRecord(line)
+			if derr != nil {
+				tools.Log.Warn().Err(derr).Msgf("journalLog: skipping record %s:%d", l.path, lineNo)
+			} else {
+				if rec.Seq > maxSeq {
+					maxSeq = rec.Seq
+				}
+				if prev, ok := latest[entry.ID]; !ok || rec.Seq > prev.seq {
+					at := info.ModTime()
+					if entry.ExecutedAt != nil {
+						at = *entry.ExecutedAt
+					}
+					latest[entry.ID] = &seqRecord{
+						seq:       rec.Seq,
+						logRecord: &logRecord{entry: entry, size: int64(len(line)), at: at},
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("read %s err = %w", l.path, err)
+		}
+	}
+
+	sorted := make([]*seqRecord, 0, len(latest))
+	for _, sr := range latest {
+		sorted = append(sorted, sr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].seq > sorted[j].seq
+	})
+	records := make([]*logRecord, len(sorted))
+	for i, sr := range sorted {
+		records[i] = sr.logRecord
+	}
+
+	l.seq, l.size = maxSeq, info.Size()
+	return records, maxSeq, nil
+}
+
+func encodeRecord(seq uint64, entry *ResultLogEntry) ([]byte, error) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(&journalRecord{Seq: seq, CRC: crc32.ChecksumIEEE(b), Entry: b})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeRecord(line []byte) (*journalRecord, *ResultLogEntry, error) {
+	var rec journalRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, nil, err
+	}
+	if crc32.ChecksumIEEE(rec.Entry) != rec.CRC {
+		return nil, nil, errJournalChecksum
+	}
+	var entry ResultLogEntry
+	if err := json.Unmarshal(rec.Entry, &entry); err != nil {
+		return nil, nil, err
+	}
+	return &rec, &entry, nil
+}
+
+// writeJournal atomically replaces the journal at path with the entries, oldest
+// first. The caller holds the lock of the journal.
+func writeJournal(path string, entries []*ResultLogEntry) error {
+	tmp := path + ".tmp"
+	f, err := tools.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for i, entry := range entries {
+		line, err := encodeRecord(uint64(i+1), entry)
+		if err != nil {
+			tools.CloseFile(f)
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			tools.CloseFile(f)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tools.CloseFile(f)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		tools.CloseFile(f)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// MigrateStats counts the entries moved to journals by Migrate
+type MigrateStats struct {
+	Nodes   int
+	Entries int
+}
+
+func (s *MigrateStats) String() string {
+	return fmt.Sprintf("migrated %d entries of %d result logs", s.Entries, s.Nodes)
+}
+
+// Migrate moves the entries of the result logs stored one file per entry in the
+// directory to journals, for the nodes specified or all the nodes if none are.
+// Entries already in a node's journal are kept after the migrated entries.
+func Migrate(dir string, nodeIDs ...string) (*MigrateStats, error) {
+	index, err := newFSLogIndex(dir, LogFormatJournal)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeIDs) == 0 {
+		if nodeIDs, err = index.nodeIDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &MigrateStats{}
+	for _, nodeID := range nodeIDs {
+		n, err := migrateNode(index.dirOf(nodeID))
+		if err != nil {
+			return stats, fmt.Errorf("node %s: %w", nodeID, err)
+		}
+		if n > 0 {
+			stats.Nodes++
+			stats.Entries += n
+		}
+	}
+	return stats, nil
+}
+
+func migrateNode(dir string) (int, error) {
+	files := &fsLog{dir: dir}
+	if exists, err := tools.StatExists(dir); err != nil || !exists {
+		return 0, err
+	}
+	legacy, err := files.records()
+	if err != nil {
+		return 0, err
+	}
+	if len(legacy) == 0 {
+		return 0, nil
+	}
+
+	journal := newJournalLog(dir)
+	release, err := journal.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	existing, _, err := journal.scan()
+	if err != nil {
+		return 0, err
+	}
+
+	// oldest first
+	entries := make([]*ResultLogEntry, 0, len(legacy)+len(existing))
+	ids := make([]string, 0, len(legacy))
+	for i := len(legacy) - 1; i >= 0; i-- {
+		entries = append(entries, legacy[i].entry)
+		ids = append(ids, legacy[i].entry.ID)
+	}
+	for i := len(existing) - 1; i >= 0; i-- {
+		entries = append(entries, existing[i].entry)
+	}
+	if err := writeJournal(journal.path, entries); err != nil {
+		return 0, err
+	}
+	// if this fails, migrating again replaces the entries that were already moved
+	// the recordings stay, the journal entries point at them
+	return len(ids), files.removeEntryFiles(ids)
+}
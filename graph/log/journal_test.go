@@ -0,0 +1,168 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1xyz/pryrite/asciicast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalLog(t *testing.T) {
+	index := newJournalIndex(t)
+	defer removeDir(t, index)
+
+	entries := appendNTestLogEntries(t, 3, index)
+	rl, err := index.Get("node1")
+	if err != nil {
+		t.FailNow()
+	}
+	_, isJournal := rl.(*journalLog)
+	assert.True(t, isJournal)
+
+	n, err := rl.Len()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	// appending an entry again replaces it and makes it the newest
+	entries[0].State = ExecStateCompleted
+	assert.Nil(t, index.Append(entries[0]))
+	assert.Equal(t, []string{"log-0", "log-2", "log-1"}, logIDs(t, index))
+
+	entry, err := rl.Find("log-0")
+	assert.Nil(t, err)
+	assert.Equal(t, ExecStateCompleted, entry.State)
+	_, err = rl.Find("hello")
+	assert.Equal(t, ErrResultLogEntryNotFound, err)
+
+	assert.Nil(t, rl.Remove("log-2", "hello"))
+	assert.Equal(t, []string{"log-0", "log-1"}, logIDs(t, index))
+}
+
+func TestJournalLog_Concurrent(t *testing.T) {
+	index := newJournalIndex(t)
+	defer removeDir(t, index)
+	appendNTestLogEntries(t, 1, index)
+
+	// two logs of the same journal, as if opened by two processes
+	dir := index.dirOf("node1")
+	appender, rewriter := newJournalLog(dir), newJournalLog(dir)
+	const n = 50
+	done := make(chan error)
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := rewriter.Remove("none"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < n; i++ {
+		assert.Nil(t, appender.Append(&ResultLogEntry{ID: fmt.Sprintf("c-%d", i), NodeID: "node1"}))
+	}
+	assert.Nil(t, <-done)
+
+	count, err := newJournalLog(dir).Len()
+	assert.Nil(t, err)
+	assert.Equal(t, n+1, count)
+}
+
+func TestJournalLog_Corrupted(t *testing.T) {
+	index := newJournalIndex(t)
+	defer removeDir(t, index)
+
+	appendNTestLogEntries(t, 2, index)
+	path := filepath.Join(index.dirOf("node1"), journalFile)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.FailNow()
+	}
+	// flip a byte of the first record and leave a partial record at the end
+	b[len(b)/4] ^= 1
+	b = append(b, []byte(`{"seq":3,"crc":`)...)
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"log-1"}, logIDs(t, index))
+
+	entry := newTestLogEntry()
+	entry.ID = "log-3"
+	assert.Nil(t, index.Append(entry))
+	assert.Equal(t, []string{"log-3", "log-1"}, logIDs(t, index))
+}
+
+func TestMigrate(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	appendNTestLogEntries(t, 3, index)
+	before := logIDs(t, index)
+
+	stats, err := Migrate(index.dir)
+	assert.Nil(t, err)
+	assert.Equal(t, &MigrateStats{Nodes: 1, Entries: 3}, stats)
+	// the files format index reads the migrated journal
+	assert.Equal(t, before, logIDs(t, index))
+	files, err := (&fsLog{dir: index.dirOf("node1")}).getLogFiles()
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	stats, err = Migrate(index.dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestMigrate_KeepsCasts(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	entry := newTestLogEntry()
+	entry.CastFile = CastFileName(entry.ID)
+	cast := &asciicast.Cast{
+		Header: &asciicast.Header{Version: asciicast.Version, Width: 80, Height: 24},
+		Events: []*asciicast.Event{{Time: 0.01, Type: asciicast.EventOutput, Data: "hello\n"}},
+	}
+	buf := &bytes.Buffer{}
+	assert.Nil(t, cast.Encode(buf))
+	assert.Nil(t, index.Append(entry))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(index.dirOf(entry.NodeID), entry.CastFile), buf.Bytes(), 0600))
+
+	_, err := Migrate(index.dir)
+	assert.Nil(t, err)
+
+	l, err := index.Get(entry.NodeID)
+	assert.Nil(t, err)
+	migrated, err := l.Find(entry.ID)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	f, err := os.Open(filepath.Join(index.dirOf(entry.NodeID), migrated.CastFile))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	replayed, err := asciicast.Decode(f)
+	assert.Nil(t, err)
+	out := &bytes.Buffer{}
+	assert.Nil(t, replayed.Play(context.Background(), out, 1, 0))
+	assert.Equal(t, "hello\n", out.String())
+}
+
+func newJournalIndex(t *testing.T) *fsLogIndex {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		assert.Failf(t, "ioutil.TempDir", "err = %v", err)
+	}
+	logIndex, err := newFSLogIndex(dir, LogFormatJournal)
+	if err != nil {
+		os.RemoveAll(dir)
+		assert.Failf(t, "newFSLogIndex", "unexpected err is not nil %v", err)
+	}
+	return logIndex
+}
@@ -0,0 +1,17 @@
+package log
+
+import "os"
+
+// FIXME: lock with LockFileEx, the journal is only locked within a process on windows
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// syncDir does nothing, directories cannot be synced on windows
+func syncDir(dir string) error {
+	return nil
+}
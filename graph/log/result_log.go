@@ -3,6 +3,7 @@ package log
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/1xyz/pryrite/tools"
@@ -43,6 +44,29 @@ type ResultLogEntry struct {
 	// The Content can change (in the referenced block)
 	// so persist the original  command alongside
 	Content string `yaml:"content" json:"content"`
+
+	// CastFile is the name of the asciicast recording of the execution, if recorded
+	CastFile string `yaml:"cast_file,omitempty" json:"cast_file,omitempty"`
+
+	// Revision is the git commit of the document the block was read from, if any
+	Revision string `yaml:"revision,omitempty" json:"revision,omitempty"`
+
+	// SHA256 is the hash of the document the block was read from
+	SHA256 string `yaml:"sha256,omitempty" json:"sha256,omitempty"`
+}
+
+// CastPath returns the path to the recording of the execution, empty if there is none
+func (e *ResultLogEntry) CastPath() string {
+	if e.CastFile == "" {
+		return ""
+	}
+	return filepath.Join(ResultLogDir(), e.NodeID, e.CastFile)
+}
+
+// CastFileName returns the name of the recording of the entry with the ID, kept
+// next to the node's result log
+func CastFileName(logID string) string {
+	return fmt.Sprintf("cast_%s.cast", logID)
 }
 
 func (e *ResultLogEntry) SetError(err error) {
@@ -86,6 +110,9 @@ type ResultLog interface {
 
 	// Append an entry to the ResultLog
 	Append(entry *ResultLogEntry) error
+
+	// Remove the entries with the IDs, IDs that are not found are ignored
+	Remove(ids ...string) error
 }
 
 // ResultLogIndex provides an interface to provide Results primarily by nodeID
@@ -103,21 +130,92 @@ const (
 	IndexUnknown    LogIndexType = 0
 	IndexInMemory   LogIndexType = 1
 	IndexFileSystem LogIndexType = 2
+	IndexJournal    LogIndexType = 3
 )
 
-var ResultLogDir = tools.MyPathTo("result_log")
+// ResultLogDir returns the directory the result logs are kept in
+func ResultLogDir() string {
+	return tools.StatePath("result_log")
+}
 
 func NewResultLogIndex(typ LogIndexType) (ResultLogIndex, error) {
 	switch typ {
 	case IndexInMemory:
 		return newInMemLogIndex(), nil
-	case IndexFileSystem:
-		fsIndex, err := newFSLogIndex(ResultLogDir)
+	case IndexFileSystem, IndexJournal:
+		format := LogFormatFiles
+		if typ == IndexJournal {
+			format = LogFormatJournal
+		}
+		fsIndex, err := newFSLogIndex(ResultLogDir(), format)
 		if err != nil {
 			return nil, err
 		}
-		return fsIndex, nil
+		return &searchIndexedLogIndex{ResultLogIndex: fsIndex, search: NewSearchIndex(ResultLogDir())}, nil
 	default:
 		return nil, fmt.Errorf("un-supported type %v", typ)
 	}
 }
+
+// IndexTypeOf returns the index type storing new result logs in the format,
+// files if the format is empty
+func IndexTypeOf(format string) (LogIndexType, error) {
+	switch LogFormat(format) {
+	case "", LogFormatFiles:
+		return IndexFileSystem, nil
+	case LogFormatJournal:
+		return IndexJournal, nil
+	default:
+		return IndexUnknown, fmt.Errorf("unknown result log format %q, expected %s or %s",
+			format, LogFormatFiles, LogFormatJournal)
+	}
+}
+
+// Filter selects result log entries, the zero value matches all entries
+type Filter struct {
+	NodeID     string
+	BlockID    string
+	ExitStatus string
+
+	// States the entry must be in, any state if empty
+	States []ExecState
+
+	// Since is the earliest time the entry was executed at, if set
+	Since time.Time
+
+	// Until is the latest time the entry was executed at, if set
+	Until time.Time
+}
+
+// Match returns true if the entry is selected by the filter
+func (f *Filter) Match(e *ResultLogEntry) bool {
+	if f.NodeID != "" && e.NodeID != f.NodeID {
+		return false
+	}
+	if f.BlockID != "" && e.BlockID != f.BlockID {
+		return false
+	}
+	if f.ExitStatus != "" && e.ExitStatus != f.ExitStatus {
+		return false
+	}
+	if len(f.States) > 0 && !e.State.In(f.States...) {
+		return false
+	}
+	if !f.Since.IsZero() && (e.ExecutedAt == nil || e.ExecutedAt.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && (e.ExecutedAt == nil || e.ExecutedAt.After(f.Until)) {
+		return false
+	}
+	return true
+}
+
+// In returns true if the state is one of the states
+func (s ExecState) In(states ...ExecState) bool {
+	for _, state := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
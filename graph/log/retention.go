@@ -0,0 +1,210 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+)
+
+// RetentionPolicy limits the size of the result logs, zero values are unlimited
+type RetentionPolicy struct {
+	MaxAge            time.Duration
+	MaxEntriesPerNode int
+	MaxTotalBytes     int64
+}
+
+func NewRetentionPolicy(cfg *config.ResultLogConfig) *RetentionPolicy {
+	if cfg == nil {
+		return &RetentionPolicy{}
+	}
+	return &RetentionPolicy{
+		MaxAge:            cfg.MaxAge.Duration,
+		MaxEntriesPerNode: cfg.MaxEntriesPerNode,
+		MaxTotalBytes:     cfg.MaxTotalBytes,
+	}
+}
+
+// GCStats counts the entries removed by GC
+type GCStats struct {
+	// Compacted are the queued, started and cancel-requested entries of a request that has finished
+	Compacted int
+	// Expired are the entries older than the max age
+	Expired int
+	// Trimmed are the entries in excess of the max entries per node or the max total bytes
+	Trimmed    int
+	BytesFreed int64
+}
+
+func (s *GCStats) Removed() int {
+	return s.Compacted + s.Expired + s.Trimmed
+}
+
+func (s *GCStats) String() string {
+	return fmt.Sprintf("removed %d entries (%d compacted, %d expired, %d trimmed), freed %d bytes",
+		s.Removed(), s.Compacted, s.Expired, s.Trimmed, s.BytesFreed)
+}
+
+// gcRecord is an entry of one of the result logs
+type gcRecord struct {
+	nodeID string
+	*logRecord
+}
+
+// GC compacts and applies the retention policy to the result logs of the nodes in
+// the directory, or all the nodes if none are specified. The max total bytes is
+// only applied if no nodes are specified, across all the nodes, removing the oldest
+// entries first.
+func GC(dir string, policy *RetentionPolicy, nodeIDs ...string) (*GCStats, error) {
+	if policy == nil {
+		policy = &RetentionPolicy{}
+	}
+	index, err := newFSLogIndex(dir, LogFormatFiles)
+	if err != nil {
+		return nil, err
+	}
+	search := NewSearchIndex(dir)
+
+	trimTotal := len(nodeIDs) == 0
+	if trimTotal {
+		if nodeIDs, err = index.nodeIDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &GCStats{}
+	for _, nodeID := range nodeIDs {
+		if err := gcNode(index, search, nodeID, policy, stats); err != nil {
+			return stats, fmt.Errorf("node %s: %w", nodeID, err)
+		}
+	}
+
+	if trimTotal && policy.MaxTotalBytes > 0 {
+		if err := gcTotalBytes(index, search, nodeIDs, policy.MaxTotalBytes, stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func gcNode(index *fsLogIndex, search *SearchIndex, nodeID string, policy *RetentionPolicy, stats *GCStats) error {
+	if exists, err := tools.StatExists(index.dirOf(nodeID)); err != nil || !exists {
+		return err
+	}
+	l, err := index.logOf(nodeID)
+	if err != nil {
+		return err
+	}
+	// newest first
+	records, err := l.records()
+	if err != nil {
+		return err
+	}
+	addCastSizes(index.dirOf(nodeID), records)
+
+	finished := map[string]bool{}
+	for _, r := range records {
+		if r.entry.State.In(ExecStateCompleted, ExecStateFailed) {
+			finished[r.entry.RequestID] = true
+		}
+	}
+
+	var expiresAt time.Time
+	if policy.MaxAge > 0 {
+		expiresAt = time.Now().Add(-policy.MaxAge)
+	}
+
+	removed := []string{}
+	kept := 0
+	for _, r := range records {
+		switch {
+		case r.entry.State.In(ExecStateQueued, ExecStateStarted, ExecStateCanceled) && finished[r.entry.RequestID]:
+			stats.Compacted++
+		case !expiresAt.IsZero() && entryTime(r).Before(expiresAt):
+			stats.Expired++
+		case policy.MaxEntriesPerNode > 0 && kept >= policy.MaxEntriesPerNode:
+			stats.Trimmed++
+		default:
+			kept++
+			continue
+		}
+		removed = append(removed, r.entry.ID)
+		stats.BytesFreed += r.size
+	}
+
+	return removeEntries(l, search, nodeID, removed)
+}
+
+func gcTotalBytes(index *fsLogIndex, search *SearchIndex, nodeIDs []string, maxBytes int64, stats *GCStats) error {
+	var total int64
+	records := []*gcRecord{}
+	logs := map[string]nodeLog{}
+	for _, nodeID := range nodeIDs {
+		l, err := index.logOf(nodeID)
+		if err != nil {
+			return err
+		}
+		rs, err := l.records()
+		if err != nil {
+			return err
+		}
+		logs[nodeID] = l
+		addCastSizes(index.dirOf(nodeID), rs)
+		for _, r := range rs {
+			total += r.size
+			records = append(records, &gcRecord{nodeID: nodeID, logRecord: r})
+		}
+	}
+	if total <= maxBytes {
+		return nil
+	}
+
+	// oldest first
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].at.Before(records[j].at)
+	})
+	removed := map[string][]string{}
+	for _, r := range records {
+		if total <= maxBytes {
+			break
+		}
+		removed[r.nodeID] = append(removed[r.nodeID], r.entry.ID)
+		total -= r.size
+		stats.Trimmed++
+		stats.BytesFreed += r.size
+	}
+
+	for nodeID, ids := range removed {
+		if err := removeEntries(logs[nodeID], search, nodeID, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeEntries(l ResultLog, search *SearchIndex, nodeID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tools.Log.Info().Msgf("removeEntries: node %s removing %d entries", nodeID, len(ids))
+	if err := l.Remove(ids...); err != nil {
+		return err
+	}
+	return search.Remove(nodeID, ids...)
+}
+
+// addCastSizes adds the size of the recordings to the bytes used by the entries
+func addCastSizes(dir string, records []*logRecord) {
+	for _, r := range records {
+		r.size += castSize(dir, r.entry)
+	}
+}
+
+func entryTime(r *logRecord) time.Time {
+	if r.entry.ExecutedAt != nil {
+		return *r.entry.ExecutedAt
+	}
+	return r.at
+}
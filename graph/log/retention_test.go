@@ -0,0 +1,87 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGC_Compact(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	now := time.Now()
+	appendAt(t, index, "q1", "req1", ExecStateQueued, now.Add(-3*time.Second))
+	appendAt(t, index, "s1", "req1", ExecStateStarted, now.Add(-2*time.Second))
+	appendAt(t, index, "c1", "req1", ExecStateCompleted, now.Add(-1*time.Second))
+	// req2 has not finished
+	appendAt(t, index, "s2", "req2", ExecStateStarted, now)
+
+	stats, err := GC(index.dir, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Compacted)
+	assert.Equal(t, 2, stats.Removed())
+	assert.Equal(t, []string{"s2", "c1"}, logIDs(t, index))
+}
+
+func TestGC_Retention(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	now := time.Now()
+	appendAt(t, index, "old", "req0", ExecStateCompleted, now.Add(-48*time.Hour))
+	for i, id := range []string{"a", "b", "c", "d"} {
+		appendAt(t, index, id, id, ExecStateCompleted, now.Add(time.Duration(i-4)*time.Minute))
+	}
+
+	stats, err := GC(index.dir, &RetentionPolicy{MaxAge: 24 * time.Hour, MaxEntriesPerNode: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Expired)
+	assert.Equal(t, 1, stats.Trimmed)
+	assert.Equal(t, []string{"d", "c", "b"}, logIDs(t, index))
+
+	info, err := os.Stat(filepath.Join(index.dirOf("node1"), getfilename("d")))
+	if err != nil {
+		t.FailNow()
+	}
+	// the total size is only trimmed across all the nodes
+	stats, err = GC(index.dir, &RetentionPolicy{MaxTotalBytes: info.Size()}, "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Trimmed)
+	stats, err = GC(index.dir, &RetentionPolicy{MaxTotalBytes: info.Size()})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Trimmed)
+	assert.Equal(t, []string{"d"}, logIDs(t, index))
+}
+
+func appendAt(t *testing.T, index *fsLogIndex, id, requestID string, state ExecState, at time.Time) {
+	entry := newTestLogEntry()
+	entry.ID = id
+	entry.RequestID = requestID
+	entry.State = state
+	entry.ExecutedAt = &at
+	if err := index.Append(entry); err != nil {
+		t.FailNow()
+	}
+	if err := os.Chtimes(filepath.Join(index.dirOf(entry.NodeID), getfilename(id)), at, at); err != nil {
+		t.FailNow()
+	}
+}
+
+func logIDs(t *testing.T, index *fsLogIndex) []string {
+	rl, err := index.Get("node1")
+	if err != nil {
+		t.FailNow()
+	}
+	ids := []string{}
+	if err := rl.Each(func(_ int, entry *ResultLogEntry) bool {
+		ids = append(ids, entry.ID)
+		return true
+	}); err != nil {
+		t.FailNow()
+	}
+	return ids
+}
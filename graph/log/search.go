@@ -0,0 +1,357 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/1xyz/pryrite/tools"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	searchIndexFile = "index.db"
+
+	// terms shorter than this are not indexed
+	minTermLen = 2
+	// long tokens, e.g. base64 blobs, are truncated
+	maxTermLen = 64
+
+	// how long to wait for another process holding the index
+	searchIndexTimeout = 2 * time.Second
+)
+
+var (
+	entriesBucketKey = []byte("entries")
+	termsBucketKey   = []byte("terms")
+
+	ErrSearchIndexNotFound = errors.New("the search index does not exist, run reindex")
+)
+
+// SearchIndex is an inverted index of the terms found in the content, output
+// and errors of result log entries. Only entries that have finished (or were
+// canceled) are indexed since the queued and started entries have no output.
+//
+// The index is opened for each operation, so that it is not held locked while
+// an inspector session is running.
+type SearchIndex struct {
+	path string
+}
+
+// SearchResult is an entry matching a search along with the first line that matched
+type SearchResult struct {
+	Entry *ResultLogEntry
+	Line  string
+}
+
+func NewSearchIndex(dir string) *SearchIndex {
+	return &SearchIndex{path: filepath.Join(dir, searchIndexFile)}
+}
+
+// Add indexes the entry, an entry with the same node and ID is replaced
+func (s *SearchIndex) Add(entries ...*ResultLogEntry) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		eb, tb := tx.Bucket(entriesBucketKey), tx.Bucket(termsBucketKey)
+		for _, entry := range entries {
+			if !isSearchable(entry) {
+				continue
+			}
+			key := entryKey(entry.NodeID, entry.ID)
+			if err := removeEntry(eb, tb, key); err != nil {
+				return err
+			}
+
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := eb.Put(key, b); err != nil {
+				return err
+			}
+			for _, term := range entryTerms(entry) {
+				if err := tb.Put(termKey(term, key), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Remove removes the entries of the node from the index
+func (s *SearchIndex) Remove(nodeID string, ids ...string) error {
+	if exists, err := tools.StatExists(s.path); err != nil || !exists {
+		return err
+	}
+	return s.update(func(tx *bbolt.Tx) error {
+		eb, tb := tx.Bucket(entriesBucketKey), tx.Bucket(termsBucketKey)
+		for _, id := range ids {
+			if err := removeEntry(eb, tb, entryKey(nodeID, id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Reset removes all the entries from the index
+func (s *SearchIndex) Reset() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Search returns up to limit of the most recent entries that match the filter and
+// contain all the terms of the query. An empty query matches all entries.
+func (s *SearchIndex) Search(query string, filter *Filter, limit int) ([]*SearchResult, error) {
+	if exists, err := tools.StatExists(s.path); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrSearchIndexNotFound
+	}
+	if filter == nil {
+		filter = &Filter{}
+	}
+
+	db, err := bbolt.Open(s.path, 0600, &bbolt.Options{ReadOnly: true, Timeout: searchIndexTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open %s err = %w", s.path, err)
+	}
+	defer db.Close()
+
+	terms := tokenize(query)
+	results := []*SearchResult{}
+	err = db.View(func(tx *bbolt.Tx) error {
+		eb, tb := tx.Bucket(entriesBucketKey), tx.Bucket(termsBucketKey)
+		if eb == nil || tb == nil {
+			return nil
+		}
+
+		var keys [][]byte
+		if len(terms) == 0 {
+			if err := eb.ForEach(func(k, _ []byte) error {
+				keys = append(keys, append([]byte{}, k...))
+				return nil
+			}); err != nil {
+				return err
+			}
+		} else {
+			keys = matchAllTerms(tb, terms)
+		}
+
+		for _, key := range keys {
+			var entry ResultLogEntry
+			if err := json.Unmarshal(eb.Get(key), &entry); err != nil {
+				return fmt.Errorf("json.Unmarshal %s err = %w", key, err)
+			}
+			if !filter.Match(&entry) {
+				continue
+			}
+			results = append(results, &SearchResult{Entry: &entry, Line: matchingLine(&entry, terms)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return executedAt(results[i].Entry).After(executedAt(results[j].Entry))
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *SearchIndex) update(fn func(tx *bbolt.Tx) error) error {
+	if err := tools.EnsureDir(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+	db, err := bbolt.Open(s.path, 0600, &bbolt.Options{Timeout: searchIndexTimeout})
+	if err != nil {
+		return fmt.Errorf("open %s err = %w", s.path, err)
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		for _, key := range [][]byte{entriesBucketKey, termsBucketKey} {
+			if _, err := tx.CreateBucketIfNotExists(key); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func removeEntry(eb, tb *bbolt.Bucket, key []byte) error {
+	b := eb.Get(key)
+	if b == nil {
+		return nil
+	}
+	var old ResultLogEntry
+	if err := json.Unmarshal(b, &old); err == nil {
+		for _, term := range entryTerms(&old) {
+			if err := tb.Delete(termKey(term, key)); err != nil {
+				return err
+			}
+		}
+	}
+	return eb.Delete(key)
+}
+
+// matchAllTerms returns the keys of the entries that contain all the terms
+func matchAllTerms(tb *bbolt.Bucket, terms []string) [][]byte {
+	var keys [][]byte
+	for i, term := range terms {
+		prefix := termKey(term, nil)
+		found := map[string]bool{}
+		c := tb.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			found[string(k[len(prefix):])] = true
+		}
+
+		if i == 0 {
+			for k := range found {
+				keys = append(keys, []byte(k))
+			}
+		} else {
+			matched := keys[:0]
+			for _, k := range keys {
+				if found[string(k)] {
+					matched = append(matched, k)
+				}
+			}
+			keys = matched
+		}
+		if len(keys) == 0 {
+			break
+		}
+	}
+	return keys
+}
+
+func isSearchable(entry *ResultLogEntry) bool {
+	return entry.State != ExecStateQueued && entry.State != ExecStateStarted
+}
+
+func entryKey(nodeID, id string) []byte {
+	return []byte(nodeID + "\x00" + id)
+}
+
+func termKey(term string, key []byte) []byte {
+	return append([]byte(term+"\x00"), key...)
+}
+
+func entryTerms(entry *ResultLogEntry) []string {
+	return tokenize(strings.Join([]string{entry.Content, entry.Stdout, entry.Stderr, entry.Err}, "\n"))
+}
+
+// tokenize returns the unique lower-cased words in the text
+func tokenize(text string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isSeparator) {
+		if len(word) < minTermLen {
+			continue
+		}
+		if len(word) > maxTermLen {
+			word = word[:maxTermLen]
+		}
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// matchingLine returns the first line of the output, error or content containing one of the terms
+func matchingLine(entry *ResultLogEntry, terms []string) string {
+	for _, text := range []string{entry.Stderr, entry.Stdout, entry.Err, entry.Content} {
+		for _, line := range strings.Split(text, "\n") {
+			lline := strings.ToLower(line)
+			for _, term := range terms {
+				if strings.Contains(lline, term) {
+					return strings.TrimSpace(line)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func executedAt(entry *ResultLogEntry) time.Time {
+	if entry.ExecutedAt == nil {
+		return time.Time{}
+	}
+	return *entry.ExecutedAt
+}
+
+// searchIndexedLogIndex keeps a SearchIndex up to date with the entries appended to the ResultLogIndex
+type searchIndexedLogIndex struct {
+	ResultLogIndex
+	search *SearchIndex
+}
+
+func (i *searchIndexedLogIndex) Append(entry *ResultLogEntry) error {
+	if err := i.ResultLogIndex.Append(entry); err != nil {
+		return err
+	}
+	// the result log is the source of truth, the index can be rebuilt with Reindex
+	if err := i.search.Add(entry); err != nil {
+		tools.Log.Warn().Err(err).Msgf("searchIndexedLogIndex: Add %s/%s", entry.NodeID, entry.ID)
+	}
+	return nil
+}
+
+// Reindex rebuilds the search index from the result logs in the directory and
+// returns the number of entries indexed
+func Reindex(dir string) (int, error) {
+	index, err := newFSLogIndex(dir, LogFormatFiles)
+	if err != nil {
+		return 0, err
+	}
+	nodeIDs, err := index.nodeIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	search := NewSearchIndex(dir)
+	if err := search.Reset(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, nodeID := range nodeIDs {
+		rl, err := index.Get(nodeID)
+		if err != nil {
+			return count, err
+		}
+		entries := []*ResultLogEntry{}
+		if err := rl.Each(func(_ int, entry *ResultLogEntry) bool {
+			if isSearchable(entry) {
+				entries = append(entries, entry)
+			}
+			return true
+		}); err != nil {
+			return count, fmt.Errorf("node %s: %w", nodeID, err)
+		}
+		if err := search.Add(entries...); err != nil {
+			return count, err
+		}
+		count += len(entries)
+	}
+	return count, nil
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"error", "connection", "refused", "db_host", "5432"},
+		tokenize("ERROR: connection refused (db_host:5432) - error"))
+	assert.Empty(t, tokenize(" a - b "))
+}
+
+func TestSearchIndex(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+	search := NewSearchIndex(index.dir)
+
+	_, err := search.Search("error", nil, 0)
+	assert.Equal(t, ErrSearchIndexNotFound, err)
+
+	now := time.Now()
+	for i, e := range []struct {
+		nodeID string
+		state  ExecState
+		stderr string
+	}{
+		{"node1", ExecStateFailed, "psql: connection refused"},
+		{"node1", ExecStateCompleted, ""},
+		{"node2", ExecStateFailed, "curl: connection timed out"},
+		{"node2", ExecStateStarted, ""},
+	} {
+		entry := newTestLogEntry()
+		entry.ID = string(rune('a' + i))
+		entry.NodeID = e.nodeID
+		entry.State = e.state
+		entry.Stderr = e.stderr
+		entry.Content = "echo hello"
+		executedAt := now.Add(time.Duration(i) * time.Minute)
+		entry.ExecutedAt = &executedAt
+		assert.Nil(t, search.Add(entry))
+	}
+
+	results, err := search.Search("Connection", nil, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(results)) {
+		// most recent first
+		assert.Equal(t, "c", results[0].Entry.ID)
+		assert.Equal(t, "curl: connection timed out", results[0].Line)
+		assert.Equal(t, "a", results[1].Entry.ID)
+	}
+
+	results, err = search.Search("connection refused", nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	results, err = search.Search("connection", &Filter{NodeID: "node1"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	// the started entry is not indexed
+	results, err = search.Search("", nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+
+	results, err = search.Search("hello", &Filter{States: []ExecState{ExecStateCompleted}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	results, err = search.Search("hello", nil, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	assert.Nil(t, search.Remove("node2", "c"))
+	results, err = search.Search("connection", nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+}
+
+func TestReindex(t *testing.T) {
+	index := newFsIndex(t)
+	defer removeDir(t, index)
+
+	entries := appendNTestLogEntries(t, 3, index)
+	for i, entry := range entries {
+		entry.State = ExecStateCompleted
+		entry.Stdout = []string{"hello world", "hello there", "goodbye"}[i]
+		if err := index.Append(entry); err != nil {
+			t.FailNow()
+		}
+	}
+
+	n, err := Reindex(index.dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	results, err := NewSearchIndex(index.dir).Search("hello there", nil, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(results)) {
+		assert.Equal(t, "log-1", results[0].Entry.ID)
+	}
+}
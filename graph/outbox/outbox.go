@@ -0,0 +1,365 @@
+// Package outbox queues the mutations of a store that failed, e.g. because the service
+// is unreachable, in a file so that they are retried later rather than lost.
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// how long to wait for another process holding the outbox
+	outboxTimeout = 2 * time.Second
+
+	minBackoff = 2 * time.Second
+	maxBackoff = 5 * time.Minute
+
+	// leaseDuration keeps an op claimed by a flush from the flushes of other processes,
+	// it expires in case the process exits before the op is sent
+	leaseDuration = 2 * time.Minute
+)
+
+var opsBucketKey = []byte("ops")
+
+type OpKind string
+
+const (
+	OpUpdateNode             OpKind = "update_node"
+	OpUpdateNodeBlock        OpKind = "update_node_block"
+	OpUpdateNodeBlockExecute OpKind = "update_node_block_execution"
+)
+
+// Target is the configuration entry, and its service, that an op is sent to
+type Target struct {
+	Entry      string
+	ServiceURL string
+}
+
+// TargetOf returns the target of the ops of the entry's remote store
+func TargetOf(entry *config.Entry) Target {
+	return Target{Entry: entry.Name, ServiceURL: entry.ServiceUrl}
+}
+
+// Op is a queued mutation of a node
+type Op struct {
+	Seq      uint64       `json:"seq"`
+	Kind     OpKind       `json:"kind"`
+	NodeID   string       `json:"node_id"`
+	Node     *graph.Node  `json:"node"`
+	Block    *graph.Block `json:"block,omitempty"`
+	QueuedAt time.Time    `json:"queued_at"`
+
+	// Entry and ServiceURL are the target the op was queued for, it is only sent there
+	Entry      string `json:"entry"`
+	ServiceURL string `json:"service_url"`
+
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+
+	// Lease is the flush that claimed the op to send it, until LeasedUntil
+	Lease       string    `json:"lease,omitempty"`
+	LeasedUntil time.Time `json:"leased_until"`
+}
+
+// queuedFor reports whether the op is sent to the target
+func (op *Op) queuedFor(t Target) bool {
+	return op.Entry == t.Entry && op.ServiceURL == t.ServiceURL
+}
+
+// dueAt returns when the op may be sent, after its lease by another flush expires
+func (op *Op) dueAt() time.Time {
+	if op.Lease != "" && op.LeasedUntil.After(op.NextAttempt) {
+		return op.LeasedUntil
+	}
+	return op.NextAttempt
+}
+
+// apply the mutation to the store
+func (op *Op) apply(store graph.Store) error {
+	switch op.Kind {
+	case OpUpdateNode:
+		return store.UpdateNode(op.Node)
+	case OpUpdateNodeBlock:
+		return store.UpdateNodeBlock(op.Node, op.Block)
+	case OpUpdateNodeBlockExecute:
+		return store.UpdateNodeBlockExecution(op.Node, op.Block)
+	default:
+		return fmt.Errorf("unknown op %s", op.Kind)
+	}
+}
+
+// SyncStats counts the outcome of a Flush
+type SyncStats struct {
+	Sent    int
+	Dropped int
+	Pending int
+}
+
+func (s *SyncStats) String() string {
+	return fmt.Sprintf("%d sent, %d dropped, %d pending", s.Sent, s.Dropped, s.Pending)
+}
+
+// Outbox is a queue of ops in a bbolt database. The database is opened for each
+// operation, so that processes can share it, and the lock serializes the opens of
+// this process. An op is leased by a flush before it is sent, so that the flushes
+// of other processes skip it.
+type Outbox struct {
+	path string
+	lock sync.Mutex
+
+	// flushLock serializes the flushes of this process
+	flushLock sync.Mutex
+}
+
+func New(path string) *Outbox {
+	return &Outbox{path: path}
+}
+
+// Enqueue appends the op to the queue
+func (o *Outbox) Enqueue(op *Op) error {
+	return o.update(func(b *bbolt.Bucket) error {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		op.Seq = seq
+		if op.QueuedAt.IsZero() {
+			op.QueuedAt = time.Now().UTC()
+		}
+		return putOp(b, op)
+	})
+}
+
+// Pending returns the queued ops, oldest first
+func (o *Outbox) Pending() ([]*Op, error) {
+	ops := []*Op{}
+	err := o.update(func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			op := &Op{}
+			if err := json.Unmarshal(v, op); err != nil {
+				return fmt.Errorf("op %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			ops = append(ops, op)
+			return nil
+		})
+	})
+	return ops, err
+}
+
+// pendingFor returns the queued ops of the target, oldest first
+func (o *Outbox) pendingFor(target Target) ([]*Op, error) {
+	ops, err := o.Pending()
+	if err != nil {
+		return nil, err
+	}
+	result := []*Op{}
+	for _, op := range ops {
+		if op.queuedFor(target) {
+			result = append(result, op)
+		}
+	}
+	return result, nil
+}
+
+// HasPending reports whether ops of the node are queued for the target
+func (o *Outbox) HasPending(target Target, nodeID string) (bool, error) {
+	ops, err := o.pendingFor(target)
+	if err != nil {
+		return false, err
+	}
+	for _, op := range ops {
+		if op.NodeID == nodeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Flush applies the ops queued for the target to its store in order. Ops that are
+// not due yet are skipped unless force is set, ops leased by the flush of another
+// process are always skipped. When an op of a node fails the later ops of the node
+// are held back, so that the ops of a node are applied in the order they were made.
+// An op failing with an error that retrying cannot fix, e.g. the node was deleted,
+// is dropped.
+func (o *Outbox) Flush(store graph.Store, target Target, force bool) (*SyncStats, error) {
+	o.flushLock.Lock()
+	defer o.flushLock.Unlock()
+
+	lease := uuid.New().String()
+	stats := &SyncStats{}
+	blocked := map[string]bool{}
+	for {
+		op, err := o.claim(target, lease, force, blocked)
+		if err != nil {
+			return stats, err
+		}
+		if op == nil {
+			break
+		}
+
+		err = op.apply(store)
+		switch {
+		case err == nil:
+			stats.Sent++
+			tools.Log.Info().Msgf("outbox: sent %s of %s queued at %v", op.Kind, op.NodeID, op.QueuedAt)
+		case !IsRetryable(err):
+			stats.Dropped++
+			tools.Log.Warn().Err(err).Msgf("outbox: dropped %s of %s queued at %v", op.Kind, op.NodeID, op.QueuedAt)
+		default:
+			blocked[op.NodeID] = true
+			op.Attempts++
+			op.LastError = err.Error()
+			op.NextAttempt = time.Now().Add(Backoff(op.Attempts))
+			op.Lease, op.LeasedUntil = "", time.Time{}
+			tools.Log.Info().Err(err).Msgf("outbox: %s of %s failed %d time(s), retry at %v",
+				op.Kind, op.NodeID, op.Attempts, op.NextAttempt)
+			if err := o.update(func(b *bbolt.Bucket) error { return putOp(b, op) }); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		if err := o.update(func(b *bbolt.Bucket) error { return b.Delete(seqKey(op.Seq)) }); err != nil {
+			return stats, err
+		}
+	}
+
+	pending, err := o.pendingFor(target)
+	if err != nil {
+		return stats, err
+	}
+	stats.Pending = len(pending)
+	return stats, nil
+}
+
+// claim leases the oldest op of the target that is due, in the transaction that
+// reads it so that concurrent flushes never claim the same op. The nodes with an op
+// that is not due, or leased by another flush, are added to blocked so that their
+// later ops wait. It returns nil if no op can be sent.
+func (o *Outbox) claim(target Target, lease string, force bool, blocked map[string]bool) (*Op, error) {
+	var claimed *Op
+	err := o.update(func(b *bbolt.Bucket) error {
+		now := time.Now()
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			op := &Op{}
+			if err := json.Unmarshal(v, op); err != nil {
+				return fmt.Errorf("op %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if !op.queuedFor(target) || blocked[op.NodeID] {
+				continue
+			}
+			leasedByOther := op.Lease != "" && op.Lease != lease && now.Before(op.LeasedUntil)
+			if leasedByOther || (!force && now.Before(op.NextAttempt)) {
+				blocked[op.NodeID] = true
+				continue
+			}
+			op.Lease, op.LeasedUntil = lease, now.Add(leaseDuration)
+			claimed = op
+			return putOp(b, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// NextAttempt returns when the earliest op of the target is due, false if none is
+// queued. Only the oldest op of each node counts since the later ones wait for it.
+func (o *Outbox) NextAttempt(target Target) (time.Time, bool, error) {
+	ops, err := o.pendingFor(target)
+	if err != nil || len(ops) == 0 {
+		return time.Time{}, false, err
+	}
+	seen := map[string]bool{}
+	var next time.Time
+	for _, op := range ops {
+		if seen[op.NodeID] {
+			continue
+		}
+		if len(seen) == 0 || op.dueAt().Before(next) {
+			next = op.dueAt()
+		}
+		seen[op.NodeID] = true
+	}
+	return next, true, nil
+}
+
+// Backoff is the delay before the attempt following the nth failed attempt
+func Backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// IsRetryable reports whether the error of a mutation may go away by retrying it,
+// e.g. the service is unreachable or failed, or the credentials expired
+func IsRetryable(err error) bool {
+	var he *graph.HttpError
+	if !errors.As(err, &he) {
+		// a network error or timeout
+		return true
+	}
+	switch he.HTTPCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	default:
+		return he.HTTPCode >= 500
+	}
+}
+
+func (o *Outbox) update(fn func(b *bbolt.Bucket) error) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if err := tools.EnsureDir(filepath.Dir(o.path)); err != nil {
+		return err
+	}
+	db, err := bbolt.Open(o.path, 0600, &bbolt.Options{Timeout: outboxTimeout})
+	if err != nil {
+		return fmt.Errorf("open %s err = %w", o.path, err)
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(opsBucketKey)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+func putOp(b *bbolt.Bucket, op *Op) error {
+	v, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	return b.Put(seqKey(op.Seq), v)
+}
+
+// seqKey is big endian so that the keys sort in the order of the sequence
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore records the mutations applied to it, failing them while err is set
+type fakeStore struct {
+	graph.Store
+	err     error
+	applied []string
+}
+
+func (f *fakeStore) record(n *graph.Node, what string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.applied = append(f.applied, n.ID+":"+what)
+	return nil
+}
+
+func (f *fakeStore) UpdateNode(n *graph.Node) error { return f.record(n, n.Title) }
+func (f *fakeStore) UpdateNodeBlock(n *graph.Node, b *graph.Block) error {
+	return f.record(n, b.Content)
+}
+func (f *fakeStore) UpdateNodeBlockExecution(n *graph.Node, b *graph.Block) error {
+	return f.record(n, b.LastExitStatus)
+}
+
+var testTarget = Target{Entry: "staging", ServiceURL: "https://staging.example.com"}
+
+func newTestOutbox(t *testing.T) (*Outbox, func()) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.FailNow()
+	}
+	return New(filepath.Join(dir, "outbox.db")), func() { os.RemoveAll(dir) }
+}
+
+func TestQueuedStore(t *testing.T) {
+	ob, cleanup := newTestOutbox(t)
+	defer cleanup()
+	fake := &fakeStore{err: errors.New("connection refused")}
+	// retrying is set so that the test flushes rather than the background loop
+	store := &queuedStore{Store: fake, outbox: ob, target: testTarget, retrying: true}
+
+	assert.Nil(t, store.UpdateNode(&graph.Node{ID: "a", Title: "1"}))
+	fake.err = nil
+	// queued behind the failed update of a, while b is sent
+	assert.Nil(t, store.UpdateNodeBlockExecution(&graph.Node{ID: "a"}, &graph.Block{LastExitStatus: "2"}))
+	assert.Nil(t, store.UpdateNodeBlock(&graph.Node{ID: "b"}, &graph.Block{Content: "3"}))
+	assert.Equal(t, []string{"b:3"}, fake.applied)
+
+	ops, err := ob.Pending()
+	assert.Nil(t, err)
+	if assert.Len(t, ops, 2) {
+		assert.Equal(t, OpUpdateNode, ops[0].Kind)
+		assert.Equal(t, 1, ops[0].Attempts)
+		assert.Equal(t, "connection refused", ops[0].LastError)
+		assert.Equal(t, OpUpdateNodeBlockExecute, ops[1].Kind)
+		assert.Equal(t, testTarget.Entry, ops[1].Entry)
+		assert.Equal(t, testTarget.ServiceURL, ops[1].ServiceURL)
+	}
+
+	// the first update is not due yet
+	stats, err := ob.Flush(fake, testTarget, false)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Pending: 2}, stats)
+
+	stats, err = ob.Flush(fake, testTarget, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Sent: 2}, stats)
+	assert.Equal(t, []string{"b:3", "a:1", "a:2"}, fake.applied)
+	_, ok, err := ob.NextAttempt(testTarget)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestOutbox_Flush_Errors(t *testing.T) {
+	ob, cleanup := newTestOutbox(t)
+	defer cleanup()
+	fake := &fakeStore{}
+	for _, op := range []*Op{
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "1"}},
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "2"}},
+		{Kind: OpUpdateNode, NodeID: "b", Node: &graph.Node{ID: "b", Title: "3"}},
+	} {
+		op.Entry, op.ServiceURL = testTarget.Entry, testTarget.ServiceURL
+		assert.Nil(t, ob.Enqueue(op))
+	}
+
+	// the service fails, nothing is sent and the later update of a waits for the first
+	fake.err = &graph.HttpError{Err: errors.New("unavailable"), HTTPCode: http.StatusServiceUnavailable}
+	stats, err := ob.Flush(fake, testTarget, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Pending: 3}, stats)
+	ops, err := ob.Pending()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 0, 1}, []int{ops[0].Attempts, ops[1].Attempts, ops[2].Attempts})
+	next, ok, err := ob.NextAttempt(testTarget)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, next.After(time.Now()))
+
+	// an update the service rejects is dropped
+	fake.err = &graph.HttpError{Err: errors.New("not found"), HTTPCode: http.StatusNotFound}
+	stats, err = ob.Flush(fake, testTarget, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Dropped: 3}, stats)
+	assert.Len(t, fake.applied, 0)
+}
+
+func TestOutbox_Flush_Target(t *testing.T) {
+	ob, cleanup := newTestOutbox(t)
+	defer cleanup()
+	fake := &fakeStore{}
+	other := Target{Entry: "prod", ServiceURL: "https://prod.example.com"}
+	for _, op := range []*Op{
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "staging"},
+			Entry: testTarget.Entry, ServiceURL: testTarget.ServiceURL},
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "prod"},
+			Entry: other.Entry, ServiceURL: other.ServiceURL},
+		// the entry now points at another service
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "moved"},
+			Entry: testTarget.Entry, ServiceURL: "https://old.example.com"},
+	} {
+		assert.Nil(t, ob.Enqueue(op))
+	}
+
+	stats, err := ob.Flush(fake, testTarget, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Sent: 1}, stats)
+	assert.Equal(t, []string{"a:staging"}, fake.applied)
+	ops, err := ob.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, ops, 2)
+}
+
+func TestOutbox_Claim(t *testing.T) {
+	ob, cleanup := newTestOutbox(t)
+	defer cleanup()
+	for _, op := range []*Op{
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "1"}},
+		{Kind: OpUpdateNode, NodeID: "a", Node: &graph.Node{ID: "a", Title: "2"}},
+		{Kind: OpUpdateNode, NodeID: "b", Node: &graph.Node{ID: "b", Title: "3"}},
+	} {
+		op.Entry, op.ServiceURL = testTarget.Entry, testTarget.ServiceURL
+		assert.Nil(t, ob.Enqueue(op))
+	}
+
+	// the op claimed by one flush, e.g. of another process, is skipped by another
+	// along with the later ops of its node
+	op, err := ob.claim(testTarget, "first", true, map[string]bool{})
+	assert.Nil(t, err)
+	if assert.NotNil(t, op) {
+		assert.Equal(t, "1", op.Node.Title)
+	}
+	op, err = ob.claim(testTarget, "second", true, map[string]bool{})
+	assert.Nil(t, err)
+	if assert.NotNil(t, op) {
+		assert.Equal(t, "3", op.Node.Title)
+	}
+	op, err = ob.claim(testTarget, "third", true, map[string]bool{})
+	assert.Nil(t, err)
+	assert.Nil(t, op)
+
+	fake := &fakeStore{}
+	stats, err := ob.Flush(fake, testTarget, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &SyncStats{Pending: 3}, stats)
+	assert.Empty(t, fake.applied)
+	next, ok, err := ob.NextAttempt(testTarget)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, next.After(time.Now().Add(leaseDuration/2)))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, Backoff(1))
+	assert.Equal(t, 8*time.Second, Backoff(3))
+	assert.Equal(t, 5*time.Minute, Backoff(100))
+	assert.True(t, IsRetryable(errors.New("timeout")))
+	assert.True(t, IsRetryable(&graph.HttpError{Err: errors.New("expired"), HTTPCode: http.StatusUnauthorized}))
+	assert.False(t, IsRetryable(&graph.HttpError{Err: errors.New("bad"), HTTPCode: http.StatusBadRequest}))
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
+)
+
+// queuedStore is a graph.Store whose mutations are queued in the outbox when they
+// fail with an error that may go away, and retried in the background. A mutation of
+// a node with queued ops is queued behind them rather than sent.
+type queuedStore struct {
+	graph.Store
+	outbox *Outbox
+	target Target
+
+	lock     sync.Mutex
+	retrying bool
+}
+
+// NewStore returns the store of the target with its mutations queued in the outbox on
+// failure. The ops already queued for the target are retried in the background, the
+// ops of other targets wait for a store of theirs.
+func NewStore(store graph.Store, outbox *Outbox, target Target) graph.Store {
+	s := &queuedStore{Store: store, outbox: outbox, target: target}
+	if _, ok, err := outbox.NextAttempt(target); err != nil {
+		tools.Log.Err(err).Msg("outbox: NextAttempt")
+	} else if ok {
+		s.startRetry()
+	}
+	return s
+}
+
+func (s *queuedStore) UpdateNode(n *graph.Node) error {
+	return s.mutate(&Op{Kind: OpUpdateNode, NodeID: n.ID, Node: n})
+}
+
+func (s *queuedStore) UpdateNodeBlock(n *graph.Node, b *graph.Block) error {
+	return s.mutate(&Op{Kind: OpUpdateNodeBlock, NodeID: n.ID, Node: n, Block: b})
+}
+
+func (s *queuedStore) UpdateNodeBlockExecution(n *graph.Node, b *graph.Block) error {
+	return s.mutate(&Op{Kind: OpUpdateNodeBlockExecute, NodeID: n.ID, Node: n, Block: b})
+}
+
+func (s *queuedStore) mutate(op *Op) error {
+	op.Entry, op.ServiceURL = s.target.Entry, s.target.ServiceURL
+	pending, err := s.outbox.HasPending(s.target, op.NodeID)
+	if err != nil {
+		tools.Log.Err(err).Msgf("outbox: HasPending %s, sending %s without the outbox", op.NodeID, op.Kind)
+		return op.apply(s.Store)
+	}
+	if !pending {
+		err := op.apply(s.Store)
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+		op.Attempts = 1
+		op.LastError = err.Error()
+		op.NextAttempt = time.Now().Add(Backoff(op.Attempts))
+	}
+
+	if err := s.outbox.Enqueue(op); err != nil {
+		return err
+	}
+	tools.Log.Warn().Msgf("outbox: queued %s of %s (%s), run sync to send it now", op.Kind, op.NodeID, op.LastError)
+	s.startRetry()
+	return nil
+}
+
+// startRetry starts flushing the outbox in the background until it is empty
+func (s *queuedStore) startRetry() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.retrying {
+		return
+	}
+	s.retrying = true
+	go s.retryLoop()
+}
+
+func (s *queuedStore) retryLoop() {
+	for {
+		next, ok, err := s.outbox.NextAttempt(s.target)
+		if err != nil {
+			tools.Log.Err(err).Msg("outbox: NextAttempt")
+			next, ok = time.Now().Add(minBackoff), true
+		}
+		if !ok {
+			s.lock.Lock()
+			// an op may have been queued since NextAttempt
+			if _, ok, _ = s.outbox.NextAttempt(s.target); !ok {
+				s.retrying = false
+				s.lock.Unlock()
+				return
+			}
+			s.lock.Unlock()
+			continue
+		}
+
+		time.Sleep(time.Until(next))
+		stats, err := s.outbox.Flush(s.Store, s.target, false)
+		if err != nil {
+			tools.Log.Err(err).Msg("outbox: Flush")
+			time.Sleep(minBackoff)
+			continue
+		}
+		tools.Log.Info().Msgf("outbox: retried %v", stats)
+	}
+}
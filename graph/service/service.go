@@ -0,0 +1,325 @@
+// Package service serves a graph.Store over the REST API used by the remote store,
+// so that a team can host its own shared nodes and execution history.
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
+)
+
+const (
+	apiPrefix = "/api/v1/"
+
+	// maxBodyBytes bounds the size of a request body
+	maxBodyBytes = 16 << 20
+)
+
+var (
+	errBadRequest   = errors.New("bad request")
+	errUnauthorized = errors.New("missing or invalid credentials")
+)
+
+// Service implements the API:
+//
+//	GET  /api/v1/nodes?limit=&kind=&include=blocks
+//	POST /api/v1/nodes
+//	GET  /api/v1/nodes/{nodeId}?include=blocks
+//	PUT  /api/v1/nodes/{nodeId}
+//	GET  /api/v1/nodes/{nodeId}/children?include=blocks
+//	PUT  /api/v1/nodes/{nodeId}/blocks/{blockId}
+//	PUT  /api/v1/nodes/{nodeId}/blocks/{blockId}/execution
+//	GET  /api/v1/search/nodes?Q=&Limit=&Kind=&Include=blocks
+//
+// Path parameters are escaped, since block IDs contain a slash. Errors are returned
+// as a graph.ErrorResponse.
+type Service struct {
+	store graph.Store
+	token string
+}
+
+// New returns the service of the store. If token is set, requests have to carry
+// it in their Authorization header, as "<scheme> <token>".
+func New(store graph.Store, token string) *Service {
+	return &Service{store: store, token: token}
+}
+
+type nodesResponse struct {
+	N []graph.Node `json:"Nodes"`
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status, err := s.serve(w, r)
+	if err != nil {
+		status = writeError(w, r, err)
+	}
+	tools.Log.Info().Msgf("%s %s %d %v", r.Method, r.URL.RequestURI(), status, time.Since(start))
+}
+
+func (s *Service) serve(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		return 0, errUnauthorized
+	}
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, apiPrefix) {
+		return 0, fmt.Errorf("%s: %w", r.URL.Path, graph.ErrNodeNotFound)
+	}
+	segments := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, apiPrefix), "/"), "/")
+	for i := range segments {
+		seg, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", err, errBadRequest)
+		}
+		segments[i] = seg
+	}
+
+	switch {
+	case match(segments, "search", "nodes") && r.Method == http.MethodGet:
+		return s.searchNodes(w, r)
+	case match(segments, "nodes") && r.Method == http.MethodGet:
+		return s.getNodes(w, r)
+	case match(segments, "nodes") && r.Method == http.MethodPost:
+		return s.addNode(w, r)
+	case match(segments, "nodes", "*") && r.Method == http.MethodGet:
+		return s.getNode(w, r, segments[1])
+	case match(segments, "nodes", "*") && r.Method == http.MethodPut:
+		return s.updateNode(w, r, segments[1])
+	case match(segments, "nodes", "*", "children") && r.Method == http.MethodGet:
+		return s.getChildren(w, r, segments[1])
+	case match(segments, "nodes", "*", "blocks", "*") && r.Method == http.MethodPut:
+		return s.updateBlock(w, r, segments[1], segments[3])
+	case match(segments, "nodes", "*", "blocks", "*", "execution") && r.Method == http.MethodPut:
+		return s.updateBlockExecution(w, r, segments[1], segments[3])
+	default:
+		return 0, &statusError{status: http.StatusNotFound, err: fmt.Errorf("no route for %s %s", r.Method, r.URL.Path)}
+	}
+}
+
+// match reports whether the path segments match the pattern, * matches any segment
+func match(segments []string, pattern ...string) bool {
+	if len(segments) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	// compared in constant time, so the time taken does not reveal the token
+	return len(fields) > 0 && subtle.ConstantTimeCompare([]byte(fields[len(fields)-1]), []byte(s.token)) == 1
+}
+
+func (s *Service) getNodes(w http.ResponseWriter, r *http.Request) (int, error) {
+	q := r.URL.Query()
+	limit, err := parseLimit(q.Get("limit"))
+	if err != nil {
+		return 0, err
+	}
+	nodes, err := s.store.GetNodes(limit, parseKind(q.Get("kind")))
+	if err != nil {
+		return 0, err
+	}
+	return writeJSON(w, http.StatusOK, &nodesResponse{N: withBlocks(nodes, q.Get("include"))})
+}
+
+func (s *Service) searchNodes(w http.ResponseWriter, r *http.Request) (int, error) {
+	q := r.URL.Query()
+	query := q.Get("Q")
+	if strings.TrimSpace(query) == "" {
+		return 0, fmt.Errorf("the query Q is empty: %w", errBadRequest)
+	}
+	limit, err := parseLimit(q.Get("Limit"))
+	if err != nil {
+		return 0, err
+	}
+	nodes, err := s.store.SearchNodes(query, limit, parseKind(q.Get("Kind")))
+	if err != nil {
+		return 0, err
+	}
+	return writeJSON(w, http.StatusOK, &nodesResponse{N: withBlocks(nodes, q.Get("Include"))})
+}
+
+func (s *Service) getNode(w http.ResponseWriter, r *http.Request, id string) (int, error) {
+	n, err := s.store.GetNode(id)
+	if err != nil {
+		return 0, err
+	}
+	result := withBlocks([]graph.Node{*n}, r.URL.Query().Get("include"))
+	return writeJSON(w, http.StatusOK, &result[0])
+}
+
+func (s *Service) addNode(w http.ResponseWriter, r *http.Request) (int, error) {
+	n := &graph.Node{}
+	if err := readJSON(r, n); err != nil {
+		return 0, err
+	}
+	result, err := s.store.AddNode(n)
+	if err != nil {
+		return 0, err
+	}
+	return writeJSON(w, http.StatusCreated, result)
+}
+
+func (s *Service) updateNode(w http.ResponseWriter, r *http.Request, id string) (int, error) {
+	n := &graph.Node{}
+	if err := readJSON(r, n); err != nil {
+		return 0, err
+	}
+	n.ID = id
+	if err := s.store.UpdateNode(n); err != nil {
+		return 0, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+func (s *Service) getChildren(w http.ResponseWriter, r *http.Request, id string) (int, error) {
+	children, err := s.store.GetChildren(id)
+	if err != nil {
+		return 0, err
+	}
+	return writeJSON(w, http.StatusOK, &nodesResponse{N: withBlocks(children, r.URL.Query().Get("include"))})
+}
+
+func (s *Service) updateBlock(w http.ResponseWriter, r *http.Request, nodeID, blockID string) (int, error) {
+	b := &graph.Block{}
+	if err := readJSON(r, b); err != nil {
+		return 0, err
+	}
+	b.ID = blockID
+	if err := s.store.UpdateNodeBlock(&graph.Node{ID: nodeID}, b); err != nil {
+		return 0, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+func (s *Service) updateBlockExecution(w http.ResponseWriter, r *http.Request, nodeID, blockID string) (int, error) {
+	req := &graph.UpdateBlockExecutionReq{}
+	if err := readJSON(r, req); err != nil {
+		return 0, err
+	}
+	b := &graph.Block{
+		ID:                blockID,
+		LastExecutedAt:    req.ExecutedAt,
+		LastExecutedBy:    req.ExecutedBy,
+		LastExitStatus:    req.ExitStatus,
+		LastExecutionInfo: req.Info,
+	}
+	if err := s.store.UpdateNodeBlockExecution(&graph.Node{ID: nodeID}, b); err != nil {
+		return 0, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+// withBlocks drops the blocks of the nodes unless they are included
+func withBlocks(nodes []graph.Node, include string) []graph.Node {
+	if nodes == nil {
+		return []graph.Node{}
+	}
+	if strings.EqualFold(include, "blocks") {
+		return nodes
+	}
+	for i := range nodes {
+		nodes[i].Blocks = nil
+	}
+	return nodes
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid limit %q: %w", s, errBadRequest)
+	}
+	return limit, nil
+}
+
+func parseKind(s string) graph.Kind {
+	if s == "" {
+		return graph.Unknown
+	}
+	return graph.Kind(s)
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decode body: %v: %w", err, errBadRequest)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		tools.Log.Err(err).Msg("writeJSON")
+	}
+	return status, nil
+}
+
+// statusError is an error with the HTTP status it is returned with
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+func statusOf(err error) int {
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		return se.status
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, graph.ErrNodeNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) int {
+	status := statusOf(err)
+	if status == http.StatusInternalServerError {
+		tools.Log.Err(err).Msgf("%s %s", r.Method, r.URL.RequestURI())
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeJSON(w, status, &graph.ErrorResponse{
+		OccurredAt: time.Now().UTC(),
+		Status:     status,
+		Error:      http.StatusText(status),
+		Message:    err.Error(),
+		Path:       r.URL.Path,
+	})
+	return status
+}
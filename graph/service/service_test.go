@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRemoteStore returns a remote store talking to the service of a local store
+func newTestRemoteStore(t *testing.T, token, clientToken string) (graph.Store, func()) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.FailNow()
+	}
+	srv := httptest.NewServer(New(graph.NewLocalStore(filepath.Join(dir, "store.db")), token))
+	entry := &config.Entry{ServiceUrl: srv.URL, AuthScheme: "Bearer " + clientToken}
+	return graph.NewStore(entry, &graph.Metadata{}), func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestService_RemoteStore(t *testing.T) {
+	store, cleanup := newTestRemoteStore(t, "", "")
+	defer cleanup()
+
+	n, err := graph.NewNode(graph.Command, "greet", "echo hello", "text/shell", graph.Metadata{Agent: "test"})
+	assert.Nil(t, err)
+	added, err := store.AddNode(n)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.NotEmpty(t, added.ID)
+	child, err := store.AddNode(n)
+	assert.Nil(t, err)
+
+	got, err := store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "greet", got.Title)
+	assert.Equal(t, "test", got.Metadata.Agent)
+	if !assert.Len(t, got.Blocks, 3) {
+		t.FailNow()
+	}
+
+	nodes, err := store.GetNodes(10, graph.Command)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 2)
+	nodes, err = store.SearchNodes("hello", 10, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 2)
+	nodes, err = store.SearchNodes("nothing", 10, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 0)
+
+	assert.Nil(t, store.UpdateNode(&graph.Node{ID: added.ID, Children: child.ID}))
+	children, err := store.GetChildren(added.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, children, 1) {
+		assert.Equal(t, child.ID, children[0].ID)
+	}
+
+	// block IDs contain a slash
+	b := got.Blocks[1]
+	b.Content = "echo goodbye\n"
+	assert.Nil(t, store.UpdateNodeBlock(got, b))
+	executedAt := time.Now().UTC()
+	b.LastExecutedAt, b.LastExitStatus = &executedAt, "0"
+	assert.Nil(t, store.UpdateNodeBlockExecution(got, b))
+
+	got, err = store.GetNode(added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo goodbye\n", got.Blocks[1].Content)
+	assert.Equal(t, "0", got.Blocks[1].LastExitStatus)
+	assert.True(t, executedAt.Equal(*got.LastExecutedAt))
+}
+
+func TestService_Errors(t *testing.T) {
+	store, cleanup := newTestRemoteStore(t, "", "")
+	defer cleanup()
+
+	_, err := store.GetNode("unknown")
+	var he *graph.HttpError
+	if assert.True(t, errors.As(err, &he)) {
+		assert.Equal(t, http.StatusNotFound, he.HTTPCode)
+		assert.Contains(t, he.Error(), "node not found")
+	}
+
+	n, err := graph.NewNode(graph.Command, "", "echo hello", "text/shell", graph.Metadata{})
+	assert.Nil(t, err)
+	added, err := store.AddNode(n)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	b := &graph.Block{}
+	*b = *added.Blocks[1]
+	b.ID = added.ID + "/9"
+	err = store.UpdateNodeBlockExecution(added, b)
+	if assert.True(t, errors.As(err, &he)) {
+		assert.Equal(t, http.StatusNotFound, he.HTTPCode)
+	}
+}
+
+func TestService_Token(t *testing.T) {
+	store, cleanup := newTestRemoteStore(t, "secret", "wrong")
+	defer cleanup()
+	_, err := store.GetNodes(10, graph.Unknown)
+	var he *graph.HttpError
+	if assert.True(t, errors.As(err, &he)) {
+		assert.Equal(t, http.StatusUnauthorized, he.HTTPCode)
+	}
+
+	store, cleanup = newTestRemoteStore(t, "secret", "secret")
+	defer cleanup()
+	nodes, err := store.GetNodes(10, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 0)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/go-resty/resty/v2"
 
 	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/auth"
 	"github.com/1xyz/pryrite/config"
 	"github.com/1xyz/pryrite/tools"
 )
@@ -63,7 +64,7 @@ type remoteStore struct {
 	configEntry *config.Entry
 	m           *Metadata
 	client      *http.Client
-	token       string
+	session     *auth.Session
 }
 
 func NewStore(configEntry *config.Entry, metadata *Metadata) Store {
@@ -91,7 +92,7 @@ func NewStore(configEntry *config.Entry, metadata *Metadata) Store {
 		configEntry: configEntry,
 		m:           metadata,
 		client:      client,
-		token:       "",
+		session:     auth.NewSession(configEntry, auth.NewCredentials(auth.DefaultCredentialsFile()), client),
 	}
 }
 
@@ -310,18 +311,59 @@ func (r *remoteStore) newHTTPClient(parseResponse bool) *resty.Client {
 		SetDoNotParseResponse(!parseResponse).
 		SetHostURL(r.configEntry.ServiceUrl).
 		SetHeaders(map[string]string{
-			"Authorization": fmt.Sprintf("%s %s", r.configEntry.AuthScheme, r.token),
-			"Accept":        "application/json",
-			"Content-Type":  "application/json",
-			"User-Agent":    fmt.Sprintf("%s/%s (%s)", app.Name, app.Version, app.CommitHash),
-		})
+			"Accept":       "application/json",
+			"Content-Type": "application/json",
+			"User-Agent":   fmt.Sprintf("%s/%s (%s)", app.Name, app.Version, app.CommitHash),
+		}).
+		OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+			// set for each attempt, so that a retry sends the refreshed token
+			req.SetHeader("Authorization", r.authorization())
+			return nil
+		}).
+		SetRetryCount(1).
+		AddRetryCondition(r.refreshOnUnauthorized)
+}
+
+// authorization is the Authorization header with the token of the entry's login
+func (r *remoteStore) authorization() string {
+	scheme := r.configEntry.AuthScheme
+	t := r.session.Token()
+	if t == nil {
+		return scheme
+	}
+	if scheme == "" {
+		scheme = "Bearer"
+		if t.TokenType != "" {
+			scheme = t.TokenType
+		}
+	}
+	return fmt.Sprintf("%s %s", scheme, t.AccessToken)
+}
+
+// refreshOnUnauthorized retries a request once if the service rejected the token
+// and it could be refreshed
+func (r *remoteStore) refreshOnUnauthorized(resp *resty.Response, err error) bool {
+	if err != nil || resp == nil || resp.StatusCode() != http.StatusUnauthorized {
+		return false
+	}
+	fields := strings.Fields(resp.Request.Header.Get("Authorization"))
+	rejected := ""
+	if len(fields) > 1 {
+		rejected = fields[len(fields)-1]
+	}
+	if err := r.session.Refresh(rejected); err != nil {
+		tools.Log.Info().Err(err).Msgf("refreshOnUnauthorized: %s", resp.Request.URL)
+		return false
+	}
+	closeRespBody(resp)
+	return true
 }
 
 func checkHTTP2XX(message string, resp *resty.Response) error {
 	statusCode := resp.StatusCode()
 	if statusCode == 401 {
 		return &HttpError{
-			Err:      errors.New("your credentials have expired: please run auth login"),
+			Err:      fmt.Errorf("your credentials are missing or have expired: please run %s login", app.Name),
 			HTTPCode: statusCode,
 		}
 	} else if statusCode < 200 || statusCode > 299 {
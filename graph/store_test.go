@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1xyz/pryrite/auth"
+	"github.com/1xyz/pryrite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteStore_RefreshOnUnauthorized(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "refresh", r.PostForm.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/api/v1/nodes/n1", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Nil(t, json.NewEncoder(w).Encode(&Node{ID: "n1", Title: "hello"}))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	creds := auth.NewCredentials(filepath.Join(dir, "credentials.json"))
+	assert.Nil(t, creds.Put("test", &auth.Token{AccessToken: "old", RefreshToken: "refresh"}))
+
+	entry := &config.Entry{Name: "test", ServiceUrl: srv.URL}
+	store := &remoteStore{
+		configEntry: entry,
+		m:           &Metadata{},
+		client:      srv.Client(),
+		session:     auth.NewSession(entry, creds, srv.Client()),
+	}
+	n, err := store.GetNode("n1")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "hello", n.Title)
+	assert.Equal(t, 2, requests)
+	token, err := creds.Get("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+
+	// the refreshed token is rejected too
+	assert.Nil(t, creds.Put("test", &auth.Token{AccessToken: "revoked"}))
+	store.session = auth.NewSession(entry, creds, srv.Client())
+	_, err = store.GetNode("n1")
+	var he *HttpError
+	if assert.ErrorAs(t, err, &he) {
+		assert.Equal(t, http.StatusUnauthorized, he.HTTPCode)
+	}
+}
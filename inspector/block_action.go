@@ -9,6 +9,8 @@ const (
 	BlockActionJump
 	BlockActionQuit
 	BlockActionExecutionDone
+	BlockActionContinue
+	BlockActionUntil
 )
 
 type BlockAction struct {
@@ -18,10 +20,12 @@ type BlockAction struct {
 
 var (
 	action = map[string]BlockActionType{
-		"next": BlockActionNext,
-		"prev": BlockActionPrev,
-		"jump": BlockActionJump,
-		"quit": BlockActionQuit,
+		"next":     BlockActionNext,
+		"prev":     BlockActionPrev,
+		"jump":     BlockActionJump,
+		"quit":     BlockActionQuit,
+		"continue": BlockActionContinue,
+		"until":    BlockActionUntil,
 	}
 )
 
@@ -0,0 +1,177 @@
+package inspector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1xyz/pryrite/tools"
+)
+
+// breakParam is the fence param that sets a breakpoint in the markdown, e.g. ```bash break
+const breakParam = "break"
+
+// breakpoints are the block IDs that continue stops at, persisted per node
+type breakpoints struct {
+	path   string
+	blocks map[string]bool
+}
+
+type breakpointsFile struct {
+	Blocks []string `json:"blocks"`
+}
+
+func loadBreakpoints(path string) (*breakpoints, error) {
+	bp := &breakpoints{path: path, blocks: map[string]bool{}}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return bp, nil
+		}
+		return nil, err
+	}
+
+	var f breakpointsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal %s err = %w", path, err)
+	}
+	for _, id := range f.Blocks {
+		bp.blocks[id] = true
+	}
+	return bp, nil
+}
+
+func (bp *breakpoints) save() error {
+	f := breakpointsFile{Blocks: bp.ids()}
+	b, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tools.EnsureDir(filepath.Dir(bp.path)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bp.path, b, 0600)
+}
+
+func (bp *breakpoints) ids() []string {
+	ids := make([]string, 0, len(bp.blocks))
+	for id := range bp.blocks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// hasBreakpoint returns true if continue should stop at the code block
+func (n *NodeInspector) hasBreakpoint(cb *codeBlock) bool {
+	return n.breaks.blocks[cb.block.ID] || isFenceBreakpoint(cb)
+}
+
+func isFenceBreakpoint(cb *codeBlock) bool {
+	if cb.block.ContentType == nil {
+		return false
+	}
+	v, ok := cb.block.ContentType.Params[breakParam]
+	return ok && v != "false"
+}
+
+// findBlock resolves a step number, block ID or heading text to a position in the code block list.
+// A heading refers to the first code block that follows it.
+func (n *NodeInspector) findBlock(ref string) (int, error) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		return n.parseStep(ref)
+	}
+	for i, cb := range n.codeBlocks {
+		if cb.block.ID == ref {
+			return i, nil
+		}
+	}
+
+	lref := strings.ToLower(ref)
+	for i, cb := range n.codeBlocks {
+		if strings.Contains(strings.ToLower(cb.Heading()), lref) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no code block found for %s", ref)
+}
+
+func (n *NodeInspector) SetBreakpoint(ref string) error {
+	pos, err := n.findBlock(ref)
+	if err != nil {
+		return err
+	}
+	cb := n.codeBlocks[pos]
+	n.breaks.blocks[cb.block.ID] = true
+	if err := n.breaks.save(); err != nil {
+		return err
+	}
+	tools.LogStdout("Breakpoint set at step %d (%s)\n", pos+1, cb.block.ID)
+	return nil
+}
+
+// ClearBreakpoint removes the breakpoint for the reference or all of them if ref is empty.
+// Breakpoints set by a fence param can only be removed by editing the markdown.
+func (n *NodeInspector) ClearBreakpoint(ref string) error {
+	if ref == "" {
+		n.breaks.blocks = map[string]bool{}
+		return n.breaks.save()
+	}
+
+	pos, err := n.findBlock(ref)
+	if err != nil {
+		return err
+	}
+	cb := n.codeBlocks[pos]
+	if !n.breaks.blocks[cb.block.ID] {
+		if isFenceBreakpoint(cb) {
+			return fmt.Errorf("the breakpoint at step %d is set by the markdown", pos+1)
+		}
+		return fmt.Errorf("there is no breakpoint at step %d", pos+1)
+	}
+	delete(n.breaks.blocks, cb.block.ID)
+	return n.breaks.save()
+}
+
+func (n *NodeInspector) ListBreakpoints() {
+	rows := 0
+	for i, cb := range n.codeBlocks {
+		if !n.hasBreakpoint(cb) {
+			continue
+		}
+		source := "inspector"
+		if isFenceBreakpoint(cb) {
+			source = "markdown"
+		}
+		rows++
+		tools.LogStdout("%d. step %d (%s) %s [%s]\n", rows, i+1, cb.block.ID, cb.Heading(), source)
+	}
+	if rows == 0 {
+		tools.LogStdout("No breakpoints set\n")
+	}
+}
+
+var headingRE = regexp.MustCompile(`(?m)^ {0,3}#{1,6}[ \t]+(.+?)[ \t#]*$`)
+
+// Heading returns the text of the last markdown heading preceding this code block
+func (c *codeBlock) Heading() string {
+	heading := ""
+	for _, b := range c.node.Blocks {
+		if b.ID == c.block.ID {
+			break
+		}
+		if b.IsCode() {
+			continue
+		}
+		if m := headingRE.FindAllStringSubmatch(b.Content, -1); len(m) > 0 {
+			heading = m[len(m)-1][1]
+		}
+	}
+	return heading
+}
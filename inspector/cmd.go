@@ -2,9 +2,11 @@ package inspector
 
 import (
 	"context"
+	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
-	"os"
+	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,9 +25,18 @@ func newRootCmd(n *NodeInspector) *cobra.Command {
 	rootCmd.AddCommand(newActionCmd(n, "prev", []string{"p"}, "Navigate to the previous code block"))
 	rootCmd.AddCommand(newActionCmd(n, "jump", []string{"j"}, "Switch to another code block"))
 	rootCmd.AddCommand(newRunCmd(n))
+	rootCmd.AddCommand(newActionCmd(n, "continue", []string{"c"}, "Run from this code block until a failure or the end"))
+	rootCmd.AddCommand(newUntilCmd(n))
+	rootCmd.AddCommand(newEditCmd(n))
+	rootCmd.AddCommand(newBreakCmd(n))
+	rootCmd.AddCommand(newBreaksCmd(n))
+	rootCmd.AddCommand(newClearCmd(n))
 	rootCmd.AddCommand(NewCmdExecutor(n.runner.Register))
 	rootCmd.AddCommand(newWhereAmICmd(n))
 	rootCmd.AddCommand(newLogCmd(n))
+	rootCmd.AddCommand(newOutputCmd(n))
+	rootCmd.AddCommand(newDiffCmd(n))
+	rootCmd.AddCommand(newReplayCmd(n))
 	rootCmd.AddCommand(newActionCmd(n, "quit", []string{"q", "exit"}, "Quit this session"))
 	return rootCmd
 }
@@ -48,6 +59,74 @@ func newRunCmd(n *NodeInspector) *cobra.Command {
 	}
 }
 
+func newUntilCmd(n *NodeInspector) *cobra.Command {
+	return &cobra.Command{
+		Use:     "until <step>",
+		Aliases: []string{"u"},
+		Short:   "Run from this code block up to (but not including) the given step",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n.processAction(&BlockAction{
+				Action: BlockActionUntil,
+				Args:   args,
+			})
+			return nil
+		},
+	}
+}
+
+func newEditCmd(n *NodeInspector) *cobra.Command {
+	var save bool
+	cmd := &cobra.Command{
+		Use:     "edit",
+		Aliases: []string{"e"},
+		Short:   "Edit this code block in $EDITOR and optionally run it",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return n.EditBlock(save)
+		},
+	}
+	cmd.Flags().BoolVarP(&save, "save", "s", false,
+		"Save the change to the source markdown file (a .bak copy is kept)")
+	return cmd
+}
+
+func newBreakCmd(n *NodeInspector) *cobra.Command {
+	return &cobra.Command{
+		Use:     "break [step|block-id|heading]",
+		Aliases: []string{"b"},
+		Short:   "Set a breakpoint that continue stops at, defaults to the current code block",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return n.SetBreakpoint(strconv.Itoa(n.codeBlockPos + 1))
+			}
+			return n.SetBreakpoint(strings.Join(args, " "))
+		},
+	}
+}
+
+func newBreaksCmd(n *NodeInspector) *cobra.Command {
+	return &cobra.Command{
+		Use:   "breaks",
+		Short: "List the breakpoints",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n.ListBreakpoints()
+			return nil
+		},
+	}
+}
+
+func newClearCmd(n *NodeInspector) *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear [step|block-id|heading]",
+		Short: "Clear a breakpoint or all breakpoints if none is specified",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return n.ClearBreakpoint(strings.Join(args, " "))
+		},
+	}
+}
+
 func newWhereAmICmd(n *NodeInspector) *cobra.Command {
 	return &cobra.Command{
 		Use:   "whereami",
@@ -70,8 +149,15 @@ func Strip(str string) string {
 	return re.ReplaceAllString(str, "")
 }
 
+// currentBlockRef refers to the current code block when a flag is passed without a value
+const currentBlockRef = "."
+
 type logListOpts struct {
-	Limit int
+	Limit  int
+	Block  string
+	Failed bool
+	Since  time.Duration
+	Color  bool
 }
 
 func newLogCmd(n *NodeInspector) *cobra.Command {
@@ -81,11 +167,77 @@ func newLogCmd(n *NodeInspector) *cobra.Command {
 		Short: "Show past execution log entries",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return n.IterateLogEntries(opts.Limit)
+			return n.IterateLogEntries(opts)
 		},
 	}
 	cmd.Flags().IntVarP(&opts.Limit, "limit", "n",
 		1, "Limit the number of log entries to display")
+	cmd.Flags().StringVarP(&opts.Block, "block", "b", "",
+		"Only show entries of a code block (step, block-id or heading), defaults to the current block")
+	cmd.Flags().Lookup("block").NoOptDefVal = currentBlockRef
+	cmd.Flags().BoolVar(&opts.Failed, "failed", false,
+		"Only show entries of failed executions")
+	cmd.Flags().DurationVar(&opts.Since, "since", 0,
+		"Only show entries executed within this duration, e.g. 1h")
+	cmd.Flags().BoolVar(&opts.Color, "color", false,
+		"Preserve the ANSI colours of the output")
+	return cmd
+}
+
+func newOutputCmd(n *NodeInspector) *cobra.Command {
+	var nth int
+	var color bool
+	cmd := &cobra.Command{
+		Use:     "output",
+		Aliases: []string{"show"},
+		Short:   "Show the latest (or an older) result of this code block",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return n.ShowOutput(nth, color)
+		},
+	}
+	cmd.Flags().IntVarP(&nth, "nth", "n",
+		1, "Show the nth most recent result, 1 is the latest")
+	cmd.Flags().BoolVar(&color, "color", false,
+		"Preserve the ANSI colours of the output")
+	return cmd
+}
+
+func newDiffCmd(n *NodeInspector) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff [log-id log-id]",
+		Short: "Compare two executions, defaults to the last two executions of this code block",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 && len(args) != 2 {
+				return fmt.Errorf("expected none or two log IDs")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return n.DiffExecutions(args...)
+		},
+	}
+}
+
+func newReplayCmd(n *NodeInspector) *cobra.Command {
+	var speed float64
+	var maxIdle time.Duration
+	cmd := &cobra.Command{
+		Use:   "replay [log-id]",
+		Short: "Play back the recorded output of an execution, defaults to the latest of this code block",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var logID string
+			if len(args) > 0 {
+				logID = args[0]
+			}
+			return n.Replay(logID, speed, maxIdle)
+		},
+	}
+	cmd.Flags().Float64VarP(&speed, "speed", "s", 1,
+		"Playback speed, e.g. 2 plays twice as fast")
+	cmd.Flags().DurationVar(&maxIdle, "max-idle", 2*time.Second,
+		"Shorten pauses in the output to at most this long, 0 keeps the recorded pauses")
 	return cmd
 }
 
@@ -222,10 +374,10 @@ func NewCmdExecutor(register *executor.Register) *cobra.Command {
 	return cmd
 }
 
-func renderRows(rows ...table.Row) {
+func renderRows(w io.Writer, rows ...table.Row) {
 	tc := table.NewWriter()
 	tc.SetStyle(table.StyleBold)
-	tc.SetOutputMirror(os.Stdout)
+	tc.SetOutputMirror(w)
 	tc.AppendRows(rows)
 	tc.Render()
 }
@@ -3,9 +3,13 @@ package inspector
 import (
 	_ "embed"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/1xyz/pryrite/graph/log"
 	"github.com/jedib0t/go-pretty/v6/table"
-	"os"
 
 	"github.com/1xyz/pryrite/config"
 	"github.com/1xyz/pryrite/graph"
@@ -13,6 +17,7 @@ import (
 	"github.com/1xyz/pryrite/internal/history"
 	"github.com/1xyz/pryrite/internal/ui/components"
 	"github.com/1xyz/pryrite/markdown"
+	"github.com/1xyz/pryrite/policy"
 	"github.com/1xyz/pryrite/run"
 	"github.com/1xyz/pryrite/snippet"
 	"github.com/1xyz/pryrite/tools"
@@ -29,6 +34,7 @@ func InspectNode(gCtx *snippet.Context, nodeID string) error {
 		return fmt.Errorf("no code blocks found for %s", nodeID)
 	}
 
+	ni.runner.SetConfirmFn(confirmViolations)
 	go ni.runner.Start()
 	defer func() {
 		ni.runner.Shutdown()
@@ -42,13 +48,57 @@ func InspectNode(gCtx *snippet.Context, nodeID string) error {
 	return nil
 }
 
+// RunNode executes all the code blocks of the node in order without user
+// interaction, it stops at the first block that fails. Blocks that violate
+// the execution policy are refused unless allow is set.
+func RunNode(gCtx *snippet.Context, nodeID string, allow bool) error {
+	ni, err := NewNodeInspector(gCtx, nodeID)
+	if err != nil {
+		return err
+	}
+	if len(ni.codeBlocks) == 0 {
+		return fmt.Errorf("no code blocks found for %s", nodeID)
+	}
+
+	if allow {
+		ni.runner.SetConfirmFn(allowViolations)
+	}
+	go ni.runner.Start()
+	defer func() {
+		ni.runner.Shutdown()
+	}()
+	ni.runner.WaitForStart()
+
+	results := ni.runSteps(len(ni.codeBlocks)-1, false)
+	renderStepSummary(results, len(ni.codeBlocks))
+	if stepsFailed(results) {
+		return fmt.Errorf("step %d of %d failed", ni.codeBlockPos+1, len(ni.codeBlocks))
+	}
+	return nil
+}
+
+func confirmViolations(_ *run.BlockExecutionRequest, violations []policy.Violation) bool {
+	tools.LogStdError("\U000026A0  This block matches the execution policy:\n%s", policy.Format(violations))
+	return components.ShowYNQuestionPrompt("Run this block anyway")
+}
+
+func allowViolations(_ *run.BlockExecutionRequest, violations []policy.Violation) bool {
+	tools.LogStdError("\U000026A0  Running a block allowed by --allow:\n%s", policy.Format(violations))
+	return true
+}
+
 func NewNodeInspector(graphCtx *snippet.Context, nodeID string) (*NodeInspector, error) {
 	r, err := run.NewRun(graphCtx, nodeID)
 	if err != nil {
 		return nil, err
 	}
 
-	hist, err := history.New(fmt.Sprintf("%s/%s", history.HistoryDir, nodeID))
+	hist, err := history.New(fmt.Sprintf("%s/%s", history.HistoryDir(), nodeID))
+	if err != nil {
+		return nil, err
+	}
+
+	breaks, err := loadBreakpoints(fmt.Sprintf("%s/%s.breakpoints.json", history.HistoryDir(), nodeID))
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +108,7 @@ func NewNodeInspector(graphCtx *snippet.Context, nodeID string) (*NodeInspector,
 		codeBlocks:   []*codeBlock{},
 		codeBlockPos: 0,
 		hist:         hist,
+		breaks:       breaks,
 	}
 	ni.populateCodeBlocks(r.Root, "")
 	for _, b := range ni.codeBlocks {
@@ -71,6 +122,7 @@ type NodeInspector struct {
 	codeBlocks   []*codeBlock
 	codeBlockPos int
 	hist         history.History
+	breaks       *breakpoints
 }
 
 func (n *NodeInspector) NewRootCmd() *cobra.Command {
@@ -149,11 +201,49 @@ func (n *NodeInspector) processAction(nextAction *BlockAction) {
 		} else {
 			n.codeBlockPos = selEntry.Index()
 		}
+	case BlockActionContinue:
+		renderStepSummary(n.runSteps(len(n.codeBlocks)-1, true), len(n.codeBlocks))
+	case BlockActionUntil:
+		if len(nextAction.Args) != 1 {
+			tools.LogStderr(nil, "until requires a step number\n")
+			return
+		}
+		stop, err := n.parseStep(nextAction.Args[0])
+		if err != nil {
+			tools.LogStderr(err, "%v\n", err)
+			return
+		}
+		if stop <= n.codeBlockPos {
+			tools.LogStderr(nil, "step %d is not after the current step %d\n", stop+1, n.codeBlockPos+1)
+			return
+		}
+		renderStepSummary(n.runSteps(stop-1, true), len(n.codeBlocks))
 	}
 
 	n.currentBlock().WhereAmI()
 }
 
+// EditBlock opens the current code block in an editor and offers to run the edited content
+func (n *NodeInspector) EditBlock(save bool) error {
+	cb := n.currentBlock()
+	before := cb.block.Content
+	if _, _, err := n.runner.EditBlock(cb.node.ID, cb.block.ID, save); err != nil {
+		return err
+	}
+	if cb.block.Content == before {
+		return nil
+	}
+
+	cb.WhereAmI()
+	if components.ShowYNQuestionPrompt("Run the edited block") && cb.RunBlock() {
+		n.processAction(&BlockAction{
+			Action: BlockActionExecutionDone,
+			Args:   []string{},
+		})
+	}
+	return nil
+}
+
 // populateCodeBlocks Flatten the tree into a list in a pre-order
 // depth traversal first a node's code blocks are added;
 // followed by a traversal for the first child and so on...
@@ -177,63 +267,147 @@ func (n *NodeInspector) populateCodeBlocks(node *graph.Node, prefix string) {
 	}
 }
 
+// ResultLog returns the result log of the node of the current block, which is a
+// child of the playbook when the markdown includes or links to other files
 func (n *NodeInspector) ResultLog() (log.ResultLog, error) {
-	return n.runner.ExecIndex.Get(n.runner.PlaybookID)
+	return n.runner.ExecIndex.Get(n.currentBlock().node.ID)
 }
 
-func (n *NodeInspector) IterateLogEntries(limit int) error {
-	rl, err := n.ResultLog()
+func (n *NodeInspector) IterateLogEntries(opts *logListOpts) error {
+	filter := &log.Filter{}
+	node := n.currentBlock().node
+	if opts.Block == currentBlockRef {
+		filter.BlockID = n.currentBlock().block.ID
+	} else if opts.Block != "" {
+		pos, err := n.findBlock(opts.Block)
+		if err != nil {
+			return err
+		}
+		filter.BlockID = n.codeBlocks[pos].block.ID
+		node = n.codeBlocks[pos].node
+	}
+	if opts.Failed {
+		filter.States = []log.ExecState{log.ExecStateFailed}
+	}
+	if opts.Since > 0 {
+		filter.Since = time.Now().Add(-opts.Since)
+	}
+
+	entries, err := n.findLogEntries(node.ID, filter, opts.Limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		tools.LogStdout("No log entries found\n")
+		return nil
+	}
+
+	sb := &strings.Builder{}
+	for i, entry := range entries {
+		renderRows(sb, table.Row{"log entry:", fmt.Sprintf("log entry %d", i+1)})
+		renderLogEntry(sb, entry, opts.Color)
+	}
+	return tools.Page(sb.String())
+}
+
+// ShowOutput displays the nth (starting at 1) most recent result of the current block
+func (n *NodeInspector) ShowOutput(nth int, color bool) error {
+	if nth < 1 {
+		return fmt.Errorf("invalid -n %d, expected a number greater than 0", nth)
+	}
+
+	cb := n.currentBlock()
+	entries, err := n.findLogEntries(cb.node.ID, &log.Filter{BlockID: cb.block.ID}, nth)
 	if err != nil {
 		return err
 	}
+	if len(entries) < nth {
+		return fmt.Errorf("found %d result(s) for step %d", len(entries), n.codeBlockPos+1)
+	}
+
+	sb := &strings.Builder{}
+	renderLogEntry(sb, entries[nth-1], color)
+	return tools.Page(sb.String())
+}
+
+// findLogEntries returns up to limit of the most recent entries of the node matching the filter
+func (n *NodeInspector) findLogEntries(nodeID string, filter *log.Filter, limit int) ([]*log.ResultLogEntry, error) {
+	entries := []*log.ResultLogEntry{}
+	rl, err := n.runner.ExecIndex.Get(nodeID)
+	if err != nil {
+		if err == log.ErrResultLogNotFound {
+			return entries, nil
+		}
+		return nil, err
+	}
 
-	count := 0
 	if err := rl.Each(func(i int, entry *log.ResultLogEntry) bool {
 		if entry.State == log.ExecStateStarted || entry.State == log.ExecStateQueued {
 			// skip the started and queued states. There is not much to show
 			return true
 		}
-
-		count++
-		if count > limit {
-			return false
+		if !filter.Match(entry) {
+			return true
 		}
 
-		executedAt := "unknown"
-		if entry.ExecutedAt != nil {
-			executedAt = entry.ExecutedAt.Format(timeLayout)
-		}
+		entries = append(entries, entry)
+		return len(entries) < limit
+	}); err != nil {
+		return nil, fmt.Errorf("rleach Err = %w", err)
+	}
+	return entries, nil
+}
 
-		renderRows(table.Row{"log entry:", fmt.Sprintf("log entry %d", count)})
-		renderRows([]table.Row{
-			{"Block", entry.BlockID},
-			{"Executed On", executedAt},
-			{"Exit Status", entry.ExitStatus},
-			{"Error", entry.Err},
-		}...)
-
-		renderRows(table.Row{"Command"})
-		fmt.Fprintf(os.Stdout, Strip(entry.Content))
-		fmt.Fprintf(os.Stdout, "\n")
-
-		if len(entry.Stdout) > 0 {
-			renderRows(table.Row{"stdout"})
-			fmt.Fprintf(os.Stdout, Strip(entry.Stdout))
-			fmt.Fprintf(os.Stdout, "\n")
-		}
+// DiffExecutions compares the executions with the log IDs, or the last two executions of the current block
+func (n *NodeInspector) DiffExecutions(ids ...string) error {
+	rl, err := n.ResultLog()
+	if err != nil {
+		return err
+	}
+	d, err := log.DiffExecutions(rl, n.currentBlock().block.ID, ids...)
+	if err != nil {
+		return err
+	}
 
-		if len(entry.Stderr) > 0 {
-			renderRows(table.Row{"stderr"})
-			fmt.Fprintf(os.Stdout, Strip(entry.Stdout))
-			fmt.Fprintf(os.Stdout, "\n")
-		}
+	sb := &strings.Builder{}
+	d.Write(sb, tools.IsTermEnabled(int(os.Stdout.Fd())))
+	return tools.Page(sb.String())
+}
 
-		return true
-	}); err != nil {
-		return fmt.Errorf("rleach Err = %w", err)
+func renderLogEntry(w io.Writer, entry *log.ResultLogEntry, color bool) {
+	executedAt := "unknown"
+	if entry.ExecutedAt != nil {
+		executedAt = entry.ExecutedAt.Local().Format(timeLayout)
+	}
+	text := Strip
+	if color {
+		text = func(s string) string { return s }
 	}
 
-	return nil
+	renderRows(w, []table.Row{
+		{"Log ID", entry.ID},
+		{"Execution ID", entry.ExecutionID},
+		{"Block", entry.BlockID},
+		{"Executed On", executedAt},
+		{"Revision", entry.Revision},
+		{"SHA256", entry.SHA256},
+		{"State", entry.State},
+		{"Exit Status", entry.ExitStatus},
+		{"Error", entry.Err},
+	}...)
+
+	renderRows(w, table.Row{"Command"})
+	fmt.Fprintln(w, text(entry.Content))
+
+	if len(entry.Stdout) > 0 {
+		renderRows(w, table.Row{"stdout"})
+		fmt.Fprintln(w, text(entry.Stdout))
+	}
+
+	if len(entry.Stderr) > 0 {
+		renderRows(w, table.Row{"stderr"})
+		fmt.Fprintln(w, text(entry.Stderr))
+	}
 }
 
 var (
@@ -254,6 +428,9 @@ func introMsg(entry *config.Entry) error {
 		return err
 	}
 	fmt.Println(content)
+	if config.IsReadOnly() {
+		return nil
+	}
 	entry.HideInspectIntro = !components.ShowYNQuestionPrompt("Show this message again?")
 	return config.SetEntry(entry)
 }
@@ -0,0 +1,89 @@
+package inspector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/1xyz/pryrite/asciicast"
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/1xyz/pryrite/tools"
+)
+
+var errNoRecording = errors.New("no recording found, set record: true under result_log in the configuration to record executions")
+
+// Replay plays back the recording of the execution with the log ID, or of the
+// latest recorded execution of the current block
+func (n *NodeInspector) Replay(logID string, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		return fmt.Errorf("invalid speed %v, expected a number greater than 0", speed)
+	}
+	entry, err := n.findRecording(logID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(entry.CastPath())
+	if err != nil {
+		return err
+	}
+	defer tools.CloseFile(f)
+	cast, err := asciicast.Decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", entry.CastPath(), err)
+	}
+
+	executedAt := "unknown"
+	if entry.ExecutedAt != nil {
+		executedAt = entry.ExecutedAt.Local().Format(timeLayout)
+	}
+	tools.LogStdout("Replaying %s (log %s) executed on %s, %v long at %vx speed, Ctrl+C to stop\n",
+		entry.BlockID, entry.ID, executedAt, cast.Duration().Round(time.Millisecond), speed)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cast.Play(ctx, os.Stdout, speed, maxIdle); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	tools.LogStdout("\n")
+	return nil
+}
+
+func (n *NodeInspector) findRecording(logID string) (*log.ResultLogEntry, error) {
+	rl, err := n.ResultLog()
+	if err == log.ErrResultLogNotFound {
+		return nil, errNoRecording
+	} else if err != nil {
+		return nil, err
+	}
+
+	if logID != "" {
+		entry, err := rl.Find(logID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", logID, err)
+		}
+		if entry.CastFile == "" {
+			return nil, fmt.Errorf("%s: %w", logID, errNoRecording)
+		}
+		return entry, nil
+	}
+
+	blockID := n.currentBlock().block.ID
+	var found *log.ResultLogEntry
+	if err := rl.Each(func(_ int, entry *log.ResultLogEntry) bool {
+		if entry.BlockID == blockID && entry.CastFile != "" {
+			found = entry
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errNoRecording
+	}
+	return found, nil
+}
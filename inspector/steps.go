@@ -0,0 +1,95 @@
+package inspector
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// stepResult records the outcome of a code block run by continue or until
+type stepResult struct {
+	cb       *codeBlock
+	success  bool
+	duration time.Duration
+}
+
+// runSteps runs the code blocks from the current position up to and including
+// the block at stop. It stops at the first block that fails and leaves the
+// position on it, otherwise the position is moved past the last block run.
+// If useBreaks is set, it also stops before a block with a breakpoint (other
+// than the block it starts at).
+func (n *NodeInspector) runSteps(stop int, useBreaks bool) []*stepResult {
+	results := []*stepResult{}
+	var node *graph.Node
+	for n.codeBlockPos <= stop {
+		cb := n.currentBlock()
+		if useBreaks && len(results) > 0 && n.hasBreakpoint(cb) {
+			tools.LogStdout("Stopped at the breakpoint at step %d of %d\n", n.codeBlockPos+1, len(n.codeBlocks))
+			break
+		}
+		// the blocks of an included or linked file are run as they are, show which content that is
+		if cb.node != node && cb.node != n.runner.Root {
+			tools.LogStdout("Running %s sha256 %s\n", cb.node.Metadata.SourceURI, cb.node.Metadata.SHA256)
+		}
+		node = cb.node
+		tools.LogStdout("[Step %d of %d] ", n.codeBlockPos+1, len(n.codeBlocks))
+		startedAt := time.Now()
+		success := cb.RunBlock()
+		results = append(results, &stepResult{
+			cb:       cb,
+			success:  success,
+			duration: time.Since(startedAt),
+		})
+		if !success || n.codeBlockPos == len(n.codeBlocks)-1 {
+			break
+		}
+		n.codeBlockPos++
+	}
+	return results
+}
+
+// parseStep converts a 1-based step number to a position in the code block list
+func (n *NodeInspector) parseStep(arg string) (int, error) {
+	step, err := strconv.Atoi(arg)
+	if err != nil || step < 1 || step > len(n.codeBlocks) {
+		return 0, fmt.Errorf("invalid step %s, expected a number between 1 and %d", arg, len(n.codeBlocks))
+	}
+	return step - 1, nil
+}
+
+func stepsFailed(results []*stepResult) bool {
+	return len(results) > 0 && !results[len(results)-1].success
+}
+
+func renderStepSummary(results []*stepResult, nBlocks int) {
+	if len(results) == 0 {
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleBold)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Step", "Block", "Result", "Duration"})
+	completed := 0
+	for _, r := range results {
+		result := "\U00002705 completed"
+		if r.success {
+			completed++
+		} else {
+			result = "\U0000274C failed"
+		}
+		t.AppendRow(table.Row{
+			fmt.Sprintf("%d of %d", r.cb.Index()+1, nBlocks),
+			r.cb.Block().ID,
+			result,
+			r.duration.Round(time.Millisecond),
+		})
+	}
+	t.AppendFooter(table.Row{"", "", fmt.Sprintf("%d of %d completed", completed, len(results)), ""})
+	t.Render()
+}
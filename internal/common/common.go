@@ -51,8 +51,12 @@ func GetServiceURL(entry *config.Entry) string {
 	return serviceURL
 }
 
-// GetNodeURL returns the URL representation of this node ID
+// GetNodeURL returns the URL representation of this node ID, which is the ID
+// itself, e.g. the path of a markdown file, if there is no dashboard
 func GetNodeURL(entry *config.Entry, nodeID string) *url.URL {
+	if entry.DashboardUrl == "" {
+		return &url.URL{Path: nodeID}
+	}
 	u, err := url.Parse(entry.DashboardUrl)
 	if err != nil {
 		return nil
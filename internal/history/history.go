@@ -7,7 +7,10 @@ import (
 	"path/filepath"
 )
 
-var HistoryDir = tools.MyPathTo("history")
+// HistoryDir returns the directory the command histories are kept in
+func HistoryDir() string {
+	return tools.StatePath("history")
+}
 
 type History interface {
 	// GetAll retrieves all the items and returns only the commands as a string slice
@@ -2,6 +2,7 @@ package markdown
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/yuin/goldmark/ast"
@@ -107,19 +108,21 @@ func (cr *chunkRenderer) split(w util.BufWriter, source []byte, mdNode ast.Node,
 
 	var start, stop int
 	var language string
+	var fenceParams map[string]string
 	var descChunk *string
 
 	if mdNode.Type() == ast.TypeBlock {
-		lines := mdNode.Lines()
-		if lines.Len() > 0 {
-			start = eatSpace(lines.At(0).Start-1, source)
-			stop = lines.At(lines.Len() - 1).Stop
-		} else {
+		var ok bool
+		if start, stop, ok = CodeChunkBounds(source, mdNode); !ok {
 			// ignore empty code blocks since there's nothing to execute
 			return ast.WalkContinue, nil
 		}
 		if mdNode.Kind() == ast.KindFencedCodeBlock {
-			language = string(mdNode.(*ast.FencedCodeBlock).Language(source))
+			fcb := mdNode.(*ast.FencedCodeBlock)
+			language = string(fcb.Language(source))
+			if fcb.Info != nil {
+				fenceParams = parseFenceParams(string(fcb.Info.Segment.Value(source)))
+			}
 		}
 	} else {
 		textNode := mdNode.FirstChild().(*ast.Text)
@@ -155,7 +158,7 @@ func (cr *chunkRenderer) split(w util.BufWriter, source []byte, mdNode ast.Node,
 		language = codeContentType
 	}
 
-	contentType := extractContentType(chunk, language)
+	contentType := extractContentType(chunk, language, fenceParams)
 
 	err := cr.handler(chunk, CodeChunk, contentType)
 	if err != nil {
@@ -178,6 +181,42 @@ func (cr *chunkRenderer) finish() error {
 	return nil
 }
 
+var fenceParamRE = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// parseFenceParams returns the parameters following the language in a fence's
+// info string, e.g. ```bash break disable-pty=true. A parameter without a
+// value is set to "true".
+func parseFenceParams(info string) map[string]string {
+	fields := strings.Fields(info)
+	if len(fields) < 2 {
+		return nil
+	}
+
+	params := map[string]string{}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if !fenceParamRE.MatchString(kv[0]) {
+			continue
+		}
+		if len(kv) == 1 {
+			params[kv[0]] = "true"
+		} else {
+			params[kv[0]] = kv[1]
+		}
+	}
+	return params
+}
+
+// CodeChunkBounds returns the start and stop offsets in source of the code chunk
+// of a code block, false if the code block is empty
+func CodeChunkBounds(source []byte, mdNode ast.Node) (start, stop int, ok bool) {
+	lines := mdNode.Lines()
+	if lines.Len() == 0 {
+		return 0, 0, false
+	}
+	return eatSpace(lines.At(0).Start-1, source), lines.At(lines.Len() - 1).Stop, true
+}
+
 func eatSpace(pos int, source []byte) int {
 	for ; pos > 0; pos-- {
 		if source[pos] == ' ' || source[pos] == '\t' {
@@ -59,17 +59,23 @@ func extractPromptCommand(content string) *promptCommand {
 	}
 }
 
-func extractContentType(content, language string) string {
+func extractContentType(content, language string, fenceParams map[string]string) string {
 	typeSubtype := "text/" + language
 
+	params := map[string]string{}
+	for k, v := range fenceParams {
+		params[k] = v
+	}
+
 	pc := extractPromptCommand(content)
 	if pc == nil {
-		return typeSubtype
+		if len(params) == 0 {
+			return typeSubtype
+		}
+		return mime.FormatMediaType(typeSubtype, params)
 	}
 
-	params := map[string]string{
-		"command": pc.command.String(),
-	}
+	params["command"] = pc.command.String()
 
 	prompt := pc.prompt.String()
 	if pc.isAssign {
@@ -2,11 +2,10 @@ package main
 
 import (
 	_ "embed"
-	"fmt"
 	"github.com/1xyz/pryrite/app"
 	"github.com/1xyz/pryrite/mdtools/cmd"
-	"github.com/1xyz/pryrite/tools"
 	"os"
+	"strings"
 )
 
 var (
@@ -15,18 +14,17 @@ var (
 )
 
 func main() {
-	app.Version = version
-	wr, err := tools.OpenLogger(true)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "tools.OpenLogger err = %v", err)
-		os.Exit(1)
-	}
-	defer func() {
-		if err := wr.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "wr.close %v", err)
-		}
-	}()
+	os.Exit(run())
+}
 
-	// Don't handle error will be handled by cobra
-	cmd.Execute()
+func run() int {
+	// version.txt ends with a newline, which is not allowed in the User-Agent header
+	app.Version = strings.TrimSpace(version)
+
+	// The logger is opened once the flags are parsed, as --data-dir chooses where
+	// the activity log is kept. The error is reported by cobra, only set the exit status
+	if err := cmd.Execute(); err != nil {
+		return 1
+	}
+	return 0
 }
@@ -3,18 +3,74 @@ package cmd
 import (
 	"fmt"
 	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
 	"github.com/1xyz/pryrite/mdtools/markdown"
 	"github.com/1xyz/pryrite/tools"
 	"github.com/spf13/cobra"
+	"io"
+	"os"
 )
 
+// logCloser closes the activity log, once it is opened after the flags are parsed
+var logCloser io.Closer
+
 func NewCmdRoot() *cobra.Command {
+	var profile, dataDir string
+	var overrides []string
+	var readOnly bool
 	var rootCmd = &cobra.Command{
 		Version:      app.Version,
 		Use:          app.Name,
 		Short:        fmt.Sprintf("%s is a markdown executor", app.Name),
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if dataDir != "" {
+				tools.SetDataDir(dataDir)
+			}
+			if readOnly {
+				config.SetReadOnly(true)
+			}
+			var migration *tools.Migration
+			if !config.IsReadOnly() {
+				m, err := tools.PrepareAppDirs()
+				if err != nil {
+					return err
+				}
+				migration = m
+			}
+			wr, err := tools.OpenLogger(true, config.IsReadOnly())
+			if err != nil {
+				return fmt.Errorf("tools.OpenLogger err = %v", err)
+			}
+			logCloser = wr
+			if migration != nil {
+				migration.Log()
+			}
+			if err := config.SetOverrides(overrides); err != nil {
+				return err
+			}
+			if profile == "" {
+				return nil
+			}
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			if _, ok := cfg.Get(profile); !ok {
+				return fmt.Errorf("profile %s not found, see %s config list", profile, app.Name)
+			}
+			config.SetProfile(profile)
+			return nil
+		},
 	}
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "",
+		"Name of the configuration entry to use rather than the default")
+	rootCmd.PersistentFlags().StringArrayVar(&overrides, "set", nil,
+		"Override a value of the configuration entry in use, as key=value, see config set --help for the keys")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false,
+		"Never create or write the configuration file")
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "",
+		"Directory to keep the configuration, state and cache in, rather than "+tools.DataDirEnv+" or the XDG directories")
 
 	var versionCmd = &cobra.Command{
 		Use:   "version",
@@ -25,26 +81,81 @@ func NewCmdRoot() *cobra.Command {
 		},
 	}
 
+	openOpts := &markdown.OpenOptions{}
 	var execCmd = &cobra.Command{
 		Use:   "open",
 		Short: "open a markdown file to inspect",
-		Args:  minArgs(1, "You need to specify a local or http(s) URL to a markdown file"),
-		Example: fmt.Sprintf(" %s open _examples/hello_world.md\n %s open https://raw.githubusercontent.com/1xyz/pryrite/main/_examples/hello-world.md\n",
-			app.Name, app.Name),
+		Long: "open a markdown file to inspect. The file is a local path, an http(s) URL or\n" +
+			"repo@ref:path to open the file as of a commit, branch or tag of a local git repository",
+		Args: minArgs(1, "You need to specify a local or http(s) URL to a markdown file"),
+		Example: fmt.Sprintf(" %s open _examples/hello_world.md\n %s open https://raw.githubusercontent.com/1xyz/pryrite/main/_examples/hello-world.md\n %s open .@v0.1.0:_examples/hello-world.md\n",
+			app.Name, app.Name, app.Name),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			tools.LogStdout("execute filename=%s\n", args[0])
 			filename := args[0]
-			return markdown.MDFileInspect(filename)
+			return markdown.MDFileInspect(filename, openOpts)
 		},
 	}
+	addOpenFlags(execCmd, openOpts)
 
 	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(newRunCmd())
+	rootCmd.AddCommand(newSecretsCmd())
+	rootCmd.AddCommand(newLogsCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newLsCmd())
+	rootCmd.AddCommand(newSearchCmd())
+	rootCmd.AddCommand(newSnippetCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newSyncCmd())
+	rootCmd.AddCommand(newLoginCmd())
+	rootCmd.AddCommand(newLogoutCmd())
+	rootCmd.AddCommand(newConfigCmd())
 	rootCmd.AddCommand(versionCmd)
 	return rootCmd
 }
 
+func newRunCmd() *cobra.Command {
+	var allow bool
+	openOpts := &markdown.OpenOptions{}
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "run all code blocks in a markdown file without user interaction",
+		Long: "run all code blocks in a markdown file without user interaction, stopping at the first failure.\n" +
+			"Blocks matching the execution policy (sudo, rm -rf, curl | sh etc.) are refused unless --allow is passed",
+		Args: minArgs(1, "You need to specify a local or http(s) URL to a markdown file"),
+		Example: fmt.Sprintf(" %s run _examples/hello_world.md\n %s run --allow _examples/hello_world.md\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools.LogStdout("run filename=%s\n", args[0])
+			return markdown.MDFileRun(args[0], openOpts, allow)
+		},
+	}
+	cmd.Flags().BoolVar(&allow, "allow", false,
+		"Allow blocks that violate the execution policy to run")
+	addOpenFlags(cmd, openOpts)
+	return cmd
+}
+
+func addOpenFlags(cmd *cobra.Command, opts *markdown.OpenOptions) {
+	cmd.Flags().StringVar(&opts.SHA256, "sha256", "",
+		"Refuse the markdown file unless its content matches this sha256 hash")
+	cmd.Flags().StringVar(&opts.Signature, "signature", "",
+		"Path or URL to a detached (minisign or ed25519) signature verified against the configured trusted_keys")
+	cmd.Flags().BoolVar(&opts.Offline, "offline", false,
+		"Use the locally cached copy of a remote markdown file without fetching it")
+}
+
 func Execute() error {
 	rootCmd := NewCmdRoot()
+	defer func() {
+		if logCloser == nil {
+			return
+		}
+		if err := logCloser.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "wr.close %v", err)
+		}
+	}()
 	return rootCmd.Execute()
 }
 
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/auth"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "manage the configuration entries",
+		Long: "manage the configuration entries in pryrite.yaml, in the directory listed by config dirs. The default\n" +
+			"entry is used unless another one is chosen with --profile",
+	}
+	cmd.AddCommand(newConfigListCmd())
+	cmd.AddCommand(newConfigShowCmd())
+	cmd.AddCommand(newConfigAddCmd())
+	cmd.AddCommand(newConfigUseCmd())
+	cmd.AddCommand(newConfigSetCmd())
+	cmd.AddCommand(newConfigRmCmd())
+	cmd.AddCommand(newConfigDirsCmd())
+	return cmd
+}
+
+func newConfigListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "list the configuration entries, the one in use is marked with *",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			t := table.NewWriter()
+			t.SetStyle(table.StyleBold)
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"", "Name", "Mode", "Service URL"})
+			for _, e := range cfg.Entries {
+				active := ""
+				if e.Name == cfg.ActiveEntry() {
+					active = "*"
+				}
+				mode := e.Mode
+				if mode == "" {
+					mode = config.ModeRemote
+				}
+				t.AppendRow(table.Row{active, e.Name, mode, e.ServiceUrl})
+			}
+			t.Render()
+			return nil
+		},
+	}
+}
+
+func newConfigShowCmd() *cobra.Command {
+	var effective bool
+	cmd := &cobra.Command{
+		Use:   "show [name]",
+		Short: "show a configuration entry, the one in use if no name is given",
+		Long: "show a configuration entry, the one in use if no name is given. With --effective the values of\n" +
+			"the entry in use are listed with where they are from: the file, an environment variable or a --set flag",
+		Args: cobra.MaximumNArgs(1),
+		Example: fmt.Sprintf(" %s config show staging\n PRYRITE_EXECUTION_TIMEOUT=1m %s config show --effective\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if effective {
+				if name != "" {
+					return fmt.Errorf("--effective shows the entry in use, choose it with --profile")
+				}
+				return showEffective()
+			}
+			entry, err := config.GetEntry(name)
+			if err != nil {
+				return err
+			}
+			b, err := yaml.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("%s", b)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&effective, "effective", false, "Show the values in use and where they are from")
+	return cmd
+}
+
+func showEffective() error {
+	cfg, err := config.Default()
+	if err != nil {
+		return err
+	}
+	entry, ok := cfg.GetDefaultEntry()
+	if !ok {
+		return fmt.Errorf("there is no default configuration. See config use --help")
+	}
+	tools.LogStdout("entry %s\n", entry.Name)
+	t := table.NewWriter()
+	t.SetStyle(table.StyleBold)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Key", "Value", "Origin", "Environment"})
+	for _, f := range config.Fields {
+		origin, source := cfg.Origin(f.Name)
+		if source != "" {
+			origin = fmt.Sprintf("%s (%s)", origin, source)
+		}
+		env := config.EnvName(f.Name)
+		if !f.Overridable() {
+			env = "(file only)"
+		}
+		t.AppendRow(table.Row{f.Name, f.Get(entry), origin, env})
+	}
+	t.Render()
+	return nil
+}
+
+func newConfigAddCmd() *cobra.Command {
+	var serviceURL, mode string
+	var use bool
+	cmd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "add a configuration entry",
+		Args:  minArgs(1, "You need to specify the name of the entry"),
+		Example: fmt.Sprintf(" %s config add staging --service-url https://pryrite.example.com --use\n %s config add offline --mode local\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := strings.TrimSpace(args[0])
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			previous := cfg.DefaultEntry
+			if err := cfg.Add(name, ""); err != nil {
+				return err
+			}
+			entry, _ := cfg.Get(name)
+			for field, value := range map[string]string{"service_url": serviceURL, "mode": mode} {
+				f, _ := config.GetField(field)
+				if err := f.Set(entry, value); err != nil {
+					return err
+				}
+			}
+			// Add makes the new entry the default
+			if !use && previous != "" {
+				cfg.DefaultEntry = previous
+			}
+			if err := cfg.SaveFile(config.DefaultConfigFile()); err != nil {
+				return err
+			}
+			tools.LogStdout("added %s\n", name)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&serviceURL, "service-url", "", "http(s) URL of the service")
+	cmd.Flags().StringVar(&mode, "mode", "", "Where snippets are kept: remote or local")
+	cmd.Flags().BoolVar(&use, "use", false, "Make the entry the default")
+	return cmd
+}
+
+func newConfigUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use <name>",
+		Short: "make a configuration entry the default",
+		Args:  minArgs(1, "You need to specify the name of the entry"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			if err := cfg.SetDefault(args[0]); err != nil {
+				return err
+			}
+			if err := cfg.SaveFile(config.DefaultConfigFile()); err != nil {
+				return err
+			}
+			tools.LogStdout("%s is the default\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newConfigSetCmd() *cobra.Command {
+	sb := &strings.Builder{}
+	for _, f := range config.Fields {
+		fmt.Fprintf(sb, "  %-34s %s\n", f.Name, f.Usage)
+	}
+	return &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "set a value of the configuration entry in use, an empty value unsets it",
+		Long: "set a value of the configuration entry in use, or the one chosen with --profile.\n" +
+			"An empty value unsets it. The keys are:\n\n" + sb.String(),
+		Args: minArgs(2, "You need to specify a key and a value"),
+		Example: fmt.Sprintf(" %s config set execution_timeout 10m\n %s --profile staging config set service_url https://pryrite.example.com\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, ok := config.GetField(args[0])
+			if !ok {
+				return fmt.Errorf("unknown key %s, see config set --help", args[0])
+			}
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			entry, ok := cfg.GetDefaultEntry()
+			if !ok {
+				return fmt.Errorf("there is no default configuration. See config use --help")
+			}
+			if err := cfg.SetField(entry, f, strings.Join(args[1:], " ")); err != nil {
+				return err
+			}
+			if err := cfg.SaveFile(config.DefaultConfigFile()); err != nil {
+				return err
+			}
+			if origin, source := cfg.Origin(f.Name); origin == config.OriginEnv || origin == config.OriginFlag {
+				tools.LogStdout("%s: %s is saved, it is overridden by %s\n", entry.Name, f.Name, source)
+				return nil
+			}
+			tools.LogStdout("%s: %s = %s\n", entry.Name, f.Name, f.Get(entry))
+			return nil
+		},
+	}
+}
+
+func newConfigRmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <name>",
+		Short: "remove a configuration entry and its login",
+		Args:  minArgs(1, "You need to specify the name of the entry"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			cfg, err := config.Default()
+			if err != nil {
+				return err
+			}
+			if err := cfg.Del(name); err != nil {
+				return err
+			}
+			if err := cfg.SaveFile(config.DefaultConfigFile()); err != nil {
+				return err
+			}
+			if _, err := auth.NewCredentials(auth.DefaultCredentialsFile()).Delete(name); err != nil {
+				tools.Log.Err(err).Msgf("config rm: removing the login of %s", name)
+			}
+			tools.LogStdout("removed %s\n", name)
+			if cfg.DefaultEntry == "" && len(cfg.Entries) > 0 {
+				tools.LogStdout("there is no default entry now, choose one with %s config use <name>\n", app.Name)
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigDirsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "dirs",
+		Short: "list the directories the configuration, state and cache are kept in",
+		Long: "list the directories the configuration, state and cache are kept in. They follow the XDG base\n" +
+			"directories ($XDG_CONFIG_HOME, $XDG_STATE_HOME and $XDG_CACHE_HOME), unless --data-dir or\n" +
+			tools.DataDirEnv + " names one directory to keep all of them in",
+		Args:    cobra.NoArgs,
+		Example: fmt.Sprintf(" %s config dirs\n %s --data-dir ./.pryrite config dirs\n", app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dirs, err := tools.AppDirs()
+			if err != nil {
+				return err
+			}
+			t := table.NewWriter()
+			t.SetStyle(table.StyleBold)
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Kind", "Directory"})
+			t.AppendRow(table.Row{"config", dirs.Config})
+			t.AppendRow(table.Row{"state", dirs.State})
+			t.AppendRow(table.Row{"cache", dirs.Cache})
+			t.Render()
+			tools.LogStdout("chosen by %s\n", dirs.Source)
+			return nil
+		},
+	}
+}
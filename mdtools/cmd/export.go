@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/mdtools/markdown"
+	"github.com/1xyz/pryrite/report"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd() *cobra.Command {
+	var format, output string
+	cmd := &cobra.Command{
+		Use:   "export <markdown-file> [execution-id]",
+		Short: "export an execution of a markdown file as an HTML or markdown report",
+		Long: "export an execution of a markdown file as a self-contained HTML or markdown report.\n" +
+			"Each code block is followed by its output, exit status and time of execution from the result log.\n" +
+			"The most recent execution is exported if no execution ID is given",
+		Args: minArgs(1, "You need to specify a markdown file"),
+		Example: fmt.Sprintf(" %s export _examples/hello-world.md -o report.html\n %s export _examples/hello-world.md <execution-id> --format md\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 2 {
+				return fmt.Errorf("expected a markdown file and an optional execution ID")
+			}
+			var executionID string
+			if len(args) > 1 {
+				executionID = args[1]
+			}
+			if !cmd.Flags().Changed("format") && strings.EqualFold(filepath.Ext(output), ".md") {
+				format = string(report.FormatMarkdown)
+			}
+
+			w := os.Stdout
+			if output != "" {
+				f, err := tools.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+				if err != nil {
+					return err
+				}
+				defer tools.CloseFile(f)
+				w = f
+			}
+			return markdown.MDFileExport(args[0], executionID, report.Format(format), w)
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", string(report.FormatHTML),
+		"Format of the report, html or md. Defaults to md if the output file ends with .md")
+	cmd.Flags().StringVarP(&output, "output", "o", "",
+		"Write the report to this file rather than stdout")
+	return cmd
+}
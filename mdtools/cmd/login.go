@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/auth"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/spf13/cobra"
+)
+
+func newLoginCmd() *cobra.Command {
+	var withToken bool
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "log in to the service of the configuration entry in use",
+		Long: "log in to the service of the configuration entry in use, or the one chosen with --profile, with a code\n" +
+			"entered in the browser. The token is kept in credentials.json, in the directory listed by config dirs,\n" +
+			"and refreshed when it expires. With --with-token a token, e.g. the one of " + app.Name + " serve, is read\n" +
+			"from stdin instead",
+		Args: cobra.NoArgs,
+		Example: fmt.Sprintf(" %s login\n %s --profile staging login\n echo $TOKEN | %s login --with-token\n",
+			app.Name, app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry, err := config.GetEntry("")
+			if err != nil {
+				return err
+			}
+			creds := auth.NewCredentials(auth.DefaultCredentialsFile())
+
+			if withToken {
+				b, err := ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				token := strings.TrimSpace(string(b))
+				if token == "" {
+					return fmt.Errorf("the token is empty")
+				}
+				if err := creds.Put(entry.Name, &auth.Token{AccessToken: token}); err != nil {
+					return err
+				}
+				tools.LogStdout("stored the token of %s\n", entry.Name)
+				return nil
+			}
+
+			httpClient := http.DefaultClient
+			if entry.SkipSSLCheck {
+				httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+			}
+			client, err := auth.NewClient(entry, httpClient)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			dc, err := client.RequestDeviceCode(ctx)
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("Open %s and enter the code %s\n", dc.VerificationURI, dc.UserCode)
+			if dc.VerificationURIComplete != "" {
+				tools.LogStdout("or open %s\n", dc.VerificationURIComplete)
+			}
+			tools.LogStdout("Waiting for the login to be confirmed...\n")
+			t, err := client.PollToken(ctx, dc)
+			if err != nil {
+				return err
+			}
+			if err := creds.Put(entry.Name, t); err != nil {
+				return err
+			}
+			tools.LogStdout("logged in to %s (%s)\n", entry.Name, entry.ServiceUrl)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&withToken, "with-token", false, "Read a token from stdin rather than logging in with a code")
+	return cmd
+}
+
+func newLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "remove the login of the configuration entry in use, or the one chosen with --profile",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry, err := config.GetEntry("")
+			if err != nil {
+				return err
+			}
+			found, err := auth.NewCredentials(auth.DefaultCredentialsFile()).Delete(entry.Name)
+			if err != nil {
+				return err
+			}
+			if !found {
+				tools.LogStdout("%s is not logged in\n", entry.Name)
+				return nil
+			}
+			tools.LogStdout("logged out of %s\n", entry.Name)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/1xyz/pryrite/mdtools/markdown"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+func newLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "inspect the result logs of executed code blocks",
+	}
+	cmd.AddCommand(newLogsDiffCmd())
+	cmd.AddCommand(newLogsSearchCmd())
+	cmd.AddCommand(newLogsReindexCmd())
+	cmd.AddCommand(newLogsGCCmd())
+	cmd.AddCommand(newLogsMigrateCmd())
+	return cmd
+}
+
+type logsSearchOpts struct {
+	NodeID     string
+	BlockID    string
+	ExitStatus string
+	States     []string
+	Since      string
+	Until      string
+	Limit      int
+}
+
+func newLogsSearchCmd() *cobra.Command {
+	opts := &logsSearchOpts{}
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "search the result logs of all markdown files, most recent first",
+		Long: "search the content, output and errors of the result logs of all markdown files.\n" +
+			"Entries containing all the words of the query are shown, most recent first",
+		Example: fmt.Sprintf(" %s logs search connection refused\n %s logs search --state Failed --since 24h\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := opts.filter()
+			if err != nil {
+				return err
+			}
+			results, err := log.NewSearchIndex(log.ResultLogDir()).Search(strings.Join(args, " "), filter, opts.Limit)
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				tools.LogStdout("No log entries found\n")
+				return nil
+			}
+			renderSearchResults(results)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&opts.NodeID, "node", "",
+		"Only show entries of this node ID, e.g. hello-world.md")
+	cmd.Flags().StringVar(&opts.BlockID, "block", "",
+		"Only show entries of this block ID, e.g. hello-world.md/2")
+	cmd.Flags().StringVar(&opts.ExitStatus, "exit-status", "",
+		"Only show entries with this exit status")
+	cmd.Flags().StringSliceVar(&opts.States, "state", nil,
+		"Only show entries in these states (Completed, Failed or Cancel-Requested)")
+	cmd.Flags().StringVar(&opts.Since, "since", "",
+		"Only show entries executed after a duration ago (e.g. 24h) or a date (e.g. 2021-06-30)")
+	cmd.Flags().StringVar(&opts.Until, "until", "",
+		"Only show entries executed before a duration ago (e.g. 1h) or a date (e.g. 2021-06-30)")
+	cmd.Flags().IntVarP(&opts.Limit, "limit", "n", 20,
+		"Limit the number of entries to display, 0 for no limit")
+	return cmd
+}
+
+func (o *logsSearchOpts) filter() (*log.Filter, error) {
+	filter := &log.Filter{
+		NodeID:     o.NodeID,
+		BlockID:    o.BlockID,
+		ExitStatus: o.ExitStatus,
+	}
+	for _, state := range o.States {
+		filter.States = append(filter.States, log.ExecState(state))
+	}
+
+	var err error
+	if filter.Since, err = parseTimeFlag(o.Since); err != nil {
+		return nil, fmt.Errorf("--since: %w", err)
+	}
+	if filter.Until, err = parseTimeFlag(o.Until); err != nil {
+		return nil, fmt.Errorf("--until: %w", err)
+	}
+	return filter, nil
+}
+
+// parseTimeFlag parses a duration before now, a date or an RFC3339 time
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, expected a duration, a date or an RFC3339 time", value)
+}
+
+func renderSearchResults(results []*log.SearchResult) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleBold)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Executed At", "Block", "State", "Exit", "Log ID", "Match"})
+	for _, r := range results {
+		executedAt := "unknown"
+		if r.Entry.ExecutedAt != nil {
+			executedAt = r.Entry.ExecutedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		t.AppendRow(table.Row{
+			executedAt,
+			r.Entry.BlockID,
+			r.Entry.State,
+			r.Entry.ExitStatus,
+			r.Entry.ID,
+			tools.TrimLength(r.Line, 60),
+		})
+	}
+	t.Render()
+}
+
+func newLogsReindexCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reindex",
+		Short: "rebuild the search index of the result logs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := log.Reindex(log.ResultLogDir())
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("indexed %d log entries\n", n)
+			return nil
+		},
+	}
+}
+
+func newLogsDiffCmd() *cobra.Command {
+	var blockID string
+	cmd := &cobra.Command{
+		Use:   "diff <markdown-file> [log-id log-id]",
+		Short: "compare two executions of a code block, defaults to the last two executions",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 && len(args) != 3 {
+				return fmt.Errorf("expected a markdown file optionally followed by two log IDs")
+			}
+			return nil
+		},
+		Example: fmt.Sprintf(" %s logs diff _examples/hello-world.md\n %s logs diff _examples/hello-world.md 5rilqa2m 85g3eooe\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rl, err := getResultLog(args[0])
+			if err != nil {
+				return err
+			}
+			d, err := log.DiffExecutions(rl, blockID, args[1:]...)
+			if err != nil {
+				return err
+			}
+
+			sb := &strings.Builder{}
+			d.Write(sb, tools.IsTermEnabled(int(os.Stdout.Fd())))
+			return tools.Page(sb.String())
+		},
+	}
+	cmd.Flags().StringVarP(&blockID, "block", "b", "",
+		"Compare executions of this block ID, defaults to the most recently executed block")
+	return cmd
+}
+
+func getResultLog(mdFile string) (log.ResultLog, error) {
+	nodeID, err := markdown.NodeIDOf(mdFile)
+	if err != nil {
+		return nil, err
+	}
+	index, err := log.NewResultLogIndex(log.IndexFileSystem)
+	if err != nil {
+		return nil, err
+	}
+	rl, err := index.Get(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mdFile, err)
+	}
+	return rl, nil
+}
+
+func newLogsGCCmd() *cobra.Command {
+	var maxAge time.Duration
+	var maxEntries int
+	var maxBytes int64
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "compact the result logs and remove entries exceeding the retention policy",
+		Long: "compact the result logs and remove entries exceeding the retention policy.\n" +
+			"Queued, started and cancel-requested entries of an execution that has finished are removed.\n" +
+			"The retention policy is read from the result_log configuration, the flags override it",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry, err := config.GetEntry("")
+			if err != nil {
+				return err
+			}
+			policy := log.NewRetentionPolicy(&entry.ResultLog)
+			if cmd.Flags().Changed("max-age") {
+				policy.MaxAge = maxAge
+			}
+			if cmd.Flags().Changed("max-entries") {
+				policy.MaxEntriesPerNode = maxEntries
+			}
+			if cmd.Flags().Changed("max-bytes") {
+				policy.MaxTotalBytes = maxBytes
+			}
+
+			stats, err := log.GC(log.ResultLogDir(), policy)
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("%v\n", stats)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&maxAge, "max-age", 0,
+		"Remove entries older than this, e.g. 720h")
+	cmd.Flags().IntVar(&maxEntries, "max-entries", 0,
+		"Keep at most this many entries for each markdown file")
+	cmd.Flags().Int64Var(&maxBytes, "max-bytes", 0,
+		"Remove the oldest entries until all the result logs fit in this many bytes")
+	return cmd
+}
+
+func newLogsMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "move the result logs stored as a file per entry to journals",
+		Long: "move the result logs stored as a file per entry to journals, a single append-only file per markdown file.\n" +
+			"Set the result_log format to journal in the configuration to create new result logs as journals.\n" +
+			"Close any open sessions before migrating",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats, err := log.Migrate(log.ResultLogDir())
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("%v\n", stats)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/mdtools/markdown"
+	"github.com/spf13/cobra"
+)
+
+const defaultListLimit = 50
+
+func newLsCmd() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "ls [dir]",
+		Short: "list the markdown files in a directory tree, most recently modified first",
+		Args:  cobra.MaximumNArgs(1),
+		Example: fmt.Sprintf(" %s ls\n %s ls docs/ -n 10\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return markdown.MDDirList(dir, limit)
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", defaultListLimit,
+		"Maximum number of files to list, 0 for all")
+	return cmd
+}
+
+func newSearchCmd() *cobra.Command {
+	var dir string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "search the markdown files in a directory tree",
+		Long: "search the markdown files in a directory tree for the words of the query.\n" +
+			"A file matches if every word is in its path, title or content, matches in the path or title come first",
+		Args: minArgs(1, "You need to specify a query"),
+		Example: fmt.Sprintf(" %s search kubectl rollout\n %s search -d docs/ \"restore backup\"\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return markdown.MDDirSearch(dir, strings.Join(args, " "), limit)
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".",
+		"Directory tree to search")
+	cmd.Flags().IntVarP(&limit, "limit", "n", defaultListLimit,
+		"Maximum number of results, 0 for all")
+	return cmd
+}
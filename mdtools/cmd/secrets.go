@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/secrets"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newSecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "manage secrets in the local encrypted secrets file",
+		Long: "manage secrets in the local encrypted secrets file.\n" +
+			"Code blocks refer to secrets as ${secret:name}, these are resolved just before the block is executed",
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <name> [value]",
+		Short: "add or replace a secret, the value is read from stdin if not provided",
+		Args:  minArgs(1, "You need to specify the name of the secret"),
+		Example: fmt.Sprintf(" %s secrets set db_password\n echo -n hunter22 | %s secrets set db_password\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := openSecretsFile()
+			if err != nil {
+				return err
+			}
+			var value string
+			if len(args) > 1 {
+				value = args[1]
+			} else {
+				value, err = readSecretValue(args[0])
+				if err != nil {
+					return err
+				}
+			}
+			if value == "" {
+				return fmt.Errorf("an empty value is not allowed")
+			}
+			return f.Set(args[0], value)
+		},
+	}
+
+	rmCmd := &cobra.Command{
+		Use:   "rm <name>",
+		Short: "remove a secret",
+		Args:  minArgs(1, "You need to specify the name of the secret"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := openSecretsFile()
+			if err != nil {
+				return err
+			}
+			return f.Delete(args[0])
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the names of the secrets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := openSecretsFile()
+			if err != nil {
+				return err
+			}
+			names, err := f.Names()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				tools.LogStdout("%s\n", name)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(setCmd)
+	cmd.AddCommand(rmCmd)
+	cmd.AddCommand(listCmd)
+	return cmd
+}
+
+func openSecretsFile() (*secrets.FileProvider, error) {
+	entry, err := config.GetEntry("")
+	if err != nil {
+		return nil, err
+	}
+	return secrets.OpenFile(&entry.Secrets), nil
+}
+
+func readSecretValue(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if tools.IsTermEnabled(fd) {
+		fmt.Fprintf(os.Stderr, "Enter the value of %s: ", name)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", err
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
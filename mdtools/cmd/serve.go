@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/service"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// serveTokenEnv keeps the token off the command line
+	serveTokenEnv = "PRYRITE_SERVE_TOKEN"
+
+	shutdownTimeout = 10 * time.Second
+)
+
+func newServeCmd() *cobra.Command {
+	var addr, token, db string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "serve the nodes of a local store over the API used by the remote store",
+		Long: "serve the nodes of a local store over the API used by the remote store, so that a team can share\n" +
+			"runbooks and their execution history. Point the service_url of a configuration at the server.\n" +
+			"If a token is set, with --token or " + serveTokenEnv + ", requests have to carry it in their Authorization header",
+		Args: cobra.NoArgs,
+		Example: fmt.Sprintf(" %s serve --addr :8080\n %s=secret %s serve --db /srv/pryrite/store.db\n",
+			app.Name, serveTokenEnv, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if token == "" {
+				token = os.Getenv(serveTokenEnv)
+			}
+			if token == "" {
+				tools.LogStdout("Warning: no token is set, anyone who can reach %s can read and change the nodes\n", addr)
+			}
+			if db == "" {
+				db = config.DefaultLocalStoreFile()
+			}
+
+			srv := &http.Server{
+				Addr:              addr,
+				Handler:           service.New(graph.NewLocalStore(db), token),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+				if err := srv.Shutdown(shutdownCtx); err != nil {
+					tools.Log.Err(err).Msg("serve: shutdown")
+				}
+			}()
+
+			tools.LogStdout("serving %s on %s\n", db, addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "localhost:8080", "Address to listen on")
+	cmd.Flags().StringVar(&token, "token", "", "Token required in the Authorization header of requests")
+	cmd.Flags().StringVar(&db, "db", "", "Path to the database of the store, store.db in the state directory if not set")
+	return cmd
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/inspector"
+	"github.com/1xyz/pryrite/snippet"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/spf13/cobra"
+)
+
+func newSnippetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snippet",
+		Short: "add, find and run snippets",
+		Long: "add, find and run snippets kept in the configured store.\n" +
+			"With mode: local in the configuration, snippets and the results of their execution are kept in a database on this machine",
+	}
+	cmd.AddCommand(newSnippetAddCmd())
+	cmd.AddCommand(newSnippetLsCmd())
+	cmd.AddCommand(newSnippetShowCmd())
+	cmd.AddCommand(newSnippetSearchCmd())
+	cmd.AddCommand(newSnippetOpenCmd())
+	return cmd
+}
+
+func newSnippetContext() (*snippet.Context, error) {
+	cfg, err := config.Default()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cfg.GetDefaultEntry(); !ok {
+		return nil, fmt.Errorf("default not found")
+	}
+	ctx := snippet.NewContext(cfg, fmt.Sprintf("%s:%s", app.Name, app.Version))
+	return ctx, nil
+}
+
+func newSnippetAddCmd() *cobra.Command {
+	var title, lang string
+	cmd := &cobra.Command{
+		Use:   "add [content]",
+		Short: "add a snippet, the content is read from stdin if it is not given",
+		Example: fmt.Sprintf(" %s snippet add -t \"disk usage\" \"du -sh * | sort -h\"\n %s snippet add -l python < script.py\n",
+			app.Name, app.Name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content := strings.Join(args, " ")
+			if len(args) == 0 || content == "-" {
+				b, err := ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				content = strings.TrimSuffix(string(b), "\n")
+			}
+			if strings.TrimSpace(content) == "" {
+				return fmt.Errorf("the snippet is empty")
+			}
+
+			ctx, err := newSnippetContext()
+			if err != nil {
+				return err
+			}
+			n, err := snippet.AddSnippetNode(ctx, title, content, "text/"+lang)
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("added snippet %s\n", n.ID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&title, "title", "t", "", "Title of the snippet")
+	cmd.Flags().StringVarP(&lang, "lang", "l", "shell", "Language of the snippet, e.g. shell or python")
+	return cmd
+}
+
+func newSnippetLsCmd() *cobra.Command {
+	var limit int
+	var kind string
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "list the most recent snippets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, err := newSnippetContext()
+			if err != nil {
+				return err
+			}
+			nodes, err := snippet.GetSnippetNodes(ctx, limit, graph.Kind(kind))
+			if err != nil {
+				return err
+			}
+			return snippet.RenderSnippetNodes(ctx.ConfigEntry, nodes, graph.Kind(kind))
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", defaultListLimit, "Maximum number of snippets to list, 0 for all")
+	cmd.Flags().StringVarP(&kind, "kind", "k", string(graph.Unknown), "Only list snippets of this kind, e.g. Command")
+	return cmd
+}
+
+func newSnippetShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "show a snippet and its children",
+		Args:  minArgs(1, "You need to specify the ID of a snippet"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, err := newSnippetContext()
+			if err != nil {
+				return err
+			}
+			n, err := snippet.GetSnippetNodeWithChildren(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return snippet.RenderSnippetNodeView(ctx.ConfigEntry, n)
+		},
+	}
+}
+
+func newSnippetSearchCmd() *cobra.Command {
+	var limit int
+	var kind string
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "search the snippets",
+		Args:  minArgs(1, "You need to specify a query"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, err := newSnippetContext()
+			if err != nil {
+				return err
+			}
+			nodes, err := snippet.SearchSnippetNodes(ctx, strings.Join(args, " "), limit, graph.Kind(kind))
+			if err != nil {
+				return err
+			}
+			return snippet.RenderSnippetNodes(ctx.ConfigEntry, nodes, graph.Kind(kind))
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", defaultListLimit, "Maximum number of results, 0 for all")
+	cmd.Flags().StringVarP(&kind, "kind", "k", string(graph.Unknown), "Only search snippets of this kind, e.g. Command")
+	return cmd
+}
+
+func newSnippetOpenCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "open <id>",
+		Short: "open a snippet to inspect and run",
+		Args:  minArgs(1, "You need to specify the ID of a snippet"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, err := newSnippetContext()
+			if err != nil {
+				return err
+			}
+			store, err := ctx.GetStore()
+			if err != nil {
+				return err
+			}
+			id, err := store.ExtractID(args[0])
+			if err != nil {
+				return err
+			}
+			return inspector.InspectNode(ctx, id)
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/outbox"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+func newSyncCmd() *cobra.Command {
+	var list bool
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "send the queued updates of the remote store now",
+		Long: "send the queued updates of the remote store of the configuration entry in use now.\n" +
+			"Updates, e.g. the result of executing a block, that fail because the service is unreachable are queued\n" +
+			"and retried in the background. The updates of a node are sent in the order they were made, and only to\n" +
+			"the entry and service they were made for",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ob := outbox.New(config.DefaultOutboxFile())
+			if list {
+				ops, err := ob.Pending()
+				if err != nil {
+					return err
+				}
+				renderOps(ops)
+				return nil
+			}
+
+			entry, err := config.GetEntry("")
+			if err != nil {
+				return err
+			}
+			stats, err := ob.Flush(graph.NewStore(entry, &graph.Metadata{}), outbox.TargetOf(entry), true)
+			if err != nil {
+				return err
+			}
+			tools.LogStdout("%v\n", stats)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&list, "list", "l", false, "List the queued updates rather than sending them")
+	return cmd
+}
+
+func renderOps(ops []*outbox.Op) {
+	if len(ops) == 0 {
+		tools.LogStdout("No queued updates\n")
+		return
+	}
+	t := table.NewWriter()
+	t.SetStyle(table.StyleBold)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Queued At", "Entry", "Node", "Update", "Attempts", "Last Error"})
+	for _, op := range ops {
+		t.AppendRow(table.Row{
+			op.QueuedAt.Local().Format("2006-01-02 15:04:05"),
+			op.Entry,
+			op.NodeID,
+			op.Kind,
+			op.Attempts,
+			tools.TrimLength(op.LastError, 60),
+		})
+	}
+	t.Render()
+}
@@ -1,24 +1,16 @@
 package main
 
 import (
-	"fmt"
-	"github.com/1xyz/pryrite/mdtools/cmd"
-	"github.com/1xyz/pryrite/tools"
 	"os"
+
+	"github.com/1xyz/pryrite/mdtools/cmd"
 )
 
 func main() {
-	wr, err := tools.OpenLogger(true)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "tools.OpenLogger err = %v", err)
+	// The logger is opened once the flags are parsed, as --data-dir and --read-only
+	// choose where and whether the activity log is kept.
+	// The error is reported by cobra, only set the exit status
+	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
-	defer func() {
-		if err := wr.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "wr.close %v", err)
-		}
-	}()
-
-	// Don't handle error will be handled by cobra
-	cmd.Execute()
 }
@@ -0,0 +1,213 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/1xyz/pryrite/tools"
+)
+
+var ErrNotCached = errors.New("not found in the local cache")
+
+// CacheDir returns the directory the copies of remote files are kept in
+func CacheDir() string {
+	return tools.CachePath("cache")
+}
+
+// cacheEntry records the validators of the last response for an URL
+// and the content address of its body
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	SHA256       string    `json:"sha256"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// urlCache is a content-addressed cache of remotely fetched files.
+// The content is stored under blobs/ by its sha256 hash, and the
+// entries under urls/ map an URL to the content's hash.
+type urlCache struct {
+	dir    string
+	client *http.Client
+}
+
+func newURLCache(dir string) (*urlCache, error) {
+	for _, d := range []string{filepath.Join(dir, "blobs"), filepath.Join(dir, "urls")} {
+		if err := tools.EnsureDir(d); err != nil {
+			return nil, err
+		}
+	}
+	return &urlCache{dir: dir, client: http.DefaultClient}, nil
+}
+
+// Fetch returns the path to a local copy of the URL's content. An existing copy is
+// revalidated with the server using the ETag & Last-Modified validators, and used
+// as-is if the server cannot be reached. An error response of the server, e.g. as the
+// file was removed, is returned rather than the copy. If offline is set, only the
+// cache is consulted.
+func (c *urlCache) Fetch(url string, offline bool) (string, error) {
+	entry, err := c.getEntry(url)
+	if err != nil && !errors.Is(err, ErrNotCached) {
+		return "", err
+	}
+
+	if offline {
+		if entry == nil {
+			return "", fmt.Errorf("%s: %w", url, ErrNotCached)
+		}
+		tools.LogStdout("using cached copy of %v fetched at %v\n", url, tools.FmtTime(&entry.FetchedAt))
+		return c.blobPath(entry.SHA256), nil
+	}
+
+	filename, err := c.fetch(url, entry)
+	var netErr *networkError
+	if err != nil && entry != nil && errors.As(err, &netErr) {
+		tools.LogStderr(err, "fetch %v failed, using cached copy fetched at %v: %v\n",
+			url, tools.FmtTime(&entry.FetchedAt), err)
+		return c.blobPath(entry.SHA256), nil
+	}
+	return filename, err
+}
+
+func (c *urlCache) fetch(url string, entry *cacheEntry) (string, error) {
+	tools.LogStdout("fetching from %v\n", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", &networkError{err: err}
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "resp.body.close %v", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		tools.Log.Info().Msgf("urlCache: %s not modified", url)
+		entry.FetchedAt = time.Now().UTC()
+		if err := c.putEntry(entry); err != nil {
+			return "", err
+		}
+		return c.blobPath(entry.SHA256), nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("http get %s status = %v", url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &networkError{err: err}
+	}
+	hash := sha256.Sum256(b)
+	newEntry := &cacheEntry{
+		URL:          url,
+		SHA256:       hex.EncodeToString(hash[:]),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}
+	if err := c.putBlob(newEntry.SHA256, b); err != nil {
+		return "", err
+	}
+	if err := c.putEntry(newEntry); err != nil {
+		return "", err
+	}
+	tools.Log.Info().Msgf("urlCache: %s stored as %s", url, newEntry.SHA256)
+	return c.blobPath(newEntry.SHA256), nil
+}
+
+// networkError is a failure to reach the server, rather than an error response of it
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string { return e.err.Error() }
+func (e *networkError) Unwrap() error { return e.err }
+
+func (c *urlCache) getEntry(url string) (*cacheEntry, error) {
+	b, err := ioutil.ReadFile(c.entryPath(url))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotCached
+		}
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal %s err = %w", c.entryPath(url), err)
+	}
+	// the entry is useless if the content is gone
+	if exists, err := tools.StatExists(c.blobPath(entry.SHA256)); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrNotCached
+	}
+	return &entry, nil
+}
+
+func (c *urlCache) putEntry(entry *cacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.entryPath(entry.URL), b)
+}
+
+func (c *urlCache) putBlob(hash string, b []byte) error {
+	filename := c.blobPath(hash)
+	if exists, err := tools.StatExists(filename); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	return writeFileAtomic(filename, b)
+}
+
+func (c *urlCache) blobPath(hash string) string {
+	return filepath.Join(c.dir, "blobs", hash+".md")
+}
+
+func (c *urlCache) entryPath(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, "urls", hex.EncodeToString(h[:])+".json")
+}
+
+// writeFileAtomic writes to a temporary file that is renamed to the
+// filename, so that readers never observe a partially written file
+func writeFileAtomic(filename string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
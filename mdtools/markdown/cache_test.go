@@ -0,0 +1,140 @@
+package markdown
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLCache_Fetch_Revalidate(t *testing.T) {
+	requests := 0
+	notModified := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(testContent)
+	}))
+	defer ts.Close()
+
+	cache := newTestCache(t)
+	defer os.RemoveAll(cache.dir)
+
+	url := ts.URL + "/docs/README.md"
+	f1, err := cache.Fetch(url, false)
+	assert.Nil(t, err)
+	assertFileContent(t, f1, testContent)
+
+	f2, err := cache.Fetch(url, false)
+	assert.Nil(t, err)
+	assert.Equal(t, f1, f2)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+}
+
+func TestURLCache_Fetch_Offline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent)
+	}))
+
+	cache := newTestCache(t)
+	defer os.RemoveAll(cache.dir)
+
+	url := ts.URL + "/README.md"
+	_, err := cache.Fetch(url, true)
+	assert.True(t, errors.Is(err, ErrNotCached))
+
+	f1, err := cache.Fetch(url, false)
+	assert.Nil(t, err)
+	ts.Close()
+
+	f2, err := cache.Fetch(url, true)
+	assert.Nil(t, err)
+	assert.Equal(t, f1, f2)
+
+	// the server is gone, so fall back to the cached copy
+	f3, err := cache.Fetch(url, false)
+	assert.Nil(t, err)
+	assert.Equal(t, f1, f3)
+}
+
+func TestURLCache_Fetch_Error(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	cache := newTestCache(t)
+	defer os.RemoveAll(cache.dir)
+
+	_, err := cache.Fetch(ts.URL+"/missing.md", false)
+	assert.NotNil(t, err)
+}
+
+func TestExtractIDFromFilePath(t *testing.T) {
+	id, err := ExtractIDFromFilePath("_examples/hello-world.md")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello-world.md", id)
+
+	id1, err := ExtractIDFromFilePath("https://example.com/a/README.md")
+	assert.Nil(t, err)
+	id2, err := ExtractIDFromFilePath("https://example.com/b/README.md")
+	assert.Nil(t, err)
+	assert.NotEqual(t, id1, id2)
+	assert.Regexp(t, `^README\.md-[0-9a-f]{12}$`, id1)
+
+	id3, err := ExtractIDFromFilePath("https://example.com/a/README.md#install")
+	assert.Nil(t, err)
+	assert.Equal(t, id1, id3)
+}
+
+func newTestCache(t *testing.T) *urlCache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		assert.Failf(t, "ioutil.TempDir", "err = %v", err)
+	}
+	cache, err := newURLCache(dir)
+	if err != nil {
+		assert.Failf(t, "newURLCache", "err = %v", err)
+	}
+	return cache
+}
+
+func assertFileContent(t *testing.T, filename string, expected []byte) {
+	actual, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestURLCache_Fetch_Removed(t *testing.T) {
+	removed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if removed {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(testContent)
+	}))
+	defer ts.Close()
+
+	cache := newTestCache(t)
+	defer os.RemoveAll(cache.dir)
+
+	url := ts.URL + "/README.md"
+	_, err := cache.Fetch(url, false)
+	assert.Nil(t, err)
+
+	// the cached copy is not used once the file is removed upstream
+	removed = true
+	_, err = cache.Fetch(url, false)
+	assert.NotNil(t, err)
+	_, err = cache.Fetch(url, true)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,115 @@
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v2"
+)
+
+// frontMatter is the optional YAML block, between --- lines, starting a markdown file
+type frontMatter struct {
+	// Include lists markdown files, relative to the file, run as its children
+	Include []string `yaml:"include"`
+	// Links set to false stops relative links to markdown files being followed
+	Links *bool `yaml:"links"`
+}
+
+// childRef is a markdown file referenced by another
+type childRef struct {
+	file string
+	// included files are required, linked files are skipped if missing
+	included bool
+}
+
+// findChildFiles returns the markdown files included by the front matter of the
+// markdown, followed by the markdown files it links to, in order and without
+// duplicates. Relative paths are resolved against dir.
+func findChildFiles(md, dir string) ([]*childRef, error) {
+	fm, body, err := parseFrontMatter(md)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*childRef{}
+	seen := map[string]bool{}
+	add := func(ref string, included bool) {
+		file := filepath.Join(dir, filepath.FromSlash(ref))
+		if seen[file] {
+			return
+		}
+		seen[file] = true
+		refs = append(refs, &childRef{file: file, included: included})
+	}
+
+	for _, inc := range fm.Include {
+		if filepath.IsAbs(inc) {
+			return nil, fmt.Errorf("include %s: expected a relative path", inc)
+		}
+		add(inc, true)
+	}
+	if fm.Links != nil && !*fm.Links {
+		return refs, nil
+	}
+
+	source := []byte(body)
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+	if err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Kind() != ast.KindLink {
+			return ast.WalkContinue, nil
+		}
+		if ref, ok := relativeMarkdownLink(string(n.(*ast.Link).Destination)); ok {
+			add(ref, false)
+		}
+		return ast.WalkContinue, nil
+	}); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// parseFrontMatter splits the front matter off the markdown
+func parseFrontMatter(md string) (*frontMatter, string, error) {
+	fm := &frontMatter{}
+	if !strings.HasPrefix(md, "---\n") && !strings.HasPrefix(md, "---\r\n") {
+		return fm, md, nil
+	}
+	rest := md[strings.Index(md, "\n")+1:]
+	for offset := 0; offset < len(rest); {
+		end := strings.Index(rest[offset:], "\n")
+		if end < 0 {
+			end = len(rest) - offset
+		} else {
+			end++
+		}
+		line := strings.TrimRight(rest[offset:offset+end], "\r\n")
+		if line == "---" || line == "..." {
+			if err := yaml.Unmarshal([]byte(rest[:offset]), fm); err != nil {
+				return nil, "", fmt.Errorf("front matter: %w", err)
+			}
+			return fm, rest[offset+end:], nil
+		}
+		offset += end
+	}
+	// no closing line, so not front matter
+	return fm, md, nil
+}
+
+// relativeMarkdownLink returns the path of a link to a local markdown file,
+// without its fragment or query
+func relativeMarkdownLink(dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	if path.IsAbs(u.Path) || !strings.EqualFold(path.Ext(u.Path), ".md") {
+		return "", false
+	}
+	return u.Path, true
+}
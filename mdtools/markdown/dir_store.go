@@ -0,0 +1,262 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
+)
+
+// dirStore implements the graph.Store interface over a directory tree of markdown
+// files, e.g. the docs folder of a repository. The ID of a node is the slash
+// separated path of its file relative to the directory.
+type dirStore struct {
+	root string
+
+	lock  sync.Mutex
+	nodes map[string]*dirNode
+}
+
+// dirNode is a loaded markdown file and the modification time it was loaded at
+type dirNode struct {
+	node    *graph.Node
+	modTime time.Time
+}
+
+func NewMDDirStore(dir string) (graph.Store, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &dirStore{root: root, nodes: map[string]*dirNode{}}, nil
+}
+
+// ExtractID returns the ID of a path relative to the directory, or of an
+// absolute path within it
+func (d *dirStore) ExtractID(input string) (string, error) {
+	p := strings.TrimSpace(input)
+	if p == "" {
+		return "", fmt.Errorf("empty id")
+	}
+	if filepath.IsAbs(p) {
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return "", err
+		}
+		p = rel
+	}
+	id := path.Clean(filepath.ToSlash(p))
+	if id == ".." || strings.HasPrefix(id, "../") || path.IsAbs(id) {
+		return "", fmt.Errorf("%s is outside of %s", input, d.root)
+	}
+	return id, nil
+}
+
+// GetNodes returns the most recently modified markdown files, the kind is ignored
+func (d *dirStore) GetNodes(limit int, _ graph.Kind) ([]graph.Node, error) {
+	nodes, err := d.allNodes()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].OccurredAt.After(*nodes[j].OccurredAt)
+	})
+	if limit > 0 && len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return nodes, nil
+}
+
+// GetNode returns the node of the markdown file at the path relative to the directory
+func (d *dirStore) GetNode(id string) (*graph.Node, error) {
+	id, err := d.ExtractID(id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := d.load(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", id, NodeNotFoundErr)
+	}
+	return n, err
+}
+
+func (d *dirStore) AddNode(*graph.Node) (*graph.Node, error) { return nil, UnsupportedErr }
+
+// SearchNodes returns the markdown files containing every word of the query in
+// their path, title or content. Files matching in their path or title come first.
+func (d *dirStore) SearchNodes(query string, limit int, _ graph.Kind) ([]graph.Node, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	nodes, err := d.allNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		node  graph.Node
+		score int
+	}
+	matches := []*match{}
+	for _, n := range nodes {
+		if score := searchScore(&n, terms); score > 0 {
+			matches = append(matches, &match{node: n, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].node.ID < matches[j].node.ID
+	})
+
+	result := []graph.Node{}
+	for _, m := range matches {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		result = append(result, m.node)
+	}
+	return result, nil
+}
+
+// searchScore is 0 unless all terms are found. A term in the path or title counts
+// more than one in the content.
+func searchScore(n *graph.Node, terms []string) int {
+	title := strings.ToLower(n.ID + " " + n.Title)
+	content := strings.ToLower(n.Markdown)
+	score := 0
+	for _, term := range terms {
+		inTitle := strings.Contains(title, term)
+		inContent := strings.Contains(content, term)
+		if !inTitle && !inContent {
+			return 0
+		}
+		if inTitle {
+			score += 10
+		}
+		if inContent {
+			score++
+		}
+	}
+	return score
+}
+
+// GetChildren returns the nodes of the markdown files the parent includes or links
+// to. Files outside of the directory are not followed.
+func (d *dirStore) GetChildren(parentID string) ([]graph.Node, error) {
+	parent, err := d.GetNode(parentID)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := findChildFiles(parent.Markdown, filepath.Dir(d.path(parent.ID)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", parent.ID, err)
+	}
+
+	children := make([]graph.Node, 0, len(refs))
+	for _, ref := range refs {
+		child, err := d.GetNode(ref.file)
+		if err != nil {
+			if ref.included {
+				return nil, fmt.Errorf("%s: include %s: %w", parent.ID, ref.file, err)
+			}
+			tools.Log.Warn().Err(err).Msgf("GetChildren: %s skipping link to %s", parent.ID, ref.file)
+			continue
+		}
+		children = append(children, *child)
+	}
+	return children, nil
+}
+
+func (d *dirStore) UpdateNode(*graph.Node) error                             { return nil }
+func (d *dirStore) UpdateNodeBlockExecution(*graph.Node, *graph.Block) error { return UnsupportedErr }
+
+// UpdateNodeBlock writes the node's blocks back into its markdown file
+func (d *dirStore) UpdateNodeBlock(n *graph.Node, b *graph.Block) error {
+	node, err := d.GetNode(n.ID)
+	if err != nil {
+		return err
+	}
+	return saveNodeBlock(node, d.path(node.ID), b)
+}
+
+func (d *dirStore) path(id string) string {
+	return filepath.Join(d.root, filepath.FromSlash(id))
+}
+
+// load returns the node of the file, reloading it if it was modified since it was loaded
+func (d *dirStore) load(id string) (*graph.Node, error) {
+	file := d.path(id)
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", id)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if dn, ok := d.nodes[id]; ok && dn.modTime.Equal(fi.ModTime()) {
+		return dn.node, nil
+	}
+	n, err := CreateNodeFromMarkdownFile(id, file)
+	if err != nil {
+		return nil, err
+	}
+	modTime := fi.ModTime().UTC()
+	n.OccurredAt = &modTime
+	d.nodes[id] = &dirNode{node: n, modTime: fi.ModTime()}
+	return n, nil
+}
+
+// allNodes loads the markdown files of the directory tree, hidden directories
+// and node_modules are skipped
+func (d *dirStore) allNodes() ([]graph.Node, error) {
+	nodes := []graph.Node{}
+	err := filepath.WalkDir(d.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if p != d.root && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(name), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		n, err := d.load(filepath.ToSlash(rel))
+		if err != nil {
+			tools.Log.Warn().Err(err).Msgf("allNodes: skipping %s", p)
+			return nil
+		}
+		nodes = append(nodes, *n)
+		return nil
+	})
+	return nodes, err
+}
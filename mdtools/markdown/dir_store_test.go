@@ -0,0 +1,123 @@
+package markdown
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDirStore(t *testing.T, files map[string]string) (graph.Store, string) {
+	dir, err := ioutil.TempDir("", "mdtools")
+	if err != nil {
+		t.FailNow()
+	}
+	modTime := time.Now().Add(-time.Hour)
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0700))
+		assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+		// the files are listed most recently modified first
+		modTime = modTime.Add(time.Minute)
+		assert.Nil(t, os.Chtimes(file, modTime, modTime))
+	}
+	store, err := NewMDDirStore(dir)
+	if err != nil {
+		t.FailNow()
+	}
+	return store, dir
+}
+
+func ids(nodes []graph.Node) []string {
+	result := []string{}
+	for _, n := range nodes {
+		result = append(result, n.ID)
+	}
+	return result
+}
+
+func TestDirStore_GetNodes(t *testing.T) {
+	store, dir := newTestDirStore(t, map[string]string{
+		"ops/deploy.md":         "# Deploy\n```shell\nkubectl apply -f deploy.yaml\n```\n",
+		".git/x.md":             "# Hidden\n",
+		"node_modules/y/doc.md": "# Vendored\n",
+		"notes.txt":             "not markdown",
+	})
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Readme\n"), 0600))
+
+	nodes, err := store.GetNodes(0, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"README.md", "ops/deploy.md"}, ids(nodes))
+
+	nodes, err = store.GetNodes(1, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"README.md"}, ids(nodes))
+}
+
+func TestDirStore_GetNode(t *testing.T) {
+	store, dir := newTestDirStore(t, map[string]string{
+		"ops/deploy.md": "# Deploy\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for _, id := range []string{"ops/deploy.md", "./ops/deploy.md", "ops/../ops/deploy.md",
+		filepath.Join(dir, "ops", "deploy.md")} {
+		n, err := store.GetNode(id)
+		if assert.Nil(t, err, id) {
+			assert.Equal(t, "ops/deploy.md", n.ID)
+			assert.Equal(t, "Deploy", n.Title)
+		}
+	}
+
+	_, err := store.GetNode("ops/missing.md")
+	assert.True(t, errors.Is(err, NodeNotFoundErr))
+	_, err = store.GetNode("../outside.md")
+	assert.NotNil(t, err)
+}
+
+func TestDirStore_SearchNodes(t *testing.T) {
+	store, dir := newTestDirStore(t, map[string]string{
+		"ops/deploy.md":  "# Deploy\n```shell\nkubectl rollout status deploy/web\n```\n",
+		"ops/restore.md": "# Restore a backup\nThen check the deploy with kubectl.\n",
+		"intro.md":       "# Intro\n",
+	})
+	defer os.RemoveAll(dir)
+
+	nodes, err := store.SearchNodes("DEPLOY kubectl", 0, graph.Unknown)
+	assert.Nil(t, err)
+	// a match in the title ranks first
+	assert.Equal(t, []string{"ops/deploy.md", "ops/restore.md"}, ids(nodes))
+
+	nodes, err = store.SearchNodes("backup", 0, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ops/restore.md"}, ids(nodes))
+
+	nodes, err = store.SearchNodes("kubectl nothing", 0, graph.Unknown)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 0)
+
+	_, err = store.SearchNodes(" ", 0, graph.Unknown)
+	assert.NotNil(t, err)
+}
+
+func TestDirStore_GetChildren(t *testing.T) {
+	store, dir := newTestDirStore(t, map[string]string{
+		"index.md":      "# Index\n[deploy](ops/deploy.md) [outside](../other.md)\n",
+		"ops/deploy.md": "# Deploy\n[back](../index.md)\n",
+	})
+	defer os.RemoveAll(dir)
+
+	children, err := store.GetChildren("index.md")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ops/deploy.md"}, ids(children))
+
+	children, err = store.GetChildren("ops/deploy.md")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"index.md"}, ids(children))
+}
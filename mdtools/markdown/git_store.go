@@ -0,0 +1,229 @@
+package markdown
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/1xyz/pryrite/graph"
+)
+
+// GitRef refers to a markdown file at a revision of a local git repository,
+// written as repo@ref:path, e.g. ~/src/ops@v1.2.0:runbooks/deploy.md
+type GitRef struct {
+	// Repo is the directory of the local clone
+	Repo string
+	// Ref is a commit, branch or tag
+	Ref string
+	// Path is the slash separated path of the file relative to the root of the repository
+	Path string
+}
+
+func (g *GitRef) String() string {
+	return fmt.Sprintf("%s@%s:%s", g.Repo, g.Ref, g.Path)
+}
+
+// NodeID returns the ID of the node of the file. Like the ID of a remote file it is
+// derived from where the file is, the repository and the path, so that it is not the
+// ID of the file in the working tree. All the revisions of the file share the ID,
+// the revision is recorded on each result log entry.
+func (g *GitRef) NodeID() (string, error) {
+	p, err := repoPath(g.Path)
+	if err != nil {
+		return "", err
+	}
+	repo, err := filepath.Abs(g.Repo)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(repo + ":" + p))
+	return fmt.Sprintf("%s-%s", path.Base(p), hex.EncodeToString(hash[:])[:12]), nil
+}
+
+// ParseGitRef parses repo@ref:path, it reports false if s is not of that form or
+// the repo is not a directory
+func ParseGitRef(s string) (*GitRef, bool) {
+	at := strings.Index(s, "@")
+	if at <= 0 {
+		return nil, false
+	}
+	// a ref cannot contain a colon
+	colon := strings.Index(s[at+1:], ":")
+	if colon <= 0 {
+		return nil, false
+	}
+	ref := &GitRef{
+		Repo: s[:at],
+		Ref:  s[at+1 : at+1+colon],
+		Path: s[at+1+colon+1:],
+	}
+	if ref.Path == "" {
+		return nil, false
+	}
+	if fi, err := os.Stat(ref.Repo); err != nil || !fi.IsDir() {
+		return nil, false
+	}
+	return ref, true
+}
+
+// gitStore implements the graph.Store interface over the markdown files of a
+// repository at a single commit. The ref is resolved to the commit when the store
+// is created, so the document and the files it includes or links to are all read
+// at the same revision, which is recorded in the Revision of their metadata.
+type gitStore struct {
+	ref    *GitRef
+	commit string
+	Node   *graph.Node
+
+	// nodes and the paths of their files in the repository by ID
+	nodes map[string]*graph.Node
+	paths map[string]string
+
+	// verified is set when the root file was verified, its children are then not followed
+	verified bool
+}
+
+func NewMDGitStore(id string, ref *GitRef) (graph.Store, error) {
+	return newGitStore(id, ref)
+}
+
+func newGitStore(id string, ref *GitRef) (*gitStore, error) {
+	// --end-of-options keeps a ref starting with - from being read as an option
+	commit, err := git(ref.Repo, "rev-parse", "--verify", "--quiet", "--end-of-options", ref.Ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("%s: unknown revision %s: %w", ref.Repo, ref.Ref, err)
+	}
+	g := &gitStore{
+		ref:    ref,
+		commit: strings.TrimSpace(commit),
+		nodes:  map[string]*graph.Node{},
+		paths:  map[string]string{},
+	}
+	p, err := repoPath(ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	if g.Node, err = g.createNode(id, p); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// read returns the content of the file at the ref's revision
+func (g *gitStore) read(p string) ([]byte, error) {
+	content, err := git(g.ref.Repo, "cat-file", "blob", g.commit+":"+p)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s: %w", p, g.ref.Ref, err)
+	}
+	return []byte(content), nil
+}
+
+func (g *gitStore) createNode(id, p string) (*graph.Node, error) {
+	content, err := g.read(p)
+	if err != nil {
+		return nil, err
+	}
+	n, err := CreateNodeFromMarkdown(id, (&GitRef{Repo: g.ref.Repo, Ref: g.ref.Ref, Path: p}).String(), string(content))
+	if err != nil {
+		return nil, err
+	}
+	n.Metadata.Revision = g.commit
+	g.nodes[id] = n
+	g.paths[id] = p
+	return n, nil
+}
+
+func (g *gitStore) GetNodes(int, graph.Kind) ([]graph.Node, error) {
+	return []graph.Node{*g.Node}, nil
+}
+func (g *gitStore) AddNode(*graph.Node) (*graph.Node, error) { return nil, UnsupportedErr }
+
+// GetChildren returns the nodes of the markdown files the parent includes or links
+// to, at the same revision. Files outside of the repository are not followed.
+func (g *gitStore) GetChildren(parentID string) ([]graph.Node, error) {
+	parent, ok := g.nodes[parentID]
+	if !ok {
+		return nil, NodeNotFoundErr
+	}
+	parentPath := g.paths[parentID]
+	refs, err := findChildFiles(parent.Markdown, path.Dir(parentPath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", parentPath, err)
+	}
+
+	return loadChildren(parentID, parentPath, refs, g.verified, func(file string) (*graph.Node, error) {
+		return g.loadNode(filepath.ToSlash(file))
+	})
+}
+
+// loadNode returns the node of the file in the repository, loading it if needed
+func (g *gitStore) loadNode(file string) (*graph.Node, error) {
+	p, err := repoPath(file)
+	if err != nil {
+		return nil, err
+	}
+	for id, other := range g.paths {
+		if other == p {
+			return g.nodes[id], nil
+		}
+	}
+
+	id, err := (&GitRef{Repo: g.ref.Repo, Ref: g.ref.Ref, Path: p}).NodeID()
+	if err != nil {
+		return nil, err
+	}
+	return g.createNode(id, p)
+}
+
+func (g *gitStore) UpdateNodeBlockExecution(*graph.Node, *graph.Block) error { return UnsupportedErr }
+func (g *gitStore) UpdateNode(*graph.Node) error                             { return nil }
+
+// UpdateNodeBlock is not supported, the files are read at a fixed revision
+func (g *gitStore) UpdateNodeBlock(n *graph.Node, _ *graph.Block) error {
+	return fmt.Errorf("%s is read at revision %s: %w", n.Metadata.SourceURI, g.commit, UnsupportedErr)
+}
+
+func (g *gitStore) SearchNodes(string, int, graph.Kind) ([]graph.Node, error) {
+	return nil, UnsupportedErr
+}
+
+func (g *gitStore) GetNode(id string) (*graph.Node, error) {
+	n, ok := g.nodes[id]
+	if !ok {
+		return nil, NodeNotFoundErr
+	}
+	return n, nil
+}
+
+func (g *gitStore) ExtractID(input string) (string, error) {
+	return ExtractIDFromFilePath(input)
+}
+
+// repoPath cleans a slash separated path relative to the root of a repository
+func repoPath(p string) (string, error) {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%s is outside of the repository", p)
+	}
+	return clean, nil
+}
+
+// git runs the git command in the repository and returns its output
+func git(repo string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
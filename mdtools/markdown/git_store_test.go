@@ -0,0 +1,124 @@
+package markdown
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRepo commits each set of files in turn to a new repository, and tags the
+// commits v1, v2 and so on
+func newTestRepo(t *testing.T, commits ...map[string]string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "mdtools")
+	if err != nil {
+		t.FailNow()
+	}
+	run := func(args ...string) {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	for i, files := range commits {
+		for name, content := range files {
+			file := filepath.Join(dir, filepath.FromSlash(name))
+			assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0700))
+			assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+		}
+		run("add", "-A")
+		run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "commit")
+		run("tag", "v"+string(rune('1'+i)))
+	}
+	return dir
+}
+
+func TestParseGitRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdtools")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	ref, ok := ParseGitRef(dir + "@v1.2.0:docs/deploy.md")
+	assert.True(t, ok)
+	assert.Equal(t, &GitRef{Repo: dir, Ref: "v1.2.0", Path: "docs/deploy.md"}, ref)
+
+	for _, s := range []string{
+		"docs/deploy.md",
+		dir + "@v1.2.0",
+		dir + "@:docs/deploy.md",
+		dir + "@v1.2.0:",
+		filepath.Join(dir, "missing") + "@main:deploy.md",
+		"https://user@example.com:8080/deploy.md",
+	} {
+		_, ok := ParseGitRef(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestGitStore(t *testing.T) {
+	dir := newTestRepo(t,
+		map[string]string{
+			"docs/deploy.md": "---\ninclude: [setup.md]\n---\n# Deploy\n```shell\necho v1\n```\n",
+			"docs/setup.md":  "# Setup\n```shell\necho setup v1\n```\n",
+		},
+		map[string]string{
+			"docs/deploy.md": "# Deploy\n```shell\necho v2\n```\n",
+			"docs/setup.md":  "# Setup\n```shell\necho setup v2\n```\n",
+		})
+	defer os.RemoveAll(dir)
+	v1, err := git(dir, "rev-parse", "v1")
+	assert.Nil(t, err)
+
+	ref := &GitRef{Repo: dir, Ref: "v1", Path: "docs/deploy.md"}
+	rootID, err := ref.NodeID()
+	assert.Nil(t, err)
+	store, err := NewMDGitStore(rootID, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.GetNode(rootID)
+	assert.Nil(t, err)
+	assert.Contains(t, n.Markdown, "echo v1")
+	assert.Equal(t, strings.TrimSpace(v1), n.Metadata.Revision)
+	assert.Equal(t, dir+"@v1:docs/deploy.md", n.Metadata.SourceURI)
+
+	children, err := store.GetChildren(rootID)
+	assert.Nil(t, err)
+	if assert.Len(t, children, 1) {
+		setupID, _ := (&GitRef{Repo: dir, Ref: "v1", Path: "docs/setup.md"}).NodeID()
+		assert.Equal(t, setupID, children[0].ID)
+		assert.Contains(t, children[0].Markdown, "echo setup v1")
+		assert.Equal(t, n.Metadata.Revision, children[0].Metadata.Revision)
+	}
+
+	assert.True(t, errors.Is(store.UpdateNodeBlock(n, n.Blocks[1]), UnsupportedErr))
+
+	_, err = NewMDGitStore("deploy.md", &GitRef{Repo: dir, Ref: "v3", Path: "docs/deploy.md"})
+	assert.NotNil(t, err)
+	_, err = NewMDGitStore("missing.md", &GitRef{Repo: dir, Ref: "v2", Path: "docs/missing.md"})
+	assert.NotNil(t, err)
+	_, err = NewMDGitStore("passwd", &GitRef{Repo: dir, Ref: "v2", Path: "../passwd"})
+	assert.NotNil(t, err)
+	// a ref is never read as an option
+	_, err = NewMDGitStore("deploy.md", &GitRef{Repo: dir, Ref: "--git-dir=/tmp", Path: "docs/deploy.md"})
+	assert.NotNil(t, err)
+
+	// the ID differs from the file in the working tree and is shared by the revisions
+	id, err := NodeIDOf(dir + "@v1:docs/deploy.md")
+	assert.Nil(t, err)
+	assert.Equal(t, rootID, id)
+	assert.True(t, strings.HasPrefix(id, "deploy.md-"))
+	id, err = NodeIDOf(dir + "@v2:./docs/deploy.md")
+	assert.Nil(t, err)
+	assert.Equal(t, rootID, id)
+}
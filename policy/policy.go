@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/1xyz/pryrite/config"
+)
+
+// builtinRules are the rules applied unless disabled in the configuration
+var builtinRules = []config.PolicyRule{
+	{
+		Name:    "sudo",
+		Pattern: `\bsudo\b`,
+		Reason:  "runs a command with elevated privileges",
+	},
+	{
+		Name:    "rm-rf",
+		Pattern: `\brm\s+(-\w*[rR]\w*f|-\w*f\w*[rR]|-[rR]\s+-f|-f\s+-[rR]|--recursive\s+--force|--force\s+--recursive)`,
+		Reason:  "recursively force-removes files",
+	},
+	{
+		Name:    "curl-pipe-shell",
+		Pattern: `\b(curl|wget)\b[^|\n]*\|\s*(sudo\s+)?(ba|z|k|da)?sh\b`,
+		Reason:  "pipes a downloaded script into a shell",
+	},
+	{
+		Name:    "drop-table",
+		Pattern: `(?i)\bdrop\s+(table|database|schema)\b`,
+		Reason:  "drops a database object",
+	},
+	{
+		Name:    "write-etc",
+		Pattern: `(>>?\s*|\btee\s+(-a\s+)?|\bsed\s+-i\S*\s+.*|\b(cp|mv|ln|install)\s+[^\n;|&]*\s)/etc/`,
+		Reason:  "writes to a file under /etc",
+	},
+}
+
+// Rule is a compiled rule flagging a dangerous command
+type Rule struct {
+	// Name identifies the rule in violations
+	Name string
+	// Reason explains why a match is dangerous
+	Reason string
+	re     *regexp.Regexp
+}
+
+// Violation describes a single match of a rule within a block's content
+type Violation struct {
+	Rule   string
+	Reason string
+	Match  string
+	// Line is the 1-based line number of the match within the content
+	Line int
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: %s (%s): %s", v.Line, v.Rule, v.Reason, strings.TrimSpace(v.Match))
+}
+
+// Engine checks the content of a block against a set of rules
+type Engine struct {
+	rules []*Rule
+}
+
+// New compiles the builtin rules and the rules provided in the configuration
+func New(cfg *config.PolicyConfig) (*Engine, error) {
+	var rules []config.PolicyRule
+	if cfg == nil || !cfg.DisableBuiltinRules {
+		rules = append(rules, builtinRules...)
+	}
+	if cfg != nil {
+		rules = append(rules, cfg.Rules...)
+	}
+
+	e := &Engine{rules: make([]*Rule, 0, len(rules))}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %s: regexp.Compile(%s) err = %v", r.Name, r.Pattern, err)
+		}
+		reason := r.Reason
+		if reason == "" {
+			reason = "matches a configured policy rule"
+		}
+		e.rules = append(e.rules, &Rule{Name: r.Name, Reason: reason, re: re})
+	}
+	return e, nil
+}
+
+// Check returns all violations found in the content. An empty result
+// indicates that the content can be executed without confirmation
+func (e *Engine) Check(content string) []Violation {
+	if e == nil {
+		return nil
+	}
+
+	var violations []Violation
+	for _, line := range joinContinuations(content) {
+		for _, r := range e.rules {
+			match := r.re.FindString(line.text)
+			if match == "" {
+				continue
+			}
+			violations = append(violations, Violation{
+				Rule:   r.Name,
+				Reason: r.Reason,
+				Match:  match,
+				Line:   line.number,
+			})
+		}
+	}
+	return violations
+}
+
+type logicalLine struct {
+	text string
+	// number is the 1-based line number the logical line starts at
+	number int
+}
+
+// joinContinuations splits the content into the lines a shell reads, joining
+// the lines ending with a backslash with the next one
+func joinContinuations(content string) []logicalLine {
+	var result []logicalLine
+	var current *logicalLine
+	for i, line := range strings.Split(content, "\n") {
+		if current == nil {
+			current = &logicalLine{number: i + 1}
+		}
+		trimmed := strings.TrimRight(line, " \t\r")
+		if strings.HasSuffix(trimmed, "\\") {
+			current.text += strings.TrimSuffix(trimmed, "\\") + " "
+			continue
+		}
+		current.text += line
+		result = append(result, *current)
+		current = nil
+	}
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result
+}
+
+// Format renders the violations as a human-readable multi-line string
+func Format(violations []Violation) string {
+	sb := strings.Builder{}
+	for _, v := range violations {
+		sb.WriteString(fmt.Sprintf("  * %s\n", v))
+	}
+	return sb.String()
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Check_Builtin(t *testing.T) {
+	e, err := New(nil)
+	if err != nil {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		content string
+		rule    string
+	}{
+		{"sudo whoami", "sudo"},
+		{"rm -rf /tmp/foo", "rm-rf"},
+		{"rm -fr build", "rm-rf"},
+		{"rm -r -f build", "rm-rf"},
+		{"curl -fsSL https://get.docker.com | sh", "curl-pipe-shell"},
+		{"wget -qO- https://example.com/install.sh | sudo bash", "curl-pipe-shell"},
+		{"DROP TABLE users;", "drop-table"},
+		{"psql -c 'drop database foo'", "drop-table"},
+		{"echo 127.0.0.1 foo >> /etc/hosts", "write-etc"},
+		{"echo foo | tee -a /etc/hosts", "write-etc"},
+		{"cp resolv.conf /etc/resolv.conf", "write-etc"},
+	}
+	for _, test := range tests {
+		violations := e.Check(test.content)
+		rules := []string{}
+		for _, v := range violations {
+			rules = append(rules, v.Rule)
+		}
+		assert.Contains(t, rules, test.rule, test.content)
+	}
+}
+
+func TestEngine_Check_Safe(t *testing.T) {
+	e, err := New(nil)
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, content := range []string{
+		`echo "Hello world"`,
+		"ls -l /etc",
+		"cat /etc/hosts",
+		"rm foo.txt",
+		"curl -o out.sh https://example.com/install.sh",
+		"pseudo-random",
+	} {
+		assert.Empty(t, e.Check(content), content)
+	}
+}
+
+func TestEngine_Check_LineNumber(t *testing.T) {
+	e, err := New(nil)
+	if err != nil {
+		t.FailNow()
+	}
+
+	violations := e.Check("echo one\necho two\nsudo reboot")
+	assert.Len(t, violations, 1)
+	assert.Equal(t, 3, violations[0].Line)
+	assert.Equal(t, "sudo", violations[0].Match)
+}
+
+func TestEngine_Check_Continuation(t *testing.T) {
+	e, err := New(nil)
+	if err != nil {
+		t.FailNow()
+	}
+
+	violations := e.Check("echo start\ncurl -fsSL https://example.com/install.sh \\\n  | sh\necho done")
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, "curl-pipe-shell", violations[0].Rule)
+		assert.Equal(t, 2, violations[0].Line)
+	}
+}
+
+func TestEngine_ConfiguredRules(t *testing.T) {
+	e, err := New(&config.PolicyConfig{
+		DisableBuiltinRules: true,
+		Rules: []config.PolicyRule{
+			{Name: "kubectl-delete", Pattern: `\bkubectl\s+delete\b`},
+		},
+	})
+	if err != nil {
+		t.FailNow()
+	}
+
+	assert.Empty(t, e.Check("sudo whoami"))
+	violations := e.Check("kubectl delete pod foo")
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "kubectl-delete", violations[0].Rule)
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	_, err := New(&config.PolicyConfig{
+		Rules: []config.PolicyRule{{Name: "bad", Pattern: "("}},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,185 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/1xyz/pryrite/config"
+)
+
+const (
+	// Mask replaces a secret value
+	Mask = "[REDACTED]"
+
+	// minSecretLen is the minimum length of a value registered with AddSecret,
+	// shorter values would mask too much unrelated output
+	minSecretLen = 4
+
+	// entropy detector settings
+	minEntropyLen    = 24
+	entropyThreshold = 4.0
+)
+
+type detector struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var builtinDetectors = []detector{
+	{"private-key", regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key-id", regexp.MustCompile(`\b((AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA)[0-9A-Z]{16})\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`)},
+	// skips ${secret:name} references and values that are variables such as $PGPASSWORD
+	{"credential", regexp.MustCompile(`(?i)(?:^|[^\w{])(?:password|passwd|pwd|secret|token|api_?key)["']?\s*[=:]\s*["']?([^\s"'$][^\s"']{3,})`)},
+}
+
+// candidates for the entropy detector, typically base64 or url-safe encoded tokens
+var entropyCandidateRE = regexp.MustCompile(`[A-Za-z0-9+/_\-]{24,}={0,2}`)
+
+// Redactor masks secrets found in text
+type Redactor struct {
+	detectors []detector
+	entropy   bool
+
+	lock    sync.RWMutex
+	secrets []string
+}
+
+// New creates a Redactor with the builtin detectors and those provided in the configuration
+func New(cfg *config.RedactConfig) (*Redactor, error) {
+	if cfg == nil {
+		cfg = &config.RedactConfig{}
+	}
+
+	r := &Redactor{entropy: !cfg.DisableEntropyDetector}
+	if !cfg.DisableBuiltinDetectors {
+		r.detectors = append(r.detectors, builtinDetectors...)
+	}
+	for i, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %s: regexp.Compile err = %v", pattern, err)
+		}
+		r.detectors = append(r.detectors, detector{name: fmt.Sprintf("pattern-%d", i), re: re})
+	}
+	for _, name := range cfg.SecretEnv {
+		r.AddSecret(os.Getenv(name))
+	}
+	return r, nil
+}
+
+// AddSecret registers a literal value that is masked wherever it is found
+func (r *Redactor) AddSecret(value string) {
+	if len(value) < minSecretLen {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, s := range r.secrets {
+		if s == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, value)
+	// replace longer values first, in case one secret contains another
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// Redact returns the text with all the secrets found replaced by Mask
+func (r *Redactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	r.lock.RLock()
+	for _, s := range r.secrets {
+		text = strings.ReplaceAll(text, s, Mask)
+	}
+	r.lock.RUnlock()
+
+	for _, d := range r.detectors {
+		text = replaceMatches(d.re, text)
+	}
+	if r.entropy {
+		text = entropyCandidateRE.ReplaceAllStringFunc(text, func(s string) string {
+			if isHighEntropy(s) {
+				return Mask
+			}
+			return s
+		})
+	}
+	return text
+}
+
+// replaceMatches masks the first capture group of each match or the whole match if there is none
+func replaceMatches(re *regexp.Regexp, text string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	sb := strings.Builder{}
+	last := 0
+	for _, m := range matches {
+		start, stop := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, stop = m[2], m[3]
+		}
+		if start < last {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(Mask)
+		last = stop
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// isHighEntropy reports if s looks like a randomly generated token. Only strings
+// mixing upper, lower case letters and digits are considered, this excludes
+// hex encoded hashes (e.g. git commit IDs) and plain identifiers.
+func isHighEntropy(s string) bool {
+	if len(s) < minEntropyLen {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	return shannonEntropy(s) >= entropyThreshold
+}
+
+// shannonEntropy returns the entropy in bits per character of s
+func shannonEntropy(s string) float64 {
+	freq := map[rune]float64{}
+	for _, c := range s {
+		freq[c]++
+	}
+	n := float64(len(s))
+	entropy := 0.0
+	for _, f := range freq {
+		p := f / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
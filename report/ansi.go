@@ -0,0 +1,200 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const ansi = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))"
+
+var ansiRE = regexp.MustCompile(ansi)
+
+// palette are the 16 standard terminal colors (xterm)
+var palette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// StripANSI removes the ANSI escape sequences from s
+func StripANSI(s string) string {
+	return ansiRE.ReplaceAllString(s, "")
+}
+
+// ANSIToHTML escapes s for HTML and converts its SGR escape sequences (colors,
+// bold, italic etc.) to styled spans. Other escape sequences are removed.
+func ANSIToHTML(s string) string {
+	sb := &strings.Builder{}
+	st := &sgrState{}
+	open := false
+	last := 0
+	for _, m := range ansiRE.FindAllStringIndex(s, -1) {
+		sb.WriteString(html.EscapeString(s[last:m[0]]))
+		last = m[1]
+
+		seq := s[m[0]:m[1]]
+		if !strings.HasSuffix(seq, "m") || strings.HasSuffix(seq, "\u0007") {
+			continue
+		}
+		before := st.style()
+		st.apply(strings.TrimLeft(strings.TrimSuffix(seq, "m"), "\u001B\u009B["))
+		if after := st.style(); after != before {
+			if open {
+				sb.WriteString("</span>")
+				open = false
+			}
+			if after != "" {
+				fmt.Fprintf(sb, `<span style="%s">`, after)
+				open = true
+			}
+		}
+	}
+	sb.WriteString(html.EscapeString(s[last:]))
+	if open {
+		sb.WriteString("</span>")
+	}
+	return sb.String()
+}
+
+// sgrState is the graphic rendition set by SGR (select graphic rendition) sequences
+type sgrState struct {
+	bold, dim, italic, underline, strike bool
+	fg, bg                               string
+}
+
+func (st *sgrState) apply(params string) {
+	if params == "" {
+		*st = sgrState{}
+		return
+	}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			if codes[i] == "" {
+				code = 0
+			} else {
+				continue
+			}
+		}
+		switch {
+		case code == 0:
+			*st = sgrState{}
+		case code == 1:
+			st.bold = true
+		case code == 2:
+			st.dim = true
+		case code == 3:
+			st.italic = true
+		case code == 4:
+			st.underline = true
+		case code == 9:
+			st.strike = true
+		case code == 22:
+			st.bold, st.dim = false, false
+		case code == 23:
+			st.italic = false
+		case code == 24:
+			st.underline = false
+		case code == 29:
+			st.strike = false
+		case code >= 30 && code <= 37:
+			st.fg = palette[code-30]
+		case code >= 90 && code <= 97:
+			st.fg = palette[code-90+8]
+		case code == 39:
+			st.fg = ""
+		case code >= 40 && code <= 47:
+			st.bg = palette[code-40]
+		case code >= 100 && code <= 107:
+			st.bg = palette[code-100+8]
+		case code == 49:
+			st.bg = ""
+		case code == 38 || code == 48:
+			color, n := extendedColor(codes[i+1:])
+			i += n
+			if code == 38 {
+				st.fg = color
+			} else {
+				st.bg = color
+			}
+		}
+	}
+}
+
+func (st *sgrState) style() string {
+	styles := []string{}
+	if st.fg != "" {
+		styles = append(styles, "color:"+st.fg)
+	}
+	if st.bg != "" {
+		styles = append(styles, "background-color:"+st.bg)
+	}
+	if st.bold {
+		styles = append(styles, "font-weight:bold")
+	}
+	if st.dim {
+		styles = append(styles, "opacity:0.7")
+	}
+	if st.italic {
+		styles = append(styles, "font-style:italic")
+	}
+	if st.underline && st.strike {
+		styles = append(styles, "text-decoration:underline line-through")
+	} else if st.underline {
+		styles = append(styles, "text-decoration:underline")
+	} else if st.strike {
+		styles = append(styles, "text-decoration:line-through")
+	}
+	return strings.Join(styles, ";")
+}
+
+// extendedColor parses the 5;n (256 colors) or 2;r;g;b (true color) parameters
+// following a 38 or 48 code and returns the color and the number of parameters used
+func extendedColor(params []string) (string, int) {
+	if len(params) == 0 {
+		return "", 0
+	}
+	num := func(i int) int {
+		n, _ := strconv.Atoi(params[i])
+		if n < 0 || n > 255 {
+			return 0
+		}
+		return n
+	}
+	switch params[0] {
+	case "5":
+		if len(params) < 2 {
+			return "", len(params)
+		}
+		return color256(num(1)), 2
+	case "2":
+		if len(params) < 4 {
+			return "", len(params)
+		}
+		return fmt.Sprintf("#%02x%02x%02x", num(1), num(2), num(3)), 4
+	default:
+		return "", 1
+	}
+}
+
+func color256(n int) string {
+	switch {
+	case n < 16:
+		return palette[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		g := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", g, g, g)
+	}
+}
@@ -0,0 +1,25 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestANSIToHTML(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"plain <text>", "plain &lt;text&gt;"},
+		{"\x1b[31merror\x1b[0m done", `<span style="color:#cd0000">error</span> done`},
+		{"\x1b[1;32mok\x1b[39m bold\x1b[m", `<span style="color:#00cd00;font-weight:bold">ok</span><span style="font-weight:bold"> bold</span>`},
+		{"\x1b[38;5;196mx\x1b[48;2;1;2;3my", `<span style="color:#ff0000">x</span><span style="color:#ff0000;background-color:#010203">y</span>`},
+		// other escape sequences are dropped
+		{"\x1b[2Kclear\x1b]0;title\x07", "clear"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ANSIToHTML(test.in), test.in)
+	}
+	assert.Equal(t, "error done", StripANSI("\x1b[31merror\x1b[0m done"))
+}
@@ -0,0 +1,144 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+const style = `
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #24292f; line-height: 1.5; }
+pre { background: #f6f8fa; padding: 0.8em; overflow-x: auto; border-radius: 4px; }
+pre.output { background: #1e1e1e; color: #e5e5e5; }
+pre.stderr { border-left: 4px solid #cd0000; }
+.summary, .result { font-size: 0.9em; }
+.summary td { padding: 0 1em 0 0; }
+.result { border-left: 4px solid #8c959f; padding: 0.2em 0 0.2em 1em; margin: 0 0 1.5em 0; }
+.result.completed { border-color: #1a7f37; }
+.result.failed { border-color: #cf222e; }
+.result .meta { color: #57606a; }
+.result .state { font-weight: bold; }
+.result .error { color: #cf222e; }
+`
+
+// WriteHTML writes a standalone HTML page of the node's markdown with the results of
+// each code block following it. ANSI colors in the output are kept as styled spans.
+func (r *Report) WriteHTML(w io.Writer) error {
+	finder := newBlockFinder(r.Node)
+	body := &bytes.Buffer{}
+	md := newMarkdown(goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeRenderer{report: r, finder: finder}, 100))))
+	if err := md.Convert(finder.source, body); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n",
+		html.EscapeString(r.title()), style)
+	bw.WriteString("<table class=\"summary\">\n")
+	for _, row := range [][2]string{
+		{"Markdown", r.Node.ID},
+		{"Execution", r.ExecutionID},
+		{"Started", formatTime(r.StartedAt)},
+		{"Finished", formatTime(r.FinishedAt)},
+	} {
+		fmt.Fprintf(bw, "<tr><td>%s</td><td>%s</td></tr>\n", row[0], html.EscapeString(row[1]))
+	}
+	bw.WriteString("</table>\n<hr>\n")
+	bw.Write(body.Bytes())
+
+	if len(r.Orphans) > 0 {
+		bw.WriteString("<hr>\n<h2>Blocks no longer in the file</h2>\n")
+		for _, entry := range r.Orphans {
+			writeHTMLResult(bw, entry, true)
+		}
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// codeRenderer renders code blocks followed by the results of their block
+type codeRenderer struct {
+	report *Report
+	finder *blockFinder
+}
+
+func (cr *codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, cr.render)
+	reg.Register(ast.KindCodeBlock, cr.render)
+}
+
+func (cr *codeRenderer) render(w util.BufWriter, source []byte, mdNode ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	b, _, found := cr.finder.find(mdNode)
+	if found && language(b) != "" {
+		fmt.Fprintf(w, "<pre><code class=\"language-%s\">", html.EscapeString(language(b)))
+	} else {
+		w.WriteString("<pre><code>")
+	}
+	lines := mdNode.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		w.WriteString(html.EscapeString(string(line.Value(source))))
+	}
+	w.WriteString("</code></pre>\n")
+
+	if !found || !b.IsCode() {
+		return ast.WalkContinue, nil
+	}
+	results := cr.report.Results[b.ID]
+	if len(results) == 0 {
+		w.WriteString("<div class=\"result\"><span class=\"meta\">Not run</span></div>\n")
+	}
+	for _, entry := range results {
+		writeHTMLResult(w, entry, entry.Content != b.Content)
+	}
+	return ast.WalkContinue, nil
+}
+
+func writeHTMLResult(w util.BufWriter, entry *log.ResultLogEntry, showContent bool) {
+	fmt.Fprintf(w, "<div class=\"result %s\">\n", strings.ToLower(string(entry.State)))
+	meta := fmt.Sprintf("exit status: %s, executed at %s", orNone(entry.ExitStatus), formatTime(entry.ExecutedAt))
+	if entry.ExecutedBy != "" {
+		meta += " by " + entry.ExecutedBy
+	}
+	if entry.Revision != "" {
+		meta += " at revision " + entry.Revision
+	}
+	meta += fmt.Sprintf(" (block %s, log %s)", entry.BlockID, entry.ID)
+	fmt.Fprintf(w, "<div class=\"meta\"><span class=\"state\">%s</span> %s</div>\n",
+		html.EscapeString(string(entry.State)), html.EscapeString(meta))
+	if entry.Err != "" {
+		fmt.Fprintf(w, "<div class=\"error\">Error: %s</div>\n", html.EscapeString(entry.Err))
+	}
+	if showContent {
+		fmt.Fprintf(w, "<div class=\"meta\">Content that ran:</div>\n<pre><code>%s</code></pre>\n",
+			html.EscapeString(entry.Content))
+	}
+	for _, out := range []struct {
+		name string
+		text string
+	}{
+		{"stdout", entry.Stdout},
+		{"stderr", entry.Stderr},
+	} {
+		if out.text == "" {
+			continue
+		}
+		fmt.Fprintf(w, "<div class=\"meta\">%s:</div>\n<pre class=\"output %s\">%s</pre>\n",
+			out.name, out.name, ANSIToHTML(out.text))
+	}
+	w.WriteString("</div>\n")
+}
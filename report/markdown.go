@@ -0,0 +1,128 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// WriteMarkdown writes the node's markdown with the results of each code block following it
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<!-- execution %s of %s, %s to %s -->\n\n",
+		r.ExecutionID, r.Node.ID, formatTime(r.StartedAt), formatTime(r.FinishedAt))
+
+	finder := newBlockFinder(r.Node)
+	doc := newMarkdown().Parser().Parse(text.NewReader(finder.source))
+	last := 0
+	if err := ast.Walk(doc, func(mdNode ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		b, end, ok := finder.find(mdNode)
+		if !ok || !b.IsCode() {
+			return ast.WalkContinue, nil
+		}
+		bw.Write(finder.source[last:end])
+		last = end
+		if end > 0 && finder.source[end-1] != '\n' {
+			bw.WriteString("\n")
+		}
+
+		results := r.Results[b.ID]
+		if len(results) == 0 {
+			bw.WriteString("\n> Not run\n\n")
+		}
+		for _, entry := range results {
+			writeMarkdownResult(bw, entry, entry.Content != b.Content)
+		}
+		return ast.WalkSkipChildren, nil
+	}); err != nil {
+		return err
+	}
+	bw.Write(finder.source[last:])
+
+	if len(r.Orphans) > 0 {
+		bw.WriteString("\n## Blocks no longer in the file\n")
+		for _, entry := range r.Orphans {
+			writeMarkdownResult(bw, entry, true)
+		}
+	}
+	return bw.Flush()
+}
+
+func writeMarkdownResult(w *bufio.Writer, entry *log.ResultLogEntry, showContent bool) {
+	fmt.Fprintf(w, "\n> **%s** exit status: %s, executed at %s", entry.State, orNone(entry.ExitStatus),
+		formatTime(entry.ExecutedAt))
+	if entry.ExecutedBy != "" {
+		fmt.Fprintf(w, " by %s", entry.ExecutedBy)
+	}
+	if entry.Revision != "" {
+		fmt.Fprintf(w, " at revision %s", entry.Revision)
+	}
+	fmt.Fprintf(w, " (block %s, log %s)\n", entry.BlockID, entry.ID)
+	if entry.Err != "" {
+		fmt.Fprintf(w, ">\n> Error: %s\n", strings.ReplaceAll(entry.Err, "\n", " "))
+	}
+	w.WriteString("\n")
+
+	if showContent {
+		w.WriteString("Content that ran:\n\n")
+		writeFenced(w, "", entry.Content)
+		w.WriteString("\n")
+	}
+	for _, out := range []struct {
+		name string
+		text string
+	}{
+		{"stdout", entry.Stdout},
+		{"stderr", entry.Stderr},
+	} {
+		if out.text == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n\n", out.name)
+		writeFenced(w, "text", StripANSI(out.text))
+		w.WriteString("\n")
+	}
+}
+
+// writeFenced writes a fenced code block, with a fence longer than any run of backticks in the text
+func writeFenced(w *bufio.Writer, lang, text string) {
+	fence := strings.Repeat("`", maxRun(text, '`')+1)
+	if len(fence) < 3 {
+		fence = "```"
+	}
+	fmt.Fprintf(w, "%s%s\n%s", fence, lang, text)
+	if !strings.HasSuffix(text, "\n") {
+		w.WriteString("\n")
+	}
+	fmt.Fprintf(w, "%s\n", fence)
+}
+
+func maxRun(s string, c byte) int {
+	max, n := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			n++
+			if n > max {
+				max = n
+			}
+		} else {
+			n = 0
+		}
+	}
+	return max
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
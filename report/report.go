@@ -0,0 +1,211 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/1xyz/pryrite/internal/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+)
+
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "md"
+)
+
+var ErrExecutionNotFound = errors.New("execution not found in the result log")
+
+// Report is what was run, and what it printed, in an execution of a node
+type Report struct {
+	Node        *graph.Node
+	ExecutionID string
+
+	// Results of each block, oldest first
+	Results map[string][]*log.ResultLogEntry
+	// Orphans are results of blocks no longer in the node
+	Orphans []*log.ResultLogEntry
+
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// New collects the results of the execution of the node from the result log, if
+// executionID is empty the most recent execution is reported. Of the entries of a
+// request only one is kept, the completed or failed one if the request finished.
+func New(n *graph.Node, rl log.ResultLog, executionID string) (*Report, error) {
+	if executionID == "" {
+		var latest time.Time
+		if err := rl.Each(func(_ int, entry *log.ResultLogEntry) bool {
+			if executionID == "" || executedAt(entry).After(latest) {
+				executionID, latest = entry.ExecutionID, executedAt(entry)
+			}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	byRequest := map[string]*log.ResultLogEntry{}
+	entries := []*log.ResultLogEntry{}
+	if err := rl.Each(func(_ int, entry *log.ResultLogEntry) bool {
+		if entry.ExecutionID != executionID {
+			return true
+		}
+		prev, ok := byRequest[entry.RequestID]
+		if !ok {
+			entries = append(entries, entry)
+		} else if isFinished(prev) || !isFinished(entry) {
+			return true
+		} else {
+			for i := range entries {
+				if entries[i] == prev {
+					entries[i] = entry
+				}
+			}
+		}
+		byRequest[entry.RequestID] = entry
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", executionID, ErrExecutionNotFound)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return executedAt(entries[i]).Before(executedAt(entries[j]))
+	})
+
+	r := &Report{
+		Node:        n,
+		ExecutionID: executionID,
+		Results:     map[string][]*log.ResultLogEntry{},
+	}
+	for _, entry := range entries {
+		if _, ok := n.GetBlock(entry.BlockID); ok {
+			r.Results[entry.BlockID] = append(r.Results[entry.BlockID], entry)
+		} else {
+			r.Orphans = append(r.Orphans, entry)
+		}
+		if entry.ExecutedAt != nil {
+			if r.StartedAt == nil {
+				r.StartedAt = entry.ExecutedAt
+			}
+			r.FinishedAt = entry.ExecutedAt
+		}
+	}
+	return r, nil
+}
+
+// Write renders the report in the format
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatHTML:
+		return r.WriteHTML(w)
+	case FormatMarkdown:
+		return r.WriteMarkdown(w)
+	default:
+		return fmt.Errorf("unknown format %q, expected %s or %s", format, FormatHTML, FormatMarkdown)
+	}
+}
+
+func (r *Report) title() string {
+	if r.Node.Title != "" {
+		return r.Node.Title
+	}
+	return r.Node.ID
+}
+
+func isFinished(entry *log.ResultLogEntry) bool {
+	return entry.State.In(log.ExecStateCompleted, log.ExecStateFailed)
+}
+
+func executedAt(entry *log.ResultLogEntry) time.Time {
+	if entry.ExecutedAt == nil {
+		return time.Time{}
+	}
+	return *entry.ExecutedAt
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// language of the code block, e.g. bash
+func language(b *graph.Block) string {
+	if b.ContentType == nil {
+		return ""
+	}
+	return b.ContentType.Subtype
+}
+
+func newMarkdown(opts ...goldmark.Option) goldmark.Markdown {
+	return goldmark.New(append([]goldmark.Option{goldmark.WithExtensions(extension.GFM)}, opts...)...)
+}
+
+// blockFinder finds the block of a code block in the node's markdown. The
+// blocks of a node are consecutive chunks of its markdown, so a code block's
+// chunk starts at the offset of its block.
+type blockFinder struct {
+	source  []byte
+	offsets map[int]*graph.Block
+}
+
+func newBlockFinder(n *graph.Node) *blockFinder {
+	f := &blockFinder{source: []byte(n.Markdown), offsets: map[int]*graph.Block{}}
+	offset := 0
+	for _, b := range n.Blocks {
+		f.offsets[offset] = b
+		offset += len(b.Content)
+	}
+	return f
+}
+
+// find returns the block of the code block and the offset just past it,
+// including the closing fence
+func (f *blockFinder) find(mdNode ast.Node) (*graph.Block, int, bool) {
+	if mdNode.Kind() != ast.KindFencedCodeBlock && mdNode.Kind() != ast.KindCodeBlock {
+		return nil, 0, false
+	}
+	start, stop, ok := markdown.CodeChunkBounds(f.source, mdNode)
+	if !ok {
+		return nil, 0, false
+	}
+	b, ok := f.offsets[start]
+	if !ok || b.Content != string(f.source[start:stop]) {
+		return nil, 0, false
+	}
+
+	end := stop
+	if end == 0 || f.source[end-1] != '\n' {
+		end = endOfLine(f.source, end)
+	}
+	if mdNode.Kind() == ast.KindFencedCodeBlock {
+		fenceEnd := endOfLine(f.source, end)
+		fence := bytes.TrimSpace(f.source[end:fenceEnd])
+		if len(fence) >= 3 && (fence[0] == '`' || fence[0] == '~') {
+			end = fenceEnd
+		}
+	}
+	return b, end, true
+}
+
+// endOfLine returns the offset past the newline ending the line containing pos
+func endOfLine(source []byte, pos int) int {
+	if i := bytes.IndexByte(source[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(source)
+}
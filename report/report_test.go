@@ -0,0 +1,86 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	executor "github.com/1xyz/pryrite/executors"
+	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	n := &graph.Node{
+		ID:       "test.md",
+		Markdown: "# test\n```bash\necho hi\n```\ntext\n```bash\nexit 1\n```\n",
+		Blocks: []*graph.Block{
+			{ID: "test.md/1", Content: "# test\n```bash\n", ContentType: executor.NewContentType("markdown", nil)},
+			{ID: "test.md/2", Content: "echo hi\n", ContentType: executor.NewContentType("bash", nil)},
+			{ID: "test.md/3", Content: "```\ntext\n```bash\n", ContentType: executor.NewContentType("markdown", nil)},
+			{ID: "test.md/4", Content: "exit 1\n", ContentType: executor.NewContentType("bash", nil)},
+			{ID: "test.md/5", Content: "```\n", ContentType: executor.NewContentType("markdown", nil)},
+		},
+	}
+
+	index, err := log.NewResultLogIndex(log.IndexInMemory)
+	if err != nil {
+		t.FailNow()
+	}
+	now := time.Now()
+	for i, e := range []struct {
+		executionID, blockID, requestID string
+		state                           log.ExecState
+		stdout                          string
+	}{
+		{"ex1", "test.md/2", "r1", log.ExecStateCompleted, "old"},
+		{"ex2", "test.md/2", "r2", log.ExecStateStarted, ""},
+		{"ex2", "test.md/2", "r2", log.ExecStateCompleted, "\x1b[32mhi\x1b[0m"},
+	} {
+		entry := log.NewResultLogEntry(e.executionID, n.ID, e.blockID, e.requestID, "", "echo hi\n")
+		executedAt := now.Add(time.Duration(i) * time.Second)
+		entry.ExecutedAt = &executedAt
+		entry.State = e.state
+		entry.Stdout = e.stdout
+		if err := index.Append(entry); err != nil {
+			t.FailNow()
+		}
+	}
+	rl, err := index.Get(n.ID)
+	if err != nil {
+		t.FailNow()
+	}
+
+	_, err = New(n, rl, "ex3")
+	assert.ErrorIs(t, err, ErrExecutionNotFound)
+
+	r, err := New(n, rl, "ex1")
+	if assert.Nil(t, err) {
+		results := r.Results["test.md/2"]
+		if assert.Equal(t, 1, len(results)) {
+			assert.Equal(t, "old", results[0].Stdout)
+		}
+	}
+
+	// the most recent execution, with the completed entry of the request
+	latest, err := New(n, rl, "")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "ex2", latest.ExecutionID)
+		results := latest.Results["test.md/2"]
+		if assert.Equal(t, 1, len(results)) {
+			assert.Equal(t, log.ExecStateCompleted, results[0].State)
+		}
+	}
+
+	sb := &strings.Builder{}
+	assert.Nil(t, r.WriteMarkdown(sb))
+	md := sb.String()
+	assert.Contains(t, md, "```bash\necho hi\n```\n\n> **Completed**")
+	assert.Contains(t, md, "```bash\nexit 1\n```\n\n> Not run")
+
+	sb.Reset()
+	assert.Nil(t, r.Write(sb, FormatHTML))
+	assert.Contains(t, sb.String(), `<pre class="output stdout">old</pre>`)
+	assert.Error(t, r.Write(sb, Format("pdf")))
+}
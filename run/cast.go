@@ -0,0 +1,53 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/1xyz/pryrite/asciicast"
+	"github.com/1xyz/pryrite/graph/log"
+	"github.com/1xyz/pryrite/tools"
+	"golang.org/x/term"
+)
+
+const (
+	defaultCastWidth  = 80
+	defaultCastHeight = 24
+)
+
+// newRecorder returns a recorder of the block's output sized to the terminal
+func newRecorder(req *BlockExecutionRequest) *asciicast.Recorder {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = defaultCastWidth, defaultCastHeight
+	}
+	env := map[string]string{}
+	for _, name := range []string{"SHELL", "TERM"} {
+		if v := os.Getenv(name); v != "" {
+			env[name] = v
+		}
+	}
+	return asciicast.NewRecorder(width, height, req.Block.ID, env)
+}
+
+// saveCast writes the redacted recording next to the node's result log and references it from the entry
+func (r *Run) saveCast(entry *log.ResultLogEntry, recorder *asciicast.Recorder) {
+	cast := recorder.Cast(r.Redactor.Redact)
+	if len(cast.Events) == 0 {
+		return
+	}
+
+	name := log.CastFileName(entry.ID)
+	path := filepath.Join(log.ResultLogDir(), entry.NodeID, name)
+	f, err := tools.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		tools.Log.Warn().Err(err).Msgf("saveCast: %s", path)
+		return
+	}
+	defer tools.CloseFile(f)
+	if err := cast.Encode(f); err != nil {
+		tools.Log.Warn().Err(err).Msgf("saveCast: encode %s", path)
+		return
+	}
+	entry.CastFile = name
+}
@@ -29,6 +29,16 @@ func (ni *NodeIndex) ContainsID(id string) bool {
 	return found
 }
 
+// IDs returns the IDs of the nodes in the index
+func (ni *NodeIndex) IDs() []string {
+	ids := []string{}
+	ni.Range(func(key, _ interface{}) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	return ids
+}
+
 func (ni *NodeIndex) Get(id string) (*graph.Node, error) {
 	e, found := ni.Load(id)
 	if !found {
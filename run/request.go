@@ -56,6 +56,8 @@ func NewResultLogEntryFromRequest(req *BlockExecutionRequest) *log.ResultLogEntr
 		req.ID,
 		req.ExecutedBy,
 		req.Block.Content)
+	res.Revision = req.Node.Metadata.Revision
+	res.SHA256 = req.Node.Metadata.SHA256
 	return res
 }
 
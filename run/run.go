@@ -15,9 +15,13 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 
+	"github.com/1xyz/pryrite/config"
 	executor "github.com/1xyz/pryrite/executors"
 	"github.com/1xyz/pryrite/graph"
 	"github.com/1xyz/pryrite/graph/log"
+	"github.com/1xyz/pryrite/policy"
+	"github.com/1xyz/pryrite/redact"
+	"github.com/1xyz/pryrite/secrets"
 	"github.com/1xyz/pryrite/snippet"
 	"github.com/1xyz/pryrite/tools"
 	"github.com/1xyz/pryrite/tools/queue"
@@ -26,6 +30,10 @@ import (
 type StatusUpdateFn func(*Status)
 type ExecutionUpdateFn func(entry *log.ResultLogEntry)
 
+// ConfirmFn is invoked when a block's content violates the execution policy.
+// It returns true if the block should be executed regardless.
+type ConfirmFn func(req *BlockExecutionRequest, violations []policy.Violation) bool
+
 // Run encapsulates a playbook's execution
 type Run struct {
 	// snippet context
@@ -52,6 +60,15 @@ type Run struct {
 	// Register is the execution library
 	Register *executor.Register
 
+	// Policy flags dangerous blocks before they are executed
+	Policy *policy.Engine
+
+	// Redactor masks secrets in the captured output before it is logged
+	Redactor *redact.Redactor
+
+	// Secrets resolves references to secrets in a block's content
+	Secrets *secrets.Resolver
+
 	// isRunning indicates if the Run can accept requests to execute
 	isRunning *atomic.Bool
 
@@ -63,9 +80,11 @@ type Run struct {
 	logRecvCh       chan *log.ResultLogEntry
 	executionDoneCh chan *log.ResultLogEntry
 	stopCh          chan bool
+	startCh         chan bool
 	statusCh        chan *Status
 	executionDoneFn ExecutionUpdateFn
 	statusUpdateFn  StatusUpdateFn
+	confirmFn       ConfirmFn
 }
 
 // NewRun constructs a new run for the provided playbook for the
@@ -85,7 +104,25 @@ func NewRun(gCtx *snippet.Context, playbookIDOrURL string) (*Run, error) {
 		return nil, err
 	}
 
-	execIndex, err := log.NewResultLogIndex(log.IndexFileSystem)
+	indexType, err := log.IndexTypeOf(gCtx.ConfigEntry.ResultLog.Format)
+	if err != nil {
+		return nil, err
+	}
+	execIndex, err := log.NewResultLogIndex(indexType)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := policy.New(&gCtx.ConfigEntry.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(&gCtx.ConfigEntry.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := secrets.NewResolver(&gCtx.ConfigEntry.Secrets)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +136,9 @@ func NewRun(gCtx *snippet.Context, playbookIDOrURL string) (*Run, error) {
 		ExecIndex:  execIndex,
 		Store:      store,
 		Register:   register,
+		Policy:     engine,
+		Redactor:   redactor,
+		Secrets:    resolver,
 		isRunning:  atomic.NewBool(false),
 		requestQ:   queue.NewConcurrentQueue(),
 
@@ -107,6 +147,7 @@ func NewRun(gCtx *snippet.Context, playbookIDOrURL string) (*Run, error) {
 		logRecvCh:       make(chan *log.ResultLogEntry),
 		executionDoneCh: make(chan *log.ResultLogEntry),
 		stopCh:          make(chan bool),
+		startCh:         make(chan bool),
 		statusCh:        make(chan *Status),
 	}
 
@@ -128,6 +169,16 @@ func NewRun(gCtx *snippet.Context, playbookIDOrURL string) (*Run, error) {
 	}
 	tools.TimeTrack(start, "run.buildGraph")
 
+	// if opted in, compact and apply the retention policy to the result logs of this
+	// playbook and the files it includes or links to, the total size is only trimmed by logs gc
+	if gCtx.ConfigEntry.ResultLog.GCOnOpen && !config.IsReadOnly() {
+		if stats, err := log.GC(log.ResultLogDir(), log.NewRetentionPolicy(&gCtx.ConfigEntry.ResultLog),
+			run.ViewIndex.IDs()...); err != nil {
+			tools.Log.Warn().Err(err).Msgf("NewRun: log.GC %s", id)
+		} else if stats.Removed() > 0 {
+			tools.Log.Info().Msgf("NewRun: log.GC %s %v", id, stats)
+		}
+	}
 	return run, nil
 }
 
@@ -156,14 +207,19 @@ func (r *Run) buildGraph() error {
 		tools.TimeTrack(s3, "r.Store.GetChildren"+parent.ID)
 		fetchDuration += time.Since(s3)
 
+		// a child already in the index is either an ancestor (a cycle) or shared with
+		// another parent, either way it is dropped so that its blocks are visited once
+		children := parent.ChildNodes[:0]
 		for i := range parent.ChildNodes {
 			child := parent.ChildNodes[i]
 			if err := r.ViewIndex.Add(child); err != nil {
-				tools.Log.Err(err).Msgf("buildGraph: ViewIndex.Add(%s) failed", child.ID)
+				tools.Log.Warn().Err(err).Msgf("buildGraph: skipping child %s of %s", child.ID, parent.ID)
 				continue
 			}
-			q.PushBack(parent.ChildNodes[i])
+			children = append(children, child)
+			q.PushBack(child)
 		}
+		parent.ChildNodes = children
 	}
 	tools.TimeTrack(s1, "queue stuff")
 	tools.Log.Info().Msgf("FetchDuration for get children %v", fetchDuration)
@@ -209,18 +265,6 @@ func (r *Run) GetBlockExecutionResult(nodeID, logID string) (*log.ResultLogEntry
 	return result, nil
 }
 
-// ExecuteNode executes all code blocks in the context of this node
-// If any block fails executions, ExecuteNode will return an error and not continue executing
-func (r *Run) ExecuteNode(n *graph.Node, stdout, stderr io.Writer) error {
-	for _, b := range n.Blocks {
-		if !b.IsCode() {
-			continue
-		}
-		r.ExecuteBlock(n, b, stdout, stderr)
-	}
-	return nil
-}
-
 func (r *Run) reqDispatchLoop() {
 	for {
 		item := r.requestQ.WaitForItem()
@@ -249,6 +293,7 @@ func (r *Run) Start() {
 		tools.Log.Info().Msgf("System is already running")
 		return
 	}
+	close(r.startCh)
 
 	go r.reqDispatchLoop()
 
@@ -345,8 +390,12 @@ func (r *Run) Shutdown() {
 	close(r.stopCh)
 }
 
+// WaitForStart blocks until the Run is started and can accept requests
+func (r *Run) WaitForStart() { <-r.startCh }
+
 func (r *Run) SetStatusUpdateFn(fn StatusUpdateFn)       { r.statusUpdateFn = fn }
 func (r *Run) SetExecutionUpdateFn(fn ExecutionUpdateFn) { r.executionDoneFn = fn }
+func (r *Run) SetConfirmFn(fn ConfirmFn)                 { r.confirmFn = fn }
 
 func (r *Run) statusErrf(format string, v ...interface{})  { r.sendStatus(StatusError, format, v...) }
 func (r *Run) statusInfof(format string, v ...interface{}) { r.sendStatus(StatusInfo, format, v...) }
@@ -363,6 +412,7 @@ func (r *Run) sendLog(req *BlockExecutionRequest, state log.ExecState) {
 	go func() {
 		entry := NewResultLogEntryFromRequest(req)
 		entry.State = state
+		r.redactEntry(entry)
 		r.logRecvCh <- entry
 	}()
 }
@@ -401,8 +451,24 @@ func (r *Run) ExecuteBlock(n *graph.Node, b *graph.Block, stdout, stderr io.Writ
 func (r *Run) executeBlock(req *BlockExecutionRequest) *log.ResultLogEntry {
 	tools.Log.Info().Msgf("ExecuteBlock: req %v", req)
 	execResult := NewResultLogEntryFromRequest(req)
+	// deferred first, so that this runs after the output is captured
+	defer r.redactEntry(execResult)
+
+	if err := r.checkPolicy(req); err != nil {
+		execResult.State = log.ExecStateFailed
+		execResult.SetError(err)
+		return execResult
+	}
+
+	// the resolved content is only handed to the executor, it is never logged or persisted
+	content, err := r.resolveSecrets(req)
+	if err != nil {
+		execResult.State = log.ExecStateFailed
+		execResult.SetError(err)
+		return execResult
+	}
 
-	exec, err := r.Register.Get([]byte(req.Block.Content), req.Block.ContentType)
+	exec, err := r.Register.Get([]byte(content), req.Block.ContentType)
 	if err != nil {
 		execResult.State = log.ExecStateFailed
 		execResult.SetError(errors.Wrap(err, "cannot execute"))
@@ -418,14 +484,23 @@ func (r *Run) executeBlock(req *BlockExecutionRequest) *log.ResultLogEntry {
 
 	// Write to both the real TUI passed in (with buffering to avoid delays) and
 	// a capture writer in the result.
-	outWriter := tools.NewBufferedWriteCloser(io.MultiWriter(stdoutWriter, req.Stdout))
-	errWriter := tools.NewBufferedWriteCloser(io.MultiWriter(stderrWriter, req.Stderr))
+	stdouts := []io.Writer{stdoutWriter, req.Stdout}
+	stderrs := []io.Writer{stderrWriter, req.Stderr}
+	if r.gCtx.ConfigEntry.ResultLog.Record {
+		recorder := newRecorder(req)
+		stdouts = append(stdouts, recorder)
+		stderrs = append(stderrs, recorder)
+		// runs once the block has finished, before the entry is redacted
+		defer r.saveCast(execResult, recorder)
+	}
+	outWriter := tools.NewBufferedWriteCloser(io.MultiWriter(stdouts...))
+	errWriter := tools.NewBufferedWriteCloser(io.MultiWriter(stderrs...))
 
 	tools.Log.Info().Msgf("executeBlock node:%s req-id:%s content:%s",
 		req.Node.ID, req.ID, req.Block.Content)
 	execReq := &executor.ExecRequest{
 		Hdr:         &executor.RequestHdr{ID: req.ID, ExecutionID: req.ExecutionID, NodeID: req.Node.ID},
-		Content:     []byte(req.Block.Content),
+		Content:     []byte(content),
 		ContentType: req.Block.ContentType,
 		In:          os.Stdin,
 		Stdout:      outWriter,
@@ -452,6 +527,52 @@ func (r *Run) executeBlock(req *BlockExecutionRequest) *log.ResultLogEntry {
 	return execResult
 }
 
+// redactEntry masks secrets in the entry since it is persisted and reported to the store
+func (r *Run) redactEntry(entry *log.ResultLogEntry) {
+	entry.Content = r.Redactor.Redact(entry.Content)
+	entry.Stdout = r.Redactor.Redact(entry.Stdout)
+	entry.Stderr = r.Redactor.Redact(entry.Stderr)
+	entry.Err = r.Redactor.Redact(entry.Err)
+}
+
+// resolveSecrets returns the block's content with references to secrets replaced by
+// their values. The values are added to the redactor so they never show up in the log.
+func (r *Run) resolveSecrets(req *BlockExecutionRequest) (string, error) {
+	if !secrets.HasReferences(req.Block.Content) {
+		return req.Block.Content, nil
+	}
+
+	content, values, err := r.Secrets.Resolve(req.Block.Content)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot resolve secrets")
+	}
+	for _, value := range values {
+		r.Redactor.AddSecret(value)
+	}
+	return content, nil
+}
+
+// checkPolicy returns an error if the block violates the execution policy
+// and the violation is not confirmed
+func (r *Run) checkPolicy(req *BlockExecutionRequest) error {
+	violations := r.Policy.Check(req.Block.Content)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	tools.Log.Warn().
+		Str("nodeID", req.Node.ID).
+		Str("blockID", req.Block.ID).
+		Int("violations", len(violations)).
+		Msg("checkPolicy: block violates the execution policy")
+	if r.confirmFn != nil && r.confirmFn(req, violations) {
+		tools.Log.Info().Msgf("checkPolicy: req %s confirmed", req.ID)
+		return nil
+	}
+	return fmt.Errorf("refused to execute a block that violates the execution policy:\n%s",
+		policy.Format(violations))
+}
+
 func (r *Run) EditSnippet(nodeID string) (*graph.Node, error) {
 	n, err := r.ViewIndex.Get(nodeID)
 	if err != nil {
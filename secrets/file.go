@@ -0,0 +1,222 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/1xyz/pryrite/tools"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileVersion = 1
+	kdfScrypt   = "scrypt"
+
+	// scrypt parameters recommended for interactive logins
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	keyLen       = 32
+	saltLen      = 16
+	passphraseID = "secrets file passphrase"
+)
+
+var ErrBadPassphrase = errors.New("incorrect passphrase or corrupted secrets file")
+
+// encryptedFile is the on-disk format of the secrets file. The secrets are
+// encrypted with AES-256-GCM using a key derived from a passphrase with scrypt.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type PassphraseFn func(prompt string) (string, error)
+
+// FileProvider stores secrets in a local file encrypted with a passphrase
+type FileProvider struct {
+	path         string
+	passphraseFn PassphraseFn
+
+	passphrase string
+	secrets    map[string]string
+}
+
+func NewFileProvider(path string, passphraseFn PassphraseFn) *FileProvider {
+	return &FileProvider{path: path, passphraseFn: passphraseFn}
+}
+
+func (f *FileProvider) Name() string { return ProviderFile }
+
+func (f *FileProvider) Get(name string) (string, error) {
+	if exists, err := tools.StatExists(f.path); err != nil {
+		return "", err
+	} else if !exists {
+		return "", ErrSecretNotFound
+	}
+
+	if err := f.load(); err != nil {
+		return "", err
+	}
+	value, ok := f.secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// Set adds or replaces the named secret and saves the file
+func (f *FileProvider) Set(name, value string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	f.secrets[name] = value
+	return f.save()
+}
+
+// Delete removes the named secret and saves the file
+func (f *FileProvider) Delete(name string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	if _, ok := f.secrets[name]; !ok {
+		return fmt.Errorf("secret %s: %w", name, ErrSecretNotFound)
+	}
+	delete(f.secrets, name)
+	return f.save()
+}
+
+// Names returns the sorted names of the secrets in the file
+func (f *FileProvider) Names() ([]string, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.secrets))
+	for name := range f.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *FileProvider) load() error {
+	if f.secrets != nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			f.secrets = map[string]string{}
+			return nil
+		}
+		return err
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(b, &ef); err != nil {
+		return fmt.Errorf("json.Unmarshal %s err = %w", f.path, err)
+	}
+	if ef.Version != fileVersion || ef.KDF != kdfScrypt {
+		return fmt.Errorf("unsupported secrets file %s version=%d kdf=%s", f.path, ef.Version, ef.KDF)
+	}
+
+	if err := f.ensurePassphrase(); err != nil {
+		return err
+	}
+	gcm, err := newGCM(f.passphrase, ef.Salt)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, ef.Nonce, ef.Ciphertext, nil)
+	if err != nil {
+		return ErrBadPassphrase
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("json.Unmarshal secrets err = %w", err)
+	}
+	f.secrets = secrets
+	return nil
+}
+
+func (f *FileProvider) save() error {
+	if err := f.ensurePassphrase(); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(f.secrets)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(f.passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(&encryptedFile{
+		Version:    fileVersion,
+		KDF:        kdfScrypt,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tools.EnsureDir(filepath.Dir(f.path)); err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func (f *FileProvider) ensurePassphrase() error {
+	if f.passphrase != "" {
+		return nil
+	}
+	passphrase, err := f.passphraseFn(fmt.Sprintf("Enter the %s (%s)", passphraseID, f.path))
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return fmt.Errorf("an empty passphrase is not allowed")
+	}
+	f.passphrase = passphrase
+	return nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
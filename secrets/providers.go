@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+	"github.com/mattn/go-shellwords"
+)
+
+// envProvider looks up secrets in environment variables
+type envProvider struct {
+	prefix string
+}
+
+var envNameRE = regexp.MustCompile(`[^A-Z0-9_]`)
+
+func NewEnvProvider(prefix string) Provider {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return &envProvider{prefix: prefix}
+}
+
+func (p *envProvider) Name() string { return ProviderEnv }
+
+// Get looks up the variable named by the prefix followed by the upper-cased
+// name, e.g. db.password is looked up as PRYRITE_SECRET_DB_PASSWORD
+func (p *envProvider) Get(name string) (string, error) {
+	key := p.prefix + envNameRE.ReplaceAllString(strings.ToUpper(name), "_")
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// defaultNotFoundRE matches the stderr of common secret managers, e.g. pass, when
+// the secret does not exist and neither an exit status nor a pattern is configured
+var defaultNotFoundRE = regexp.MustCompile(`(?i)not (found|in the password store)|does not exist|no such (secret|item|file)`)
+
+// commandProvider retrieves secrets by running an external command, like pass
+type commandProvider struct {
+	command string
+	// notFoundExitCode, if not zero, is the exit status meaning the secret does not exist
+	notFoundExitCode int
+	// notFoundRE, if set, matches the stderr when the secret does not exist
+	notFoundRE *regexp.Regexp
+}
+
+func NewCommandProvider(cfg *config.SecretsConfig) (Provider, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("the command secrets provider requires a command")
+	}
+	p := &commandProvider{command: cfg.Command, notFoundExitCode: cfg.NotFoundExitCode}
+	if cfg.NotFoundPattern != "" {
+		re, err := regexp.Compile(cfg.NotFoundPattern)
+		if err != nil {
+			return nil, fmt.Errorf("secrets not_found_pattern: regexp.Compile(%s) err = %v", cfg.NotFoundPattern, err)
+		}
+		p.notFoundRE = re
+	} else if cfg.NotFoundExitCode == 0 {
+		p.notFoundRE = defaultNotFoundRE
+	}
+	return p, nil
+}
+
+func (p *commandProvider) Name() string { return ProviderCommand }
+
+// Get runs the command with {name} substituted by the secret's name, and returns its
+// output without the trailing newline. The command failing with the not found exit
+// status, or stderr, is treated as the secret not being found, any other failure is
+// returned with its stderr.
+func (p *commandProvider) Get(name string) (string, error) {
+	args, err := shellwords.Parse(p.command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "{name}", name)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if (p.notFoundExitCode != 0 && exitErr.ExitCode() == p.notFoundExitCode) ||
+				(p.notFoundRE != nil && p.notFoundRE.MatchString(msg)) {
+				tools.Log.Info().Msgf("commandProvider: %s err = %v stderr = %s", args[0], err, msg)
+				return "", ErrSecretNotFound
+			}
+		}
+		if msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/1xyz/pryrite/config"
+	"github.com/1xyz/pryrite/tools"
+	"golang.org/x/term"
+)
+
+const (
+	ProviderEnv     = "env"
+	ProviderFile    = "file"
+	ProviderCommand = "command"
+
+	DefaultEnvPrefix = "PRYRITE_SECRET_"
+
+	// PassphraseEnv names the environment variable holding the secrets file's passphrase
+	PassphraseEnv = "PRYRITE_SECRETS_PASSPHRASE"
+)
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+
+	// refRE matches a reference to a secret, e.g. ${secret:db_password}
+	refRE = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.\-/]+)\}`)
+)
+
+// Provider is a backend that secrets are retrieved from
+type Provider interface {
+	Name() string
+
+	// Get returns the value of the named secret or ErrSecretNotFound
+	Get(name string) (string, error)
+}
+
+// Resolver replaces references to secrets in content with their values
+type Resolver struct {
+	providers []Provider
+
+	lock  sync.Mutex
+	cache map[string]string
+}
+
+// NewResolver creates a resolver with the providers from the configuration. If no providers
+// are configured, the environment is consulted followed by the secrets file (if it exists)
+// and the command (if configured).
+func NewResolver(cfg *config.SecretsConfig) (*Resolver, error) {
+	if cfg == nil {
+		cfg = &config.SecretsConfig{}
+	}
+
+	names := cfg.Providers
+	if len(names) == 0 {
+		names = []string{ProviderEnv, ProviderFile}
+		if cfg.Command != "" {
+			names = append(names, ProviderCommand)
+		}
+	}
+
+	r := &Resolver{cache: map[string]string{}}
+	for _, name := range names {
+		switch name {
+		case ProviderEnv:
+			r.providers = append(r.providers, NewEnvProvider(cfg.EnvPrefix))
+		case ProviderFile:
+			r.providers = append(r.providers, NewFileProvider(secretsFile(cfg), ReadPassphrase))
+		case ProviderCommand:
+			p, err := NewCommandProvider(cfg)
+			if err != nil {
+				return nil, err
+			}
+			r.providers = append(r.providers, p)
+		default:
+			return nil, fmt.Errorf("unknown secrets provider %s", name)
+		}
+	}
+	return r, nil
+}
+
+// HasReferences returns true if the content refers to one or more secrets
+func HasReferences(content string) bool {
+	return refRE.MatchString(content)
+}
+
+// Resolve returns the content with all secret references replaced by their values.
+// The values are also returned so that they can be masked in any output.
+func (r *Resolver) Resolve(content string) (string, []string, error) {
+	var values []string
+	var resolveErr error
+	resolved := refRE.ReplaceAllStringFunc(content, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		name := refRE.FindStringSubmatch(ref)[1]
+		value, err := r.Get(name)
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		values = append(values, value)
+		return value
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+	return resolved, values, nil
+}
+
+// Get returns the value of the named secret from the first provider that has it
+func (r *Resolver) Get(name string) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if value, ok := r.cache[name]; ok {
+		return value, nil
+	}
+
+	for _, p := range r.providers {
+		value, err := p.Get(name)
+		if err != nil {
+			if errors.Is(err, ErrSecretNotFound) {
+				continue
+			}
+			return "", fmt.Errorf("secret %s: %s provider err = %w", name, p.Name(), err)
+		}
+		tools.Log.Info().Msgf("Resolver.Get: secret %s resolved by the %s provider", name, p.Name())
+		r.cache[name] = value
+		return value, nil
+	}
+	return "", fmt.Errorf("secret %s: %w", name, ErrSecretNotFound)
+}
+
+func secretsFile(cfg *config.SecretsConfig) string {
+	if cfg.File != "" {
+		return cfg.File
+	}
+	return DefaultSecretsFile()
+}
+
+// DefaultSecretsFile returns the path to the encrypted secrets file
+func DefaultSecretsFile() string {
+	return tools.ConfigPath("secrets.enc")
+}
+
+// OpenFile opens the encrypted secrets file from the configuration
+func OpenFile(cfg *config.SecretsConfig) *FileProvider {
+	return NewFileProvider(secretsFile(cfg), ReadPassphrase)
+}
+
+// ReadPassphrase reads the passphrase from the environment or prompts for it on the terminal
+func ReadPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !tools.IsTermEnabled(fd) {
+		return "", fmt.Errorf("cannot prompt for a passphrase, set %s", PassphraseEnv)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
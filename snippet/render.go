@@ -11,7 +11,6 @@ import (
 	"github.com/1xyz/pryrite/markdown"
 	"github.com/1xyz/pryrite/tools"
 	"github.com/jedib0t/go-pretty/v6/table"
-	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -94,7 +93,7 @@ func (nr *nodeRender) renderNodeView(n *graph.Node, w io.Writer) {
 func (nr *nodeRender) getColumnLen() int {
 	_, maxCols, err := tools.GetTermWindowSize()
 	if err != nil {
-		log.Err(err).Msg("tools.GetTermWindowSize()")
+		tools.Log.Err(err).Msg("tools.GetTermWindowSize()")
 		return minDisplayColLen
 	}
 	// allowedLen is the maximum columns allowed
@@ -149,7 +148,7 @@ func (nr *nodesRender) Render() {
 func (nr *nodesRender) getColumnLen() int {
 	_, maxCols, err := tools.GetTermWindowSize()
 	if err != nil {
-		log.Err(err).Msg("tools.GetTermWindowSize()")
+		tools.Log.Err(err).Msg("tools.GetTermWindowSize()")
 		return minDisplayColLen
 	}
 	// allowedLen is the maximum columns allowed
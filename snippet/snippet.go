@@ -15,6 +15,7 @@ import (
 
 	"github.com/1xyz/pryrite/config"
 	"github.com/1xyz/pryrite/graph"
+	"github.com/1xyz/pryrite/graph/outbox"
 	"github.com/1xyz/pryrite/tools"
 )
 
@@ -264,7 +265,7 @@ func EditSnippetNode(ctx *Context, id string, save bool) (*graph.Node, error) {
 	}
 
 	// Compute the file hash before
-	h0, err := computeFileHash("sha256", filename)
+	h0, err := ComputeFileHash("sha256", filename)
 	if err != nil {
 		return nil, err
 	}
@@ -275,7 +276,7 @@ func EditSnippetNode(ctx *Context, id string, save bool) (*graph.Node, error) {
 	}
 
 	// Compute the filehash after edit
-	h1, err := computeFileHash("sha256", filename)
+	h1, err := ComputeFileHash("sha256", filename)
 	if err != nil {
 		return nil, err
 	}
@@ -316,7 +317,7 @@ func EditNodeBlock(ctx *Context, n *graph.Node, b *graph.Block, save bool) (*gra
 	}
 
 	// Compute the file hash before
-	h0, err := computeFileHash("md5", filename)
+	h0, err := ComputeFileHash("md5", filename)
 	if err != nil {
 		return nil, err
 	}
@@ -327,7 +328,7 @@ func EditNodeBlock(ctx *Context, n *graph.Node, b *graph.Block, save bool) (*gra
 	}
 
 	// Compute the filehash after edit
-	h1, err := computeFileHash("md5", filename)
+	h1, err := ComputeFileHash("md5", filename)
 	if err != nil {
 		return nil, err
 	}
@@ -375,8 +376,16 @@ func handleGraphHTTPErr(ghe *graph.HttpError, ctxMessage string) error {
 }
 
 func NewStoreFromContext(ctx *Context) (graph.Store, error) {
-	store := graph.NewStore(ctx.ConfigEntry, ctx.Metadata)
-	return store, nil
+	switch ctx.ConfigEntry.Mode {
+	case config.ModeLocal:
+		return graph.NewLocalStore(config.DefaultLocalStoreFile()), nil
+	case config.ModeRemote, "":
+		return outbox.NewStore(graph.NewStore(ctx.ConfigEntry, ctx.Metadata), outbox.New(config.DefaultOutboxFile()),
+			outbox.TargetOf(ctx.ConfigEntry)), nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q, expected %s or %s", ctx.ConfigEntry.Mode,
+			config.ModeLocal, config.ModeRemote)
+	}
 }
 
 func openFileInEditor(filename string) error {
@@ -402,7 +411,8 @@ func openFileInEditor(filename string) error {
 	return cmd.Run()
 }
 
-func computeFileHash(algo, filename string) ([]byte, error) {
+// ComputeFileHash returns the hash of the file's content using the algo (sha256 or md5)
+func ComputeFileHash(algo, filename string) ([]byte, error) {
 	fr, err := tools.OpenFile(filename, os.O_RDONLY)
 	if err != nil {
 		return nil, err
@@ -3,6 +3,7 @@ package tools
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -16,10 +17,13 @@ import (
 )
 
 var (
-	Log           = zlog.Logger
-	logConfigFile = MyPathTo("logging.yaml")
-	logFile       = MyPathTo("activity.log")
-	traceLabels   = map[string]string{}
+	Log         = zlog.Logger
+	traceLabels = map[string]string{}
+)
+
+const (
+	logConfigFilename = "logging.yaml"
+	logFilename       = "activity.log"
 )
 
 type rollingLogConfig struct {
@@ -31,7 +35,7 @@ type rollingLogConfig struct {
 
 // createLogConfigFile creates a default rolling log config file
 // if ones does not exists
-func createLogConfigFile() error {
+func createLogConfigFile(logConfigFile string) error {
 	exists, err := StatExists(logConfigFile)
 	if err != nil {
 		return err
@@ -44,9 +48,12 @@ func createLogConfigFile() error {
 		MaxSizeMB:  5,
 		MaxBackups: 2,
 		MaxAgeDays: 30,
-		Filename:   logFile,
+		Filename:   StatePath(logFilename),
 	}
+	return writeRollingLogConfig(logConfigFile, c)
+}
 
+func writeRollingLogConfig(logConfigFile string, c *rollingLogConfig) error {
 	fp, err := OpenFile(logConfigFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
 	if err != nil {
 		return fmt.Errorf("OpenFile %s err = %v", logConfigFile, err)
@@ -57,15 +64,19 @@ func createLogConfigFile() error {
 }
 
 // loadRollingLogConfig loads a rolling log configuration from file
-func loadRollingLogConfig() (*rollingLogConfig, error) {
-	if err := createLogConfigFile(); err != nil {
+func loadRollingLogConfig(logConfigFile string) (*rollingLogConfig, error) {
+	if err := createLogConfigFile(logConfigFile); err != nil {
 		return nil, err
 	}
+	return readRollingLogConfig(logConfigFile)
+}
 
+func readRollingLogConfig(logConfigFile string) (*rollingLogConfig, error) {
 	fp, err := OpenFile(logConfigFile, os.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
+	defer CloseFile(fp)
 
 	dec := yaml.NewDecoder(fp)
 	c := rollingLogConfig{}
@@ -75,28 +86,34 @@ func loadRollingLogConfig() (*rollingLogConfig, error) {
 	return &c, nil
 }
 
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
 // OpenLogger opens the default rolling file logger
-// and sets the verbosity of the logger
-func OpenLogger(verbose bool) (io.Closer, error) {
-	// create a log config if needed
-	if err := createLogConfigFile(); err != nil {
-		return nil, err
-	}
-	// load the config from file
-	c, err := loadRollingLogConfig()
-	if err != nil {
-		return nil, err
-	}
-	// ensure that the log directory is present
-	if err := EnsureDir(filepath.Dir(c.Filename)); err != nil {
-		return nil, err
-	}
-	// create log writer
-	w := &lumberjack.Logger{
-		Filename:   c.Filename,
-		MaxBackups: c.MaxBackups,
-		MaxSize:    c.MaxSizeMB,
-		MaxAge:     c.MaxAgeDays,
+// and sets the verbosity of the logger. When readOnly is set no file is
+// created or written, and the activity is not logged.
+func OpenLogger(verbose, readOnly bool) (io.Closer, error) {
+	var w io.Writer = ioutil.Discard
+	var closer io.Closer = nopCloser{}
+	if !readOnly {
+		// load the config from file, creating it if needed
+		c, err := loadRollingLogConfig(ConfigPath(logConfigFilename))
+		if err != nil {
+			return nil, err
+		}
+		// ensure that the log directory is present
+		if err := EnsureDir(filepath.Dir(c.Filename)); err != nil {
+			return nil, err
+		}
+		// create log writer
+		lw := &lumberjack.Logger{
+			Filename:   c.Filename,
+			MaxBackups: c.MaxBackups,
+			MaxSize:    c.MaxSizeMB,
+			MaxAge:     c.MaxAgeDays,
+		}
+		w, closer = lw, lw
 	}
 	// set log level
 	level := zerolog.InfoLevel
@@ -119,7 +136,7 @@ func OpenLogger(verbose bool) (io.Closer, error) {
 			Log.Debug().Str("labels", labelsStr).Msg("TRACE logs enabled")
 		}
 	}
-	return w, nil
+	return closer, nil
 }
 
 func TrimLength(s string, maxLen int) string {
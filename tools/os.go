@@ -1,28 +1,326 @@
 package tools
 
 import (
-	"github.com/1xyz/pryrite/app"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/1xyz/pryrite/app"
+)
+
+// The files are kept in three directories: the configuration (pryrite.yaml, the
+// logins and secrets), the state (the stores, result logs, history and activity log)
+// and the cache (the copies of remote markdown files). They follow the XDG base
+// directory specification, unless --data-dir or PRYRITE_HOME names one directory
+// to keep all of them in, laid out as the legacy ~/.pryrite directory.
+const (
+	// DataDirEnv names the environment variable of the directory to keep all the files in
+	DataDirEnv = "PRYRITE_HOME"
+
+	SourceFlag   = "--data-dir"
+	SourceEnv    = DataDirEnv
+	SourceXDG    = "xdg"
+	SourceLegacy = "legacy"
+
+	// migratedFile is left in the legacy directory when it is not empty after the migration
+	migratedFile = "MIGRATED"
+)
+
+// Dirs are the directories the files are kept in
+type Dirs struct {
+	Config string
+	State  string
+	Cache  string
+	// Source is what chose the directories
+	Source string
+}
+
+var (
+	dataDir  string
+	dirs     *Dirs
+	dirsLock sync.Mutex
+
+	// legacyConfigFiles are the files of the legacy directory that are moved to
+	// the configuration directory, the cache is moved to the cache directory and
+	// everything else to the state directory
+	legacyConfigFiles = map[string]bool{
+		"pryrite.yaml":     true,
+		"logging.yaml":     true,
+		"credentials.json": true,
+		"secrets.enc":      true,
+	}
+	legacyCacheDir = "cache"
 )
 
-var myDirectory string
+// SetDataDir keeps all the files in dir, rather than the directory named by
+// PRYRITE_HOME or the XDG directories. It has to be called before a path is used.
+func SetDataDir(dir string) {
+	dirsLock.Lock()
+	defer dirsLock.Unlock()
+	dataDir = dir
+	dirs = nil
+}
+
+// AppDirs returns the directories the files are kept in, it does not create
+// them. A legacy ~/.pryrite directory is used until PrepareAppDirs moves it.
+func AppDirs() (*Dirs, error) {
+	dirsLock.Lock()
+	defer dirsLock.Unlock()
+	if dirs != nil {
+		return dirs, nil
+	}
+	d, err := resolveDirs()
+	if err != nil {
+		return nil, err
+	}
+	dirs = d
+	return dirs, nil
+}
+
+// Migration describes the move of the files of the legacy directory to the XDG directories
+type Migration struct {
+	Legacy string
+	// Moved are the files moved, by their path in the legacy directory
+	Moved map[string]string
+	// Kept are the files left in the legacy directory as they already were in the directories
+	Kept []string
+	// Err is why the files could not be moved, the legacy directory is used instead
+	Err error
+	// Warnings are the problems that did not stop the move
+	Warnings []string
+}
+
+// Log reports the migration, once the logger is open
+func (m *Migration) Log() {
+	if m.Err != nil {
+		LogStderr(m.Err, "%s is used as it could not be moved to the XDG directories: %v\n", m.Legacy, m.Err)
+		return
+	}
+	from := make([]string, 0, len(m.Moved))
+	for f := range m.Moved {
+		from = append(from, f)
+	}
+	sort.Strings(from)
+	LogStdError("The files of %s were moved to the XDG directories, see config dirs:\n", m.Legacy)
+	for _, f := range from {
+		LogStdError("  %s -> %s\n", f, m.Moved[f])
+	}
+	if len(m.Kept) > 0 {
+		LogStdError("These files were already there and are left in %s: %s\n", m.Legacy, strings.Join(m.Kept, ", "))
+	}
+	for _, w := range m.Warnings {
+		LogStdError("%s\n", w)
+	}
+}
 
-func MyPathTo(filename string) string {
-	if myDirectory == "" {
+// PrepareAppDirs creates the directories the files are kept in. The first time
+// the XDG directories are used the files of a legacy ~/.pryrite directory are
+// moved to them, the returned migration describes it and is nil if there was
+// nothing to move. It is called once, before a path is used, unless nothing may
+// be written.
+func PrepareAppDirs() (*Migration, error) {
+	dirsLock.Lock()
+	defer dirsLock.Unlock()
+	var m *Migration
+	if dir, _ := explicitDataDir(); dir == "" {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		d, legacy := xdgDirs(homeDir), filepath.Join(homeDir, app.AppDirectory)
+		if m, err = migrateLegacyDir(legacy, d); err != nil {
+			m = &Migration{Legacy: legacy, Err: err}
+		}
+	}
+	d, err := resolveDirs()
+	if err != nil {
+		return m, err
+	}
+	for _, dir := range []string{d.Config, d.State, d.Cache} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return m, err
+		}
+	}
+	dirs = d
+	return m, nil
+}
+
+// ConfigPath returns the path to the file in the configuration directory
+func ConfigPath(filename string) string {
+	return filepath.Join(mustAppDirs().Config, filename)
+}
+
+// StatePath returns the path to the file in the state directory
+func StatePath(filename string) string {
+	return filepath.Join(mustAppDirs().State, filename)
+}
+
+// CachePath returns the path to the file in the cache directory
+func CachePath(filename string) string {
+	return filepath.Join(mustAppDirs().Cache, filename)
+}
+
+func mustAppDirs() *Dirs {
+	d, err := AppDirs()
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// explicitDataDir returns the directory of --data-dir or PRYRITE_HOME, and which one it is
+func explicitDataDir() (string, string) {
+	if dataDir != "" {
+		return dataDir, SourceFlag
+	}
+	return os.Getenv(DataDirEnv), SourceEnv
+}
+
+func resolveDirs() (*Dirs, error) {
+	if dir, source := explicitDataDir(); dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", source, dir, err)
 		}
+		return &Dirs{Config: abs, State: abs, Cache: abs, Source: source}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	legacy := filepath.Join(homeDir, app.AppDirectory)
+	pending, err := legacyPending(legacy)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return &Dirs{Config: legacy, State: legacy, Cache: legacy, Source: SourceLegacy}, nil
+	}
+	return xdgDirs(homeDir), nil
+}
+
+func xdgDirs(homeDir string) *Dirs {
+	return &Dirs{
+		Config: filepath.Join(xdgDir("XDG_CONFIG_HOME", homeDir, ".config"), app.Name),
+		State:  filepath.Join(xdgDir("XDG_STATE_HOME", homeDir, ".local", "state"), app.Name),
+		Cache:  filepath.Join(xdgDir("XDG_CACHE_HOME", homeDir, ".cache"), app.Name),
+		Source: SourceXDG,
+	}
+}
+
+// legacyPending reports whether the legacy directory has files that were not moved
+func legacyPending(legacy string) (bool, error) {
+	if exists, err := StatExists(filepath.Join(legacy, migratedFile)); err != nil || exists {
+		return false, err
+	}
+	files, err := ioutil.ReadDir(legacy)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(files) > 0, nil
+}
+
+// xdgDir returns the directory of the environment variable, or the default in
+// the home directory. Relative paths are ignored, as the specification requires.
+func xdgDir(env, homeDir string, elem ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{homeDir}, elem...)...)
+}
+
+// migrateLegacyDir moves the files of the legacy directory to the directories
+// once, it returns nil if there is nothing to move. Files already in the
+// directories are not replaced. If a file cannot be moved the ones moved are
+// put back.
+func migrateLegacyDir(legacy string, d *Dirs) (*Migration, error) {
+	if exists, err := StatExists(filepath.Join(legacy, migratedFile)); err != nil || exists {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(legacy)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, os.Remove(legacy)
+	}
 
-		myDir := filepath.Join(homeDir, app.AppDirectory)
-		err = os.Mkdir(myDir, 0700)
-		if err != nil && !os.IsExist(err) {
-			panic(err)
+	type move struct{ from, to string }
+	moved := []move{}
+	m := &Migration{Legacy: legacy, Moved: map[string]string{}}
+	// undo puts the files back, the error says which could not be
+	undo := func(err error) error {
+		for i := len(moved) - 1; i >= 0; i-- {
+			if uerr := os.Rename(moved[i].to, moved[i].from); uerr != nil {
+				err = fmt.Errorf("%w, and %s could not be moved back to %s: %v", err, moved[i].to, moved[i].from, uerr)
+			}
+		}
+		return err
+	}
+	for _, f := range files {
+		dir := d.State
+		if legacyConfigFiles[f.Name()] {
+			dir = d.Config
+		} else if f.Name() == legacyCacheDir {
+			dir = d.Cache
 		}
+		mv := move{from: filepath.Join(legacy, f.Name()), to: filepath.Join(dir, f.Name())}
+		if exists, err := StatExists(mv.to); err != nil || exists {
+			if err != nil {
+				return nil, undo(err)
+			}
+			m.Kept = append(m.Kept, f.Name())
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, undo(err)
+		}
+		if err := os.Rename(mv.from, mv.to); err != nil {
+			return nil, undo(err)
+		}
+		moved = append(moved, mv)
+		m.Moved[mv.from] = mv.to
+	}
+	if err := relocateLogFile(filepath.Join(d.Config, logConfigFilename), legacy, d.State); err != nil {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("the activity log of %s was not updated: %v",
+			filepath.Join(d.Config, logConfigFilename), err))
+	}
 
-		myDirectory = myDir
+	// what is left was already in the directories
+	if err := os.Remove(legacy); err != nil {
+		msg := fmt.Sprintf("The files of this directory were moved to %s, %s and %s.\n"+
+			"The ones left are also in those directories and were not replaced.\n", d.Config, d.State, d.Cache)
+		if err := ioutil.WriteFile(filepath.Join(legacy, migratedFile), []byte(msg), 0600); err != nil {
+			m.Warnings = append(m.Warnings, fmt.Sprintf("%s was not marked as moved: %v", legacy, err))
+		}
 	}
+	return m, nil
+}
 
-	return filepath.Join(myDirectory, filename)
+// relocateLogFile points the rolling log configuration at the state directory
+// if its log file was in the legacy directory
+func relocateLogFile(configFile, legacy, stateDir string) error {
+	exists, err := StatExists(configFile)
+	if err != nil || !exists {
+		return err
+	}
+	c, err := readRollingLogConfig(configFile)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(legacy, c.Filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	c.Filename = filepath.Join(stateDir, rel)
+	return writeRollingLogConfig(configFile, c)
 }
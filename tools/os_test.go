@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1xyz/pryrite/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirs")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer SetDataDir("")
+
+	os.Setenv(DataDirEnv, filepath.Join(dir, "env"))
+	defer os.Unsetenv(DataDirEnv)
+	SetDataDir("")
+	d, err := AppDirs()
+	assert.Nil(t, err)
+	assert.Equal(t, &Dirs{Config: filepath.Join(dir, "env"), State: filepath.Join(dir, "env"),
+		Cache: filepath.Join(dir, "env"), Source: SourceEnv}, d)
+
+	// the flag wins over the environment
+	SetDataDir(filepath.Join(dir, "flag"))
+	assert.Equal(t, filepath.Join(dir, "flag", "pryrite.yaml"), ConfigPath("pryrite.yaml"))
+	assert.Equal(t, filepath.Join(dir, "flag", "result_log"), StatePath("result_log"))
+	// the paths are only resolved
+	exists, err := StatExists(filepath.Join(dir, "flag"))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	m, err := PrepareAppDirs()
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+	exists, err = StatExists(filepath.Join(dir, "flag"))
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestAppDirs_Legacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirs")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer SetDataDir("")
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", home)
+	for _, env := range []string{DataDirEnv, "XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME"} {
+		if value, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			defer os.Setenv(env, value)
+		}
+	}
+	legacy := filepath.Join(dir, app.AppDirectory)
+	assert.Nil(t, os.MkdirAll(legacy, 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(legacy, "pryrite.yaml"), []byte("default: old\n"), 0600))
+
+	// the legacy directory is used until it is moved
+	SetDataDir("")
+	d, err := AppDirs()
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLegacy, d.Source)
+	assert.Equal(t, filepath.Join(legacy, "pryrite.yaml"), ConfigPath("pryrite.yaml"))
+
+	m, err := PrepareAppDirs()
+	assert.Nil(t, err)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, map[string]string{
+			filepath.Join(legacy, "pryrite.yaml"): filepath.Join(dir, ".config", "pryrite", "pryrite.yaml"),
+		}, m.Moved)
+	}
+	d, err = AppDirs()
+	assert.Nil(t, err)
+	assert.Equal(t, SourceXDG, d.Source)
+	b, err := ioutil.ReadFile(ConfigPath("pryrite.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "default: old\n", string(b))
+}
+
+func TestXDGDir(t *testing.T) {
+	os.Setenv("XDG_STATE_HOME", "relative/state")
+	defer os.Unsetenv("XDG_STATE_HOME")
+	assert.Equal(t, filepath.Join("/home/me", ".local", "state"), xdgDir("XDG_STATE_HOME", "/home/me", ".local", "state"))
+
+	os.Setenv("XDG_STATE_HOME", "/var/state")
+	assert.Equal(t, "/var/state", xdgDir("XDG_STATE_HOME", "/home/me", ".local", "state"))
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirs")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	legacy := filepath.Join(dir, ".pryrite")
+	d := &Dirs{
+		Config: filepath.Join(dir, "config"),
+		State:  filepath.Join(dir, "state"),
+		Cache:  filepath.Join(dir, "cache"),
+	}
+
+	m, err := migrateLegacyDir(legacy, d)
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(legacy, "result_log", "n1"), 0700))
+	assert.Nil(t, os.MkdirAll(filepath.Join(legacy, "cache"), 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(legacy, "pryrite.yaml"), []byte("default: old\n"), 0600))
+	assert.Nil(t, writeRollingLogConfig(filepath.Join(legacy, "logging.yaml"),
+		&rollingLogConfig{MaxSizeMB: 5, Filename: filepath.Join(legacy, "activity.log")}))
+	// a file already in the directories is kept
+	assert.Nil(t, os.MkdirAll(d.State, 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(d.State, "store.db"), []byte("new"), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(legacy, "store.db"), []byte("old"), 0600))
+
+	m, err = migrateLegacyDir(legacy, d)
+	assert.Nil(t, err)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, []string{"store.db"}, m.Kept)
+		assert.Equal(t, filepath.Join(d.Cache, "cache"), m.Moved[filepath.Join(legacy, "cache")])
+		assert.Empty(t, m.Warnings)
+	}
+	for _, p := range []string{
+		filepath.Join(d.Config, "pryrite.yaml"),
+		filepath.Join(d.State, "result_log", "n1"),
+		filepath.Join(d.Cache, "cache"),
+		filepath.Join(legacy, migratedFile),
+	} {
+		exists, err := StatExists(p)
+		assert.Nil(t, err)
+		assert.True(t, exists, p)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(d.State, "store.db"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(b))
+	c, err := readRollingLogConfig(filepath.Join(d.Config, "logging.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(d.State, "activity.log"), c.Filename)
+
+	// it is only done once
+	m, err = migrateLegacyDir(legacy, d)
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+}
@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// DefaultPager keeps colours (-R), quits if the content fits on one screen (-F)
+// and leaves the content on the screen when it quits (-X)
+const DefaultPager = "less -FRX"
+
+// Page writes the content to stdout through $PAGER (or the DefaultPager) when
+// stdout is a terminal, otherwise the content is written to stdout as is
+func Page(content string) error {
+	if !IsTermEnabled(int(os.Stdout.Fd())) {
+		_, err := fmt.Fprint(os.Stdout, content)
+		return err
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = DefaultPager
+	}
+	args, err := shellwords.Parse(pager)
+	if err != nil || len(args) == 0 {
+		Log.Warn().Msgf("Page: cannot parse PAGER=%s err = %v", pager, err)
+		_, err := fmt.Fprint(os.Stdout, content)
+		return err
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		Log.Warn().Msgf("Page: pager %s not found", args[0])
+		_, err := fmt.Fprint(os.Stdout, content)
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
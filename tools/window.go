@@ -19,6 +19,10 @@ func GetTermWindowSize() (int, int, error) {
 		rows = 30
 		cols = 120
 	} else {
+		// pty.Getsize panics rather than failing if stdin is not a terminal
+		if !IsTermEnabled(int(os.Stdin.Fd())) {
+			return 0, 0, fmt.Errorf("stdin is not a terminal")
+		}
 		var err error
 		rows, cols, err = pty.Getsize(os.Stdin)
 		if err != nil {